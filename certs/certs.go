@@ -0,0 +1,137 @@
+// Package certs loads the TLS certificates of the servers & clients, reloading them whenever their files change
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileStamp represents the version of a file, which changes whenever the file is written
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stamp retrieves the version of a file
+func stamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// KeyPair represents a certificate & its private key, read from PEM files
+// the files are read again whenever they change, so renewed certificates apply
+// to the next handshake without a restart
+type KeyPair struct {
+	certPath string
+	keyPath  string
+	mu       sync.Mutex
+	stamps   [2]fileStamp
+	cert     *tls.Certificate
+}
+
+// NewKeyPair creates a new instance of KeyPair, the files must hold a valid key pair on creation
+func NewKeyPair(certPath, keyPath string) (*KeyPair, error) {
+	p := &KeyPair{certPath: certPath, keyPath: keyPath}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Certificate retrieves the latest valid certificate
+// while the files are being replaced (e.g. the certificate is written, but its key is not yet)
+// the previous certificate is kept
+func (p *KeyPair) Certificate() *tls.Certificate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.reload(); err != nil {
+		log.Printf("could not reload certificate %s, keeping the previous one: %v", p.certPath, err)
+	}
+	return p.cert
+}
+
+// reload reads the files again, when they changed since they were last read
+// the caller must hold the lock
+func (p *KeyPair) reload() error {
+	certStamp, err := stamp(p.certPath)
+	if err != nil {
+		return fmt.Errorf("could not read certificate: %v", err)
+	}
+	keyStamp, err := stamp(p.keyPath)
+	if err != nil {
+		return fmt.Errorf("could not read private key: %v", err)
+	}
+	stamps := [2]fileStamp{certStamp, keyStamp}
+	if p.cert != nil && stamps == p.stamps {
+		return nil
+	}
+	// the files are only retried once they change again
+	p.stamps = stamps
+	cert, err := tls.LoadX509KeyPair(p.certPath, p.keyPath)
+	if err != nil {
+		return fmt.Errorf("could not load key pair: %v", err)
+	}
+	p.cert = &cert
+	return nil
+}
+
+// Pool represents the certificate authorities of a PEM file
+// the file is read again whenever it changes
+type Pool struct {
+	path  string
+	mu    sync.Mutex
+	stamp fileStamp
+	pool  *x509.CertPool
+}
+
+// NewPool creates a new instance of Pool, the file must hold at least one certificate on creation
+func NewPool(path string) (*Pool, error) {
+	p := &Pool{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CertPool retrieves the latest valid certificate pool
+// the same pool is retrieved until the file changes
+func (p *Pool) CertPool() *x509.CertPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.reload(); err != nil {
+		log.Printf("could not reload certificate authorities %s, keeping the previous ones: %v", p.path, err)
+	}
+	return p.pool
+}
+
+// reload reads the file again, when it changed since it was last read
+// the caller must hold the lock
+func (p *Pool) reload() error {
+	s, err := stamp(p.path)
+	if err != nil {
+		return fmt.Errorf("could not read certificate authorities: %v", err)
+	}
+	if p.pool != nil && s == p.stamp {
+		return nil
+	}
+	p.stamp = s
+	bs, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("could not read certificate authorities: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return fmt.Errorf("no PEM certificate found in %s", p.path)
+	}
+	p.pool = pool
+	return nil
+}
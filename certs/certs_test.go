@@ -0,0 +1,304 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// reloading a replaced certificate logs, which drowns the test output
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// authority represents a test certificate authority
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// serial is the serial number of the last issued test certificate
+var serial int64
+
+// newKey generates a private key, failing the test if it could not
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	return key
+}
+
+// sign creates a certificate of the template, signed by the parent (self signed when parent is nil)
+func sign(t *testing.T, template *x509.Certificate, key *ecdsa.PrivateKey, parent *authority) (*x509.Certificate, []byte) {
+	t.Helper()
+	serial++
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// newAuthority generates a certificate authority
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+	key := newKey(t)
+	cert, bs := sign(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, key, nil)
+	return &authority{cert: cert, key: key, pem: bs}
+}
+
+// issue generates a certificate signed by the authority & retrieves the PEM certificate & key
+// server certificates are valid for localhost & 127.0.0.1
+func (a *authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key := newKey(t)
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}
+	if usage == x509.ExtKeyUsageServerAuth {
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	_, cert := sign(t, template, key, a)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// files represents the PEM files of a test, in a temp dir
+type files struct {
+	t   *testing.T
+	dir string
+}
+
+func newFiles(t *testing.T) files {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return files{t: t, dir: dir}
+}
+
+// write replaces a file & retrieves its path
+// the modification time is moved forward, so the rewrite is seen even on coarse file system clocks
+func (f files) write(name string, bs []byte) string {
+	f.t.Helper()
+	path := filepath.Join(f.dir, name)
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := ioutil.WriteFile(path, bs, 0600); err != nil {
+		f.t.Fatalf("could not write %s: %v", name, err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			f.t.Fatalf("could not touch %s: %v", name, err)
+		}
+	}
+	return path
+}
+
+// serve starts an HTTPS server with the TLS config, which responds with the common name
+// of the client certificate, & retrieves its url
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	})}
+	// every request makes a new handshake, so reloaded certificates are seen
+	srv.SetKeepAlivesEnabled(false)
+	go func() { _ = srv.Serve(tls.NewListener(l, cfg)) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return "https://" + l.Addr().String()
+}
+
+// get sends a request with the client options & retrieves the common names
+// of the server certificate & of the client certificate the server saw
+func get(t *testing.T, url string, opts ClientOptions) (string, string, error) {
+	t.Helper()
+	tr, err := NewTransport(opts)
+	if err != nil {
+		t.Fatalf("could not create transport: %v", err)
+	}
+	return getWith(tr, url)
+}
+
+func getWith(tr http.RoundTripper, url string) (string, string, error) {
+	client := &http.Client{Transport: tr, Timeout: 5 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = res.Body.Close() }()
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", "", err
+	}
+	return res.TLS.PeerCertificates[0].Subject.CommonName, string(bs), nil
+}
+
+func TestServerConfigServesHTTPS(t *testing.T) {
+	f := newFiles(t)
+	ca := newAuthority(t, "test ca")
+	cert, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	cfg, err := ServerConfig(f.write("server.pem", cert), f.write("server.key", key), "")
+	if err != nil {
+		t.Fatalf("could not create server config: %v", err)
+	}
+	url := serve(t, cfg)
+
+	server, _, err := get(t, url, ClientOptions{CAPath: f.write("ca.pem", ca.pem)})
+	if err != nil {
+		t.Fatalf("could not send request: %v", err)
+	}
+	if server != "server" {
+		t.Errorf("expected the server certificate, got %q", server)
+	}
+	other := newAuthority(t, "other ca")
+	if _, _, err := get(t, url, ClientOptions{CAPath: f.write("other.pem", other.pem)}); err == nil {
+		t.Error("expected a server certificate of an untrusted authority to be rejected")
+	}
+}
+
+func TestServerConfigRequiresClientCertificates(t *testing.T) {
+	f := newFiles(t)
+	ca := newAuthority(t, "test ca")
+	cert, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	cfg, err := ServerConfig(f.write("server.pem", cert), f.write("server.key", key), f.write("ca.pem", ca.pem))
+	if err != nil {
+		t.Fatalf("could not create server config: %v", err)
+	}
+	url := serve(t, cfg)
+	caPath := filepath.Join(f.dir, "ca.pem")
+
+	if _, _, err := get(t, url, ClientOptions{CAPath: caPath}); err == nil {
+		t.Error("expected a request without a client certificate to be rejected")
+	}
+	other := newAuthority(t, "other ca")
+	otherCert, otherKey := other.issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+	_, _, err = get(t, url, ClientOptions{
+		CAPath:   caPath,
+		CertPath: f.write("intruder.pem", otherCert),
+		KeyPath:  f.write("intruder.key", otherKey),
+	})
+	if err == nil {
+		t.Error("expected a client certificate of another authority to be rejected")
+	}
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	_, client, err := get(t, url, ClientOptions{
+		CAPath:   caPath,
+		CertPath: f.write("client.pem", clientCert),
+		KeyPath:  f.write("client.key", clientKey),
+	})
+	if err != nil {
+		t.Fatalf("could not send request with a client certificate: %v", err)
+	}
+	if client != "client" {
+		t.Errorf("expected the server to see the client certificate, got %q", client)
+	}
+}
+
+// TestServerConfigReloadsRewrittenFiles rewrites the server certificate & the client authorities
+// of a running server, the way a certificate renewal does
+func TestServerConfigReloadsRewrittenFiles(t *testing.T) {
+	f := newFiles(t)
+	ca := newAuthority(t, "test ca")
+	cert, key := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	certPath, keyPath := f.write("server.pem", cert), f.write("server.key", key)
+	clientCAPath := f.write("client-ca.pem", ca.pem)
+	cfg, err := ServerConfig(certPath, keyPath, clientCAPath)
+	if err != nil {
+		t.Fatalf("could not create server config: %v", err)
+	}
+	url := serve(t, cfg)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	tr, err := NewTransport(ClientOptions{
+		CAPath:   f.write("ca.pem", ca.pem),
+		CertPath: f.write("client.pem", clientCert),
+		KeyPath:  f.write("client.key", clientKey),
+	})
+	if err != nil {
+		t.Fatalf("could not create transport: %v", err)
+	}
+	check := func(want string) {
+		t.Helper()
+		server, _, err := getWith(tr, url)
+		if err != nil {
+			t.Fatalf("could not send request: %v", err)
+		}
+		if server != want {
+			t.Errorf("expected server certificate %q, got %q", want, server)
+		}
+	}
+	check("first")
+
+	// the certificate is written before its key, until then the previous pair is served
+	cert, key = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	f.write("server.pem", cert)
+	check("first")
+	f.write("server.key", key)
+	check("second")
+
+	// once the client authorities are replaced, the previous client certificate is rejected
+	other := newAuthority(t, "other ca")
+	f.write("client-ca.pem", other.pem)
+	if _, _, err := getWith(tr, url); err == nil {
+		t.Fatal("expected the client certificate to be rejected once its authority was replaced")
+	}
+	clientCert, clientKey = other.issue(t, "renewed client", x509.ExtKeyUsageClientAuth)
+	f.write("client.pem", clientCert)
+	f.write("client.key", clientKey)
+	_, client, err := getWith(tr, url)
+	if err != nil {
+		t.Fatalf("could not send request with the renewed client certificate: %v", err)
+	}
+	if client != "renewed client" {
+		t.Errorf("expected the server to see the renewed client certificate, got %q", client)
+	}
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"sync"
+)
+
+// ServerConfig creates the TLS config of an HTTPS server
+// with a clientCAPath, clients must present a certificate signed by one of its authorities (mutual TLS)
+func ServerConfig(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	pair, err := NewKeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return pair.Certificate(), nil
+		},
+	}
+	if clientCAPath == "" {
+		return cfg, nil
+	}
+	clientCAs, err := NewPool(clientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var current *tls.Config
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the config is only rebuilt once the client authorities change
+		if pool := clientCAs.CertPool(); current == nil || current.ClientCAs != pool {
+			current = &tls.Config{
+				MinVersion:     cfg.MinVersion,
+				GetCertificate: cfg.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      pool,
+			}
+		}
+		return current, nil
+	}
+	return cfg, nil
+}
+
+// ClientOptions represents the TLS options of an HTTP client
+// CAPath holds the authorities trusted to sign the server certificates (the system ones when empty)
+// CertPath & KeyPath hold the client certificate, presented to servers which require one
+type ClientOptions struct {
+	CAPath   string
+	CertPath string
+	KeyPath  string
+}
+
+// Transport represents an HTTP transport whose TLS files are read again whenever they change
+type Transport struct {
+	roots     *Pool
+	pair      *KeyPair
+	mu        sync.Mutex
+	current   *http.Transport
+	rootsUsed *x509.CertPool
+}
+
+// NewTransport creates a new instance of Transport
+func NewTransport(opts ClientOptions) (*Transport, error) {
+	t := &Transport{}
+	var err error
+	if opts.CAPath != "" {
+		if t.roots, err = NewPool(opts.CAPath); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CertPath != "" || opts.KeyPath != "" {
+		if t.pair, err = NewKeyPair(opts.CertPath, opts.KeyPath); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// RoundTrip sends a request with the latest certificates
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport().RoundTrip(req)
+}
+
+// transport retrieves the underlying transport, which is replaced once the trusted authorities change
+// the client certificate is read on every handshake, so it does not require a new transport
+func (t *Transport) transport() *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var roots *x509.CertPool
+	if t.roots != nil {
+		roots = t.roots.CertPool()
+	}
+	if t.current != nil && roots == t.rootsUsed {
+		return t.current
+	}
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+	}
+	if t.pair != nil {
+		tr.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return t.pair.Certificate(), nil
+		}
+	}
+	t.current, t.rootsUsed = tr, roots
+	return tr
+}
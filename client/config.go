@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gophertuts/reminders-cli/certs"
+)
+
+// TokenEnv is the environment variable holding the API token
+const TokenEnv = "REMINDERS_TOKEN"
+
+// Config represents the client config file
+// CA, Cert & Key are the paths of the PEM files used to reach an https backend API
+type Config struct {
+	Token string `json:"token"`
+	CA    string `json:"ca,omitempty"`
+	Cert  string `json:"cert,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
+// DefaultConfigPath retrieves the path of the client config file in the user config directory
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "reminders", "config.json")
+}
+
+// LoadConfig reads the client config file, a missing file is an empty config
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, wrapError("could not read config file", err)
+	}
+	if err := json.Unmarshal(bs, &cfg); err != nil {
+		return cfg, wrapError("could not decode config file", err)
+	}
+	return cfg, nil
+}
+
+// ResolveToken retrieves the API token from the flag, else from the environment, else from the config file
+func ResolveToken(flagToken, configPath string) (string, error) {
+	if flagToken != "" {
+		return flagToken, nil
+	}
+	if token := os.Getenv(TokenEnv); token != "" {
+		return token, nil
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Token, nil
+}
+
+// ResolveTransport creates the transport of the backend API requests from the TLS flags,
+// else from the config file, nil means the default transport
+// the certificate files are read again whenever they change
+func ResolveTransport(opts certs.ClientOptions, configPath string) (http.RoundTripper, error) {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.CAPath == "" {
+		opts.CAPath = cfg.CA
+	}
+	if opts.CertPath == "" && opts.KeyPath == "" {
+		opts.CertPath, opts.KeyPath = cfg.Cert, cfg.Key
+	}
+	if (opts.CertPath == "") != (opts.KeyPath == "") {
+		return nil, fmt.Errorf("the client certificate & its key must be set together")
+	}
+	if opts.CAPath == "" && opts.CertPath == "" {
+		return nil, nil
+	}
+	transport, err := certs.NewTransport(opts)
+	if err != nil {
+		return nil, wrapError("could not load certificates", err)
+	}
+	return transport, nil
+}
@@ -1,44 +1,81 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 // reminderBody represents reminder request body
 type reminderBody struct {
-	ID       string        `json:"id"`
-	Title    string        `json:"title"`
-	Message  string        `json:"message"`
-	Duration time.Duration `json:"duration"`
+	ID          string        `json:"id"`
+	UID         string        `json:"uid,omitempty"`
+	Title       string        `json:"title"`
+	Message     string        `json:"message"`
+	Duration    time.Duration `json:"duration"`
+	DueAt       string        `json:"due_at,omitempty"`
+	TimeZone    string        `json:"time_zone,omitempty"`
+	Repeat      string        `json:"repeat,omitempty"`
+	RepeatUntil string        `json:"repeat_until,omitempty"`
+	RepeatCount int           `json:"repeat_count,omitempty"`
+}
+
+// importContentTypes maps the import formats to their media types
+var importContentTypes = map[string]string{
+	"json": "application/json",
+	"csv":  "text/csv",
+	"ics":  "text/calendar",
+}
+
+// Schedule represents when a reminder is due: after a Duration or At an
+// absolute time in a TimeZone, optionally repeating by a Repeat rule
+type Schedule struct {
+	Duration    time.Duration
+	At          string
+	TimeZone    string
+	Repeat      string
+	RepeatUntil string
+	RepeatCount int
 }
 
 // HTTPClient represents the HTTP client which communicates with reminders backend API
+// Token is the API token sent with every request, if any
 type HTTPClient struct {
 	client     *http.Client
 	BackendURI string
+	Token      string
 }
 
 // NewHTTPClient creates a new instance of HTTPClient
-func NewHTTPClient(uri string) HTTPClient {
+// transport sends the requests, e.g. over TLS with a client certificate (the default transport when nil)
+func NewHTTPClient(uri, token string, transport http.RoundTripper) HTTPClient {
 	return HTTPClient{
 		BackendURI: uri,
-		client:     &http.Client{},
+		Token:      token,
+		client:     &http.Client{Transport: transport},
 	}
 }
 
 // Create calls the create API endpoint
-func (c HTTPClient) Create(title, message string, duration time.Duration) ([]byte, error) {
+// uid is an optional client generated UUID
+func (c HTTPClient) Create(uid, title, message string, schedule Schedule) ([]byte, error) {
 	requestBody := reminderBody{
-		Title:    title,
-		Message:  message,
-		Duration: duration,
+		UID:         uid,
+		Title:       title,
+		Message:     message,
+		Duration:    schedule.Duration,
+		DueAt:       schedule.At,
+		TimeZone:    schedule.TimeZone,
+		Repeat:      schedule.Repeat,
+		RepeatUntil: schedule.RepeatUntil,
+		RepeatCount: schedule.RepeatCount,
 	}
 	return c.apiCall(
 		http.MethodPost,
@@ -49,12 +86,14 @@ func (c HTTPClient) Create(title, message string, duration time.Duration) ([]byt
 }
 
 // Edit calls the edit API endpoint
-func (c HTTPClient) Edit(id string, title, message string, duration time.Duration) ([]byte, error) {
+func (c HTTPClient) Edit(id string, title, message string, schedule Schedule) ([]byte, error) {
 	requestBody := reminderBody{
 		ID:       id,
 		Title:    title,
 		Message:  message,
-		Duration: duration,
+		Duration: schedule.Duration,
+		DueAt:    schedule.At,
+		TimeZone: schedule.TimeZone,
 	}
 	return c.apiCall(
 		http.MethodPatch,
@@ -75,6 +114,20 @@ func (c HTTPClient) Fetch(ids []string) ([]byte, error) {
 	)
 }
 
+// List calls the list API endpoint
+func (c HTTPClient) List(query url.Values) ([]byte, error) {
+	path := "/reminders"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.apiCall(
+		http.MethodGet,
+		path,
+		nil,
+		http.StatusOK,
+	)
+}
+
 // Delete calls the delete API endpoint
 func (c HTTPClient) Delete(ids []string) error {
 	idsSet := strings.Join(ids, ",")
@@ -87,13 +140,165 @@ func (c HTTPClient) Delete(ids []string) error {
 	return err
 }
 
+// Snooze calls the snooze API endpoint
+func (c HTTPClient) Snooze(id string, duration time.Duration, until, tz string) ([]byte, error) {
+	requestBody := struct {
+		Duration time.Duration `json:"duration,omitempty"`
+		Until    string        `json:"until,omitempty"`
+		TimeZone string        `json:"time_zone,omitempty"`
+	}{
+		Duration: duration,
+		Until:    until,
+		TimeZone: tz,
+	}
+	return c.apiCall(
+		http.MethodPost,
+		"/reminders/"+id+"/snooze",
+		&requestBody,
+		http.StatusOK,
+	)
+}
+
+// Complete calls the complete API endpoint
+func (c HTTPClient) Complete(id string) ([]byte, error) {
+	return c.apiCall(
+		http.MethodPost,
+		"/reminders/"+id+"/complete",
+		nil,
+		http.StatusOK,
+	)
+}
+
+// Reopen calls the reopen API endpoint
+func (c HTTPClient) Reopen(id string, schedule Schedule) ([]byte, error) {
+	requestBody := reminderBody{
+		ID:       id,
+		Duration: schedule.Duration,
+		DueAt:    schedule.At,
+		TimeZone: schedule.TimeZone,
+	}
+	return c.apiCall(
+		http.MethodPost,
+		"/reminders/"+id+"/reopen",
+		&requestBody,
+		http.StatusOK,
+	)
+}
+
+// Export calls the export API endpoint and streams the export to w
+func (c HTTPClient) Export(format string, w io.Writer) error {
+	res, err := c.stream(
+		http.MethodGet,
+		"/export?format="+url.QueryEscape(format),
+		"",
+		nil,
+		http.StatusOK,
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return wrapError("could not write export", err)
+	}
+	return nil
+}
+
+// Import calls the import API endpoint, streaming the export from r
+func (c HTTPClient) Import(format, conflict string, r io.Reader) ([]byte, error) {
+	query := url.Values{}
+	query.Set("format", format)
+	query.Set("conflict", conflict)
+	res, err := c.stream(
+		http.MethodPost,
+		"/import?"+query.Encode(),
+		importContentTypes[format],
+		r,
+		http.StatusOK,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := c.readResBody(res.Body)
+	return []byte(resBody), err
+}
+
+// Event represents an event of the backend API event stream
+type Event struct {
+	ID   string
+	Type string
+	Data []byte
+}
+
+// Watch calls the events API endpoint and passes every event to handle, until the stream ends
+// with a lastEventID, the stream resumes after that event
+func (c HTTPClient) Watch(lastEventID string, handle func(Event) error) error {
+	req, err := http.NewRequest(http.MethodGet, c.BackendURI+"/events", nil)
+	if err != nil {
+		return wrapError("could not create request", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return wrapError("could not make http call", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		if resBody, err := c.readResBody(res.Body); err == nil && len(resBody) > 0 {
+			fmt.Printf("got this response body:\n%s\n", resBody)
+		}
+		return fmt.Errorf("expected response code: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var e Event
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// a blank line dispatches the event
+			if e.Type != "" || len(e.Data) > 0 {
+				if err := handle(e); err != nil {
+					return err
+				}
+			}
+			e = Event{}
+			continue
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Type = value
+		case "data":
+			if len(e.Data) > 0 {
+				e.Data = append(e.Data, '\n')
+			}
+			e.Data = append(e.Data, value...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return wrapError("could not read event stream", err)
+	}
+	return nil
+}
+
 // Healthy checks whether a given host is up and running
 func (c HTTPClient) Healthy(host string) bool {
-	res, err := http.Get(host + "/health")
-	if err != nil || res.StatusCode != http.StatusOK {
+	res, err := c.client.Get(host + "/health")
+	if err != nil {
 		return false
 	}
-	return true
+	defer res.Body.Close()
+	return res.StatusCode == http.StatusOK
 }
 
 // apiCall makes a new backend api call
@@ -109,7 +314,7 @@ func (c HTTPClient) apiCall(method, path string, body interface{}, resCode int)
 		return []byte{}, e
 	}
 
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		e := wrapError("could not make http call", err)
 		return []byte{}, e
@@ -133,6 +338,42 @@ func (c HTTPClient) apiCall(method, path string, body interface{}, resCode int)
 	return []byte(resBody), err
 }
 
+// stream makes a new backend api call with a raw request body
+// and retrieves the response, whose body must be closed, to be streamed
+func (c HTTPClient) stream(method, path, contentType string, body io.Reader, resCode int) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BackendURI+path, body)
+	if err != nil {
+		return nil, wrapError("could not create request", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, wrapError("could not make http call", err)
+	}
+	if res.StatusCode != resCode {
+		defer res.Body.Close()
+		if resBody, err := c.readResBody(res.Body); err == nil && len(resBody) > 0 {
+			fmt.Printf("got this response body:\n%s\n", resBody)
+		}
+		return nil, fmt.Errorf(
+			"expected response code: %d, got: %d",
+			resCode,
+			res.StatusCode,
+		)
+	}
+	return res, nil
+}
+
+// do sends a request with the API token
+func (c HTTPClient) do(req *http.Request) (*http.Response, error) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return c.client.Do(req)
+}
+
 // readBody reads response body
 func (c HTTPClient) readResBody(b io.Reader) (string, error) {
 	bs, err := ioutil.ReadAll(b)
@@ -1,13 +1,22 @@
 package client
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// watchRetry is how long watch waits before it reconnects to the event stream
+const watchRetry = 3 * time.Second
+
 // idsFlag represents []string values passed from CLI
 type idsFlag []string
 
@@ -22,22 +31,38 @@ func (list *idsFlag) Set(v string) error {
 
 // BackendHTTPClient represents the HTTP client for communicating with the Backend API
 type BackendHTTPClient interface {
-	Create(title, message string, duration time.Duration) ([]byte, error)
-	Edit(id string, title, message string, duration time.Duration) ([]byte, error)
+	Create(uid, title, message string, schedule Schedule) ([]byte, error)
+	Edit(id string, title, message string, schedule Schedule) ([]byte, error)
 	Fetch(ids []string) ([]byte, error)
+	List(query url.Values) ([]byte, error)
 	Delete(ids []string) error
+	Snooze(id string, duration time.Duration, until, tz string) ([]byte, error)
+	Complete(id string) ([]byte, error)
+	Reopen(id string, schedule Schedule) ([]byte, error)
+	Export(format string, w io.Writer) error
+	Import(format, conflict string, r io.Reader) ([]byte, error)
+	Watch(lastEventID string, handle func(Event) error) error
 	Healthy(host string) bool
 }
 
 // NewSwitch creates a new instance of command Switch
-func NewSwitch(uri string) Switch {
-	httpClient := NewHTTPClient(uri)
+// token is the API token, if the backend API requires one
+// transport sends the requests to the backend API (the default transport when nil)
+func NewSwitch(uri, token string, transport http.RoundTripper) Switch {
+	httpClient := NewHTTPClient(uri, token, transport)
 	s := Switch{client: httpClient, backendAPIURL: uri}
 	s.commands = map[string]func() func(string) error{
 		"create": s.create,
 		"edit":   s.edit,
 		"fetch":  s.fetch,
+		"list":   s.list,
 		"delete": s.delete,
+		"snooze": s.snooze,
+		"done":   s.done,
+		"reopen": s.reopen,
+		"export": s.export,
+		"import": s.importReminders,
+		"watch":  s.watch,
 		"health": s.health,
 	}
 	return s
@@ -74,6 +99,13 @@ func (s Switch) create() func(string) error {
 	return func(cmd string) error {
 		createCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
 		t, m, d := s.reminderFlags(createCmd)
+		at, tz := s.dueFlags(createCmd)
+		var uid, repeat, repeatUntil string
+		var repeatCount int
+		createCmd.StringVar(&uid, "uid", "", "Client generated UUID of the reminder (optional, must be unique)")
+		createCmd.StringVar(&repeat, "repeat", "", "Recurrence rule: RRULE (e.g. 'FREQ=WEEKLY;BYDAY=MO') or cron (e.g. '0 9 * * 1-5')")
+		createCmd.StringVar(&repeatUntil, "repeat-until", "", "Time after which the reminder no longer repeats")
+		createCmd.IntVar(&repeatCount, "repeat-count", 0, "Number of occurrences after which the reminder no longer repeats")
 
 		if err := s.checkArgs(3); err != nil {
 			return err
@@ -82,7 +114,14 @@ func (s Switch) create() func(string) error {
 			return err
 		}
 
-		res, err := s.client.Create(*t, *m, *d)
+		res, err := s.client.Create(uid, *t, *m, Schedule{
+			Duration:    *d,
+			At:          *at,
+			TimeZone:    *tz,
+			Repeat:      repeat,
+			RepeatUntil: repeatUntil,
+			RepeatCount: repeatCount,
+		})
 		if err != nil {
 			return wrapError("could not create reminder", err)
 		}
@@ -98,6 +137,7 @@ func (s Switch) edit() func(string) error {
 		editCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
 		editCmd.Var(&ids, "id", "The ID (int) of the reminder to edit")
 		t, m, d := s.reminderFlags(editCmd)
+		at, tz := s.dueFlags(editCmd)
 
 		if err := s.checkArgs(2); err != nil {
 			return err
@@ -107,7 +147,11 @@ func (s Switch) edit() func(string) error {
 		}
 
 		lastID := ids[len(ids)-1]
-		res, err := s.client.Edit(lastID, *t, *m, *d)
+		res, err := s.client.Edit(lastID, *t, *m, Schedule{
+			Duration: *d,
+			At:       *at,
+			TimeZone: *tz,
+		})
 		if err != nil {
 			return wrapError("could not edit reminder", err)
 		}
@@ -139,6 +183,58 @@ func (s Switch) fetch() func(string) error {
 	}
 }
 
+// list represents the list command which lists, filters and paginates reminders
+func (s Switch) list() func(string) error {
+	return func(cmd string) error {
+		var owner, status, title, dueBefore, dueAfter, sortBy, order, cursor string
+		var limit int
+		listCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		listCmd.StringVar(&owner, "owner", "", "User whose reminders to list (admin tokens only)")
+		listCmd.StringVar(&status, "status", "", "Reminder status to filter by: pending, notifying, snoozed, completed, cancelled")
+		listCmd.StringVar(&title, "title", "", "Substring the reminder title must contain")
+		listCmd.StringVar(&dueBefore, "due-before", "", "Only reminders due before this RFC 3339 time")
+		listCmd.StringVar(&dueAfter, "due-after", "", "Only reminders due after this RFC 3339 time")
+		listCmd.StringVar(&sortBy, "sort", "", "Field to sort by: id, created_at, due")
+		listCmd.StringVar(&order, "order", "", "Sorting order: asc, desc")
+		listCmd.StringVar(&cursor, "cursor", "", "Cursor of the page to fetch (next_cursor of the previous page)")
+		listCmd.IntVar(&limit, "limit", 0, "Maximum number of reminders per page")
+
+		if err := s.checkArgs(0); err != nil {
+			return err
+		}
+		if err := s.parseCmd(listCmd); err != nil {
+			return err
+		}
+
+		query := url.Values{}
+		params := map[string]string{
+			"owner":      owner,
+			"status":     status,
+			"title":      title,
+			"due_before": dueBefore,
+			"due_after":  dueAfter,
+			"sort":       sortBy,
+			"order":      order,
+			"cursor":     cursor,
+		}
+		for name, v := range params {
+			if v != "" {
+				query.Set(name, v)
+			}
+		}
+		if limit != 0 {
+			query.Set("limit", strconv.Itoa(limit))
+		}
+
+		res, err := s.client.List(query)
+		if err != nil {
+			return wrapError("could not list reminders", err)
+		}
+		fmt.Printf("reminders listed successfully:\n%s", string(res))
+		return nil
+	}
+}
+
 // delete represents the delete command which deletes a reminder
 func (s Switch) delete() func(string) error {
 	return func(cmd string) error {
@@ -162,6 +258,246 @@ func (s Switch) delete() func(string) error {
 	}
 }
 
+// snooze represents the snooze command which postpones a pending reminder
+func (s Switch) snooze() func(string) error {
+	return func(cmd string) error {
+		ids := idsFlag{}
+		var d time.Duration
+		var until string
+		snoozeCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		snoozeCmd.Var(&ids, "id", "The ID (int) of the reminder to snooze")
+		snoozeCmd.DurationVar(&d, "duration", 0, "Snooze time")
+		snoozeCmd.DurationVar(&d, "d", 0, "Snooze time")
+		snoozeCmd.StringVar(&until, "until", "", "Snooze until: RFC 3339, 'YYYY-MM-DD HH:MM' or 'HH:MM'")
+		_, tz := s.dueFlags(snoozeCmd)
+
+		if err := s.checkArgs(2); err != nil {
+			return err
+		}
+		if err := s.parseCmd(snoozeCmd); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("%s expects an --id", cmd)
+		}
+
+		res, err := s.client.Snooze(ids[len(ids)-1], d, until, *tz)
+		if err != nil {
+			return wrapError("could not snooze reminder", err)
+		}
+		fmt.Printf("reminder snoozed successfully:\n%s", string(res))
+		return nil
+	}
+}
+
+// done represents the done command which completes a pending reminder
+func (s Switch) done() func(string) error {
+	return func(cmd string) error {
+		ids := idsFlag{}
+		doneCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		doneCmd.Var(&ids, "id", "The ID (int) of the reminder to complete")
+
+		if err := s.checkArgs(1); err != nil {
+			return err
+		}
+		if err := s.parseCmd(doneCmd); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("%s expects an --id", cmd)
+		}
+
+		res, err := s.client.Complete(ids[len(ids)-1])
+		if err != nil {
+			return wrapError("could not complete reminder", err)
+		}
+		fmt.Printf("reminder completed successfully:\n%s", string(res))
+		return nil
+	}
+}
+
+// reopen represents the reopen command which moves a completed reminder back to pending
+func (s Switch) reopen() func(string) error {
+	return func(cmd string) error {
+		ids := idsFlag{}
+		var d time.Duration
+		reopenCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		reopenCmd.Var(&ids, "id", "The ID (int) of the reminder to reopen")
+		reopenCmd.DurationVar(&d, "duration", 0, "Reminder time")
+		reopenCmd.DurationVar(&d, "d", 0, "Reminder time")
+		at, tz := s.dueFlags(reopenCmd)
+
+		if err := s.checkArgs(1); err != nil {
+			return err
+		}
+		if err := s.parseCmd(reopenCmd); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("%s expects an --id", cmd)
+		}
+
+		res, err := s.client.Reopen(ids[len(ids)-1], Schedule{
+			Duration: d,
+			At:       *at,
+			TimeZone: *tz,
+		})
+		if err != nil {
+			return wrapError("could not reopen reminder", err)
+		}
+		fmt.Printf("reminder reopened successfully:\n%s", string(res))
+		return nil
+	}
+}
+
+// export represents the export command which exports all the reminders
+// to a file or to the standard output
+func (s Switch) export() func(string) error {
+	return func(cmd string) error {
+		var format, out string
+		exportCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		exportCmd.StringVar(&format, "format", "", "Export format: json, csv, ics (defaults to the --out extension, else json)")
+		exportCmd.StringVar(&out, "out", "-", "File to export to, - for the standard output")
+		exportCmd.StringVar(&out, "o", "-", "File to export to, - for the standard output")
+
+		if err := s.checkArgs(0); err != nil {
+			return err
+		}
+		if err := s.parseCmd(exportCmd); err != nil {
+			return err
+		}
+		if format == "" {
+			format = formatOf(out)
+		}
+
+		if out == "-" {
+			if err := s.client.Export(format, os.Stdout); err != nil {
+				return wrapError("could not export reminders", err)
+			}
+			return nil
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return wrapError("could not create export file", err)
+		}
+		if err := s.client.Export(format, f); err != nil {
+			_ = f.Close()
+			return wrapError("could not export reminders", err)
+		}
+		if err := f.Close(); err != nil {
+			return wrapError("could not write export file", err)
+		}
+		fmt.Printf("reminders exported successfully to: %s\n", out)
+		return nil
+	}
+}
+
+// importReminders represents the import command which imports reminders
+// from a file or from the standard input
+func (s Switch) importReminders() func(string) error {
+	return func(cmd string) error {
+		var format, in, conflict string
+		importCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		importCmd.StringVar(&format, "format", "", "Import format: json, csv, ics (defaults to the --in extension, else json)")
+		importCmd.StringVar(&in, "in", "-", "File to import from, - for the standard input")
+		importCmd.StringVar(&in, "i", "-", "File to import from, - for the standard input")
+		importCmd.StringVar(&conflict, "conflict", "skip", "What to do with reminders which already exist: skip, overwrite, renumber")
+
+		if err := s.checkArgs(0); err != nil {
+			return err
+		}
+		if err := s.parseCmd(importCmd); err != nil {
+			return err
+		}
+		if format == "" {
+			format = formatOf(in)
+		}
+
+		var r io.Reader = os.Stdin
+		if in != "-" {
+			f, err := os.Open(in)
+			if err != nil {
+				return wrapError("could not open import file", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		res, err := s.client.Import(format, conflict, r)
+		if err != nil {
+			return wrapError("could not import reminders", err)
+		}
+		fmt.Printf("reminders imported successfully:\n%s", string(res))
+		return nil
+	}
+}
+
+// watch represents the watch command which tails the reminder events
+// it reconnects when the stream ends, resuming after the last received event
+func (s Switch) watch() func(string) error {
+	return func(cmd string) error {
+		var since string
+		var raw bool
+		watchCmd := flag.NewFlagSet(cmd, flag.ExitOnError)
+		watchCmd.StringVar(&since, "since", "", "Resume after the event with this id")
+		watchCmd.BoolVar(&raw, "json", false, "Print the events as json lines")
+
+		if err := s.checkArgs(0); err != nil {
+			return err
+		}
+		if err := s.parseCmd(watchCmd); err != nil {
+			return err
+		}
+
+		lastID := since
+		handle := func(e Event) error {
+			if e.ID != "" {
+				lastID = e.ID
+			}
+			if raw {
+				fmt.Println(string(e.Data))
+				return nil
+			}
+			fmt.Println(formatEvent(e))
+			return nil
+		}
+		for {
+			err := s.client.Watch(lastID, handle)
+			if err != nil {
+				fmt.Printf("event stream error: %v\n", err)
+			}
+			time.Sleep(watchRetry)
+		}
+	}
+}
+
+// formatEvent formats an event as a single line
+func formatEvent(e Event) string {
+	var event struct {
+		At       time.Time `json:"at"`
+		Reminder struct {
+			ID     int       `json:"id"`
+			Title  string    `json:"title"`
+			Status string    `json:"status"`
+			DueAt  time.Time `json:"due_at"`
+		} `json:"reminder"`
+	}
+	if e.Type == "reset" {
+		return "-- events were missed, fetch the reminders again"
+	}
+	if err := json.Unmarshal(e.Data, &event); err != nil {
+		return fmt.Sprintf("%s %s", e.Type, e.Data)
+	}
+	r := event.Reminder
+	line := fmt.Sprintf(
+		"%s %-9s #%d %q %s",
+		event.At.Local().Format("2006-01-02 15:04:05"), e.Type, r.ID, r.Title, r.Status,
+	)
+	if !r.DueAt.IsZero() && e.Type != "deleted" {
+		line += ", due " + r.DueAt.Local().Format("2006-01-02 15:04:05")
+	}
+	return line
+}
+
 // health represents the health command which prints whether a host is healthy or not
 func (s Switch) health() func(string) error {
 	return func(cmd string) error {
@@ -192,6 +528,24 @@ func (s Switch) reminderFlags(f *flag.FlagSet) (*string, *string, *time.Duration
 	return &t, &m, &d
 }
 
+// dueFlags configures absolute due time specific flags for a command
+func (s Switch) dueFlags(f *flag.FlagSet) (*string, *string) {
+	at, tz := "", ""
+	f.StringVar(&at, "at", "", "Reminder absolute time: RFC 3339, 'YYYY-MM-DD HH:MM' or 'HH:MM'")
+	f.StringVar(&tz, "tz", "", "IANA time zone of --at, e.g. Europe/Berlin (server local by default)")
+	return &at, &tz
+}
+
+// formatOf retrieves the export format matching the extension of a file
+func formatOf(path string) string {
+	switch ext := strings.TrimPrefix(filepath.Ext(path), "."); ext {
+	case "csv", "ics":
+		return ext
+	default:
+		return "json"
+	}
+}
+
 // parseCmd parses sub-command flags
 func (s Switch) parseCmd(cmd *flag.FlagSet) error {
 	err := cmd.Parse(os.Args[2:])
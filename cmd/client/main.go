@@ -5,24 +5,46 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/gophertuts/reminders-cli/certs"
 	"github.com/gophertuts/reminders-cli/client"
 )
 
 var (
 	backendURIFlag = flag.String("backend", "http://localhost:8080", "Backend API URI")
+	tokenFlag      = flag.String("token", "", "API token (defaults to $"+client.TokenEnv+", else the config file token)")
+	configFlag     = flag.String("config", client.DefaultConfigPath(), "Path to the config file")
+	caFlag         = flag.String("ca", "", "Path to the PEM authorities which sign the backend certificate (defaults to the config file ca, else the system ones)")
+	certFlag       = flag.String("cert", "", "Path to the PEM client certificate, for backends which require one (defaults to the config file cert)")
+	keyFlag        = flag.String("key", "", "Path to the PEM private key of --cert (defaults to the config file key)")
 	helpFlag       = flag.Bool("help", false, "Display a helpful message")
 )
 
 func main() {
 	flag.Parse()
-	s := client.NewSwitch(*backendURIFlag)
+	// the commands parse their own args, which follow the global flags
+	os.Args = append(os.Args[:1], flag.Args()...)
+	token, err := client.ResolveToken(*tokenFlag, *configFlag)
+	if err != nil {
+		fmt.Printf("invalid config: %v\n", err)
+		os.Exit(2)
+	}
+	transport, err := client.ResolveTransport(certs.ClientOptions{
+		CAPath:   *caFlag,
+		CertPath: *certFlag,
+		KeyPath:  *keyFlag,
+	}, *configFlag)
+	if err != nil {
+		fmt.Printf("invalid config: %v\n", err)
+		os.Exit(2)
+	}
+	s := client.NewSwitch(*backendURIFlag, token, transport)
 
 	if *helpFlag || len(os.Args) == 1 {
 		s.Help()
 		return
 	}
 
-	err := s.Switch()
+	err = s.Switch()
 	if err != nil {
 		fmt.Printf("cmd switch error: %v\n", err)
 		os.Exit(2)
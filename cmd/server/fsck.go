@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gophertuts/reminders-cli/server/repositories"
+)
+
+// fsck runs the fsck subcommand, which checks (and repairs) a json file DB
+// it retrieves the process exit code: 0 when the db is fine or was repaired,
+// 1 when problems were found and 2 when the db could not be checked
+func fsck(args []string) int {
+	cmd := flag.NewFlagSet("fsck", flag.ExitOnError)
+	db := cmd.String("db", "db.json", "Path to db.json file")
+	dbCfg := cmd.String("db-cfg", ".db.config.json", "Path to .db.config.json file")
+	repair := cmd.Bool("repair", false, "Rewrite a repaired db file, keeping the original one as a backup")
+	_ = cmd.Parse(args)
+
+	report, err := repositories.Fsck(*db, *dbCfg, *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not check %s: %v\n", *db, err)
+		return 2
+	}
+	fmt.Printf("%s: schema version %d, %d record(s), %d pending journal entries\n",
+		*db, report.SchemaVersion, report.Records, report.Pending)
+	for _, step := range report.Migrations {
+		fmt.Printf("- needs migration to schema version %d: %s\n", step.Version, step.Description)
+	}
+	for _, problem := range report.Problems {
+		fmt.Printf("- %s\n", problem)
+	}
+	switch {
+	case report.Repaired:
+		fmt.Printf("repaired: %d reminder(s) kept", report.Kept)
+		if report.Backup != "" {
+			fmt.Printf(", original saved to %s", report.Backup)
+		}
+		fmt.Println()
+	case len(report.Problems) == 0:
+		fmt.Println("no problems found")
+	default:
+		fmt.Println("run with --repair to fix them")
+		return 1
+	}
+	return 0
+}
@@ -1,34 +1,121 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/gophertuts/reminders-cli/certs"
 	"github.com/gophertuts/reminders-cli/server"
+	"github.com/gophertuts/reminders-cli/server/auth"
+	"github.com/gophertuts/reminders-cli/server/controllers"
 	"github.com/gophertuts/reminders-cli/server/repositories"
 	"github.com/gophertuts/reminders-cli/server/services"
 )
 
 var (
-	addrFlag        = flag.String("addr", ":8080", "HTTP server address")
-	notifierURIFlag = flag.String("notifier", "http://localhost:9000", "Notifier API URI")
-	dbFlag          = flag.String("db", "db.json", "Path to db.json file")
-	dbCfgFlag       = flag.String("db-cfg", ".db.config.json", "Path to .db.config.json file")
+	addrFlag          = flag.String("addr", ":8080", "HTTP server address")
+	notifierURIFlag   = flag.String("notifier", "http://localhost:9000", "Notifier API URI")
+	userNotifiersFlag = flag.String("user-notifiers", "", "Path to a json file mapping users to the URI of their own notifier, e.g. {\"alice\": \"http://10.0.0.7:9000\"}")
+	dbDriverFlag      = flag.String("db-driver", "json", "Storage driver: "+strings.Join(repositories.Drivers(), ", "))
+	dbFlag            = flag.String("db", "", "Path to the db file (defaults to db.json for json, db.kv for kv)")
+	dbCfgFlag         = flag.String("db-cfg", ".db.config.json", "Path to .db.config.json file (json driver)")
+	integrityFlag     = flag.String("integrity", repositories.IntegrityRefuse, "What to do if db.json fails its checksum (json driver): refuse, warn, quarantine")
+	missedFlag        = flag.String("missed-policy", services.MissedDeliver, "How reminders which came due while the server was down are handled: deliver, digest, drop")
+	missedAgeFlag     = flag.Duration("missed-max-age", 0, "Reminders missed by more than this are dropped (0 means no limit)")
+	idModeFlag        = flag.String("id-mode", services.IDModeInt, "Reminder ids: int, uuidv7 (also gives every reminder a uid)")
+	saveIntervalFlag  = flag.Duration("save-interval", 30*time.Second, "Longest time a change waits before the snapshot is saved")
+	saveDebounceFlag  = flag.Duration("save-debounce", time.Second, "The snapshot is saved once no other change happened for this long")
+	waitForLockFlag   = flag.Bool("wait-for-lock", false, "Wait as a standby until the server holding the db lock exits, instead of failing")
+	tokensFlag        = flag.String("tokens", defaultTokenFile, "Path to the API token file, API tokens are required once it exists (it must exist when the flag is set)")
+	noAuthFlag        = flag.Bool("no-auth", false, "Serve the API without authentication until the token file exists, every request is an admin of the default user")
+	tlsCertFlag       = flag.String("tls-cert", "", "Path to the PEM certificate of the server, the API is served over HTTPS when set")
+	tlsKeyFlag        = flag.String("tls-key", "", "Path to the PEM private key of --tls-cert")
+	clientCAFlag      = flag.String("client-ca", "", "Path to the PEM authorities which sign the client certificates, clients must present one when set (requires --tls-cert)")
+	notifierCAFlag    = flag.String("notifier-ca", "", "Path to the PEM authorities which sign the certificates of the https notifiers (defaults to the system ones)")
+	notifierCertFlag  = flag.String("notifier-cert", "", "Path to the PEM client certificate presented to the notifiers")
+	notifierKeyFlag   = flag.String("notifier-key", "", "Path to the PEM private key of --notifier-cert")
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fsck":
+			os.Exit(fsck(os.Args[2:]))
+		case "migrate":
+			os.Exit(migrate(os.Args[2:]))
+		case "token":
+			os.Exit(token(os.Args[2:]))
+		}
+	}
 	flag.Parse()
-	db := repositories.NewDB(*dbFlag, *dbCfgFlag)
+	missed := services.MissedPolicy{Action: *missedFlag, MaxAge: *missedAgeFlag}
+	if err := missed.Validate(); err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	if err := services.ValidateIDMode(*idModeFlag); err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	save := services.SavePolicy{Interval: *saveIntervalFlag, Debounce: *saveDebounceFlag}
+	if err := save.Validate(); err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	if err := repositories.ValidateIntegrity(*integrityFlag); err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	db, err := repositories.Open(*dbDriverFlag, repositories.Options{
+		Path:        *dbFlag,
+		CfgPath:     *dbCfgFlag,
+		Integrity:   *integrityFlag,
+		WaitForLock: *waitForLockFlag,
+	})
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	keyring, err := auth.NewKeyring(*tokensFlag)
+	if err != nil {
+		log.Fatalf("could not load token file: %v", err)
+	}
+	if !keyring.Enabled() {
+		if flagSet("tokens") {
+			log.Fatalf("invalid flags: token file %s does not exist, create a token with '%s token create --tokens=%s'", *tokensFlag, os.Args[0], *tokensFlag)
+		}
+		if !*noAuthFlag {
+			log.Fatalf("invalid flags: token file %s does not exist, create a token with '%s token create' or start with --no-auth to serve the API without authentication", *tokensFlag, os.Args[0])
+		}
+		log.Printf("warning: the API is served without authentication until %s exists, create a token with '%s token create'", *tokensFlag, os.Args[0])
+	}
+	userNotifiers, err := loadUserNotifiers(*userNotifiersFlag)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	tlsConfig, err := serverTLS(*tlsCertFlag, *tlsKeyFlag, *clientCAFlag)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	notifierTransport, err := notifierTLS(*notifierCAFlag, *notifierCertFlag, *notifierKeyFlag)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
 	repo := repositories.NewReminders(db)
-	service := services.NewReminders(repo)
-	backend := server.New(*addrFlag, service)
-	saver := services.NewSaver(service)
-	notifier := services.NewNotifier(*notifierURIFlag, service)
+	service := services.NewReminders(repo, missed, *idModeFlag)
+	backend := server.New(*addrFlag, tlsConfig, service, controllers.RouterConfig{
+		Keyring: keyring,
+	})
+	saver := services.NewSaver(service, save)
+	notifier := services.NewNotifier(*notifierURIFlag, userNotifiers, notifierTransport, service)
 
 	if err := db.Start(); err != nil {
-		log.Fatalf("could not start file database service: %v", err)
+		log.Fatalf("could not start database service: %v", err)
 	}
 
 	go saver.Start()
@@ -42,3 +129,79 @@ func main() {
 	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
 	server.ListenForSignals(signals, backend, saver, notifier, db)
 }
+
+// flagSet checks whether a flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// splitList splits a comma separated flag value, dropping the empty items
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadUserNotifiers reads the notifier URIs of the users, no file means no user has their own notifier
+func loadUserNotifiers(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read user notifiers: %v", err)
+	}
+	var uris map[string]string
+	if err := json.Unmarshal(bs, &uris); err != nil {
+		return nil, fmt.Errorf("could not decode user notifiers: %v", err)
+	}
+	for user, uri := range uris {
+		if u, err := url.Parse(uri); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid notifier URI of user %s: %s", user, uri)
+		}
+	}
+	return uris, nil
+}
+
+// serverTLS creates the TLS config of the backend API, nil means it is served over plain HTTP
+func serverTLS(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" {
+		if clientCAPath != "" {
+			return nil, fmt.Errorf("--client-ca requires --tls-cert & --tls-key")
+		}
+		return nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("--tls-cert & --tls-key must be set together")
+	}
+	cfg, err := certs.ServerConfig(certPath, keyPath, clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificates: %v", err)
+	}
+	return cfg, nil
+}
+
+// notifierTLS creates the transport of the notifier clients, nil means the default one
+func notifierTLS(caPath, certPath, keyPath string) (http.RoundTripper, error) {
+	if (certPath == "") != (keyPath == "") {
+		return nil, fmt.Errorf("--notifier-cert & --notifier-key must be set together")
+	}
+	if caPath == "" && certPath == "" {
+		return nil, nil
+	}
+	transport, err := certs.NewTransport(certs.ClientOptions{CAPath: caPath, CertPath: certPath, KeyPath: keyPath})
+	if err != nil {
+		return nil, fmt.Errorf("could not load notifier certificates: %v", err)
+	}
+	return transport, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gophertuts/reminders-cli/server/repositories"
+)
+
+// migrate runs the migrate subcommand, which upgrades a json file DB to the current schema
+// the same migrations also run when the server starts, this lets them be previewed first
+func migrate(args []string) int {
+	cmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	db := cmd.String("db", "db.json", "Path to db.json file")
+	dbCfg := cmd.String("db-cfg", ".db.config.json", "Path to .db.config.json file")
+	dryRun := cmd.Bool("dry-run", false, "Only show the planned changes")
+	_ = cmd.Parse(args)
+
+	from, steps, err := repositories.PlanMigrations(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not plan migrations of %s: %v\n", *db, err)
+		return 2
+	}
+	if len(steps) == 0 {
+		fmt.Printf("%s is up to date (schema version %d)\n", *db, from)
+		return 0
+	}
+	fmt.Printf("%s: schema version %d -> %d\n", *db, from, repositories.SchemaVersion)
+	for _, step := range steps {
+		fmt.Printf("v%d: %s\n", step.Version, step.Description)
+		for _, change := range step.Changes {
+			fmt.Printf("  - %s\n", change)
+		}
+	}
+	if *dryRun {
+		return 0
+	}
+
+	store, err := repositories.Open("json", repositories.Options{
+		Path:      *db,
+		CfgPath:   *dbCfg,
+		Integrity: repositories.IntegrityRefuse,
+	})
+	if err == nil {
+		err = store.Start()
+	}
+	if err == nil {
+		err = store.Stop()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not migrate %s: %v\n", *db, err)
+		return 2
+	}
+	fmt.Printf("migrated, the original file is kept as %s.v%d.bak\n", *db, from)
+	return 0
+}
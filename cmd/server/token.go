@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gophertuts/reminders-cli/server/auth"
+)
+
+// defaultTokenFile is the default path of the API token file
+const defaultTokenFile = ".tokens.json"
+
+// token runs the token subcommand, which creates, revokes & lists the API tokens
+// it retrieves the process exit code
+// the running server picks up the changes of the token file right away
+func token(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: token create|revoke|list [flags], see token <command> --help")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	cmd := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	path := cmd.String("tokens", defaultTokenFile, "Path to the API token file")
+	switch args[0] {
+	case "create":
+		name := cmd.String("name", "", "Token name, e.g. the machine it is for")
+		user := cmd.String("user", "", "User who owns the reminders created with the token (defaults to the token name)")
+		scopes := cmd.String("scopes", auth.ScopeRead+","+auth.ScopeWrite, "Comma separated token scopes: calendar, read, write, admin")
+		_ = cmd.Parse(args[1:])
+		t, secret, err := auth.CreateToken(*path, *name, *user, splitList(*scopes))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create token: %v\n", err)
+			return 1
+		}
+		fmt.Printf("created token %s (%s) of user %s with scopes: %s\n", t.ID, t.Name, t.Owner(), strings.Join(t.Scopes, ","))
+		fmt.Println("this is the only time the token is shown, store it safely:")
+		fmt.Println(secret)
+	case "revoke":
+		id := cmd.String("id", "", "Id or name of the token to revoke")
+		_ = cmd.Parse(args[1:])
+		t, err := auth.RevokeToken(*path, *id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not revoke token: %v\n", err)
+			return 1
+		}
+		fmt.Printf("revoked token %s (%s)\n", t.ID, t.Name)
+	case "list":
+		_ = cmd.Parse(args[1:])
+		tokens, err := auth.LoadTokens(*path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "could not list tokens: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tUSER\tSCOPES\tCREATED")
+		for _, t := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Owner(), strings.Join(t.Scopes, ","), t.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		_ = w.Flush()
+	default:
+		return usage()
+	}
+	return 0
+}
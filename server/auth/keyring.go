@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ctxKey represents the context key of the authenticated token
+type ctxKey struct{}
+
+// keyringRecheckPeriod is how often the token file is checked for changes
+const keyringRecheckPeriod = time.Second
+
+// Keyring represents the tokens of a token file, which authenticate the API requests
+// the token file is checked for changes every keyringRecheckPeriod, so created & revoked tokens apply shortly after
+// authentication is disabled until the token file exists, it can be created while the server runs
+// once enabled it stays so, a removed or broken token file rejects every token
+type Keyring struct {
+	path      string
+	recheck   time.Duration
+	enabled   bool
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+	modTime   time.Time
+	size      int64
+	tokens    map[string]Token
+}
+
+// NewKeyring creates a new instance of Keyring
+func NewKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path, recheck: keyringRecheckPeriod}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return k, nil
+	}
+	k.enabled = true
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	k.checkedAt = time.Now()
+	return k, nil
+}
+
+// Enabled checks whether the requests have to be authenticated
+// it enables the keyring once the token file exists
+func (k *Keyring) Enabled() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh()
+	return k.enabled
+}
+
+// Authenticate retrieves the token of a secret
+// false is retrieved for unknown & revoked tokens, or when the token file can no longer be read
+func (k *Keyring) Authenticate(secret string) (Token, bool) {
+	id, key, ok := parseSecret(secret)
+	if !ok {
+		return Token{}, false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh()
+	if k.err != nil {
+		return Token{}, false
+	}
+	token, ok := k.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(hash(key)), []byte(token.Hash)) != 1 {
+		return Token{}, false
+	}
+	return token, true
+}
+
+// refresh checks the token file, unless it was checked less than recheck ago
+// so the requests do not all stat the file
+// the caller must hold the lock
+func (k *Keyring) refresh() {
+	now := time.Now()
+	if !k.checkedAt.IsZero() && now.Sub(k.checkedAt) < k.recheck {
+		return
+	}
+	k.checkedAt = now
+	if !k.enabled {
+		if _, err := os.Stat(k.path); err != nil {
+			return
+		}
+		k.enabled = true
+	}
+	if k.err = k.reload(); k.err != nil {
+		log.Printf("could not reload token file: %v", k.err)
+	}
+}
+
+// reload reads the token file again, when it changed since it was last read
+// the caller must hold the lock
+func (k *Keyring) reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		k.tokens = nil
+		return err
+	}
+	if k.tokens != nil && info.ModTime().Equal(k.modTime) && info.Size() == k.size {
+		return nil
+	}
+	tokens, err := LoadTokens(k.path)
+	if err != nil {
+		k.tokens = nil
+		return err
+	}
+	k.tokens = make(map[string]Token, len(tokens))
+	for _, t := range tokens {
+		k.tokens[t.ID] = t
+	}
+	k.modTime, k.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// WithToken stores the authenticated token in a context
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, ctxKey{}, token)
+}
+
+// FromContext retrieves the authenticated token of a request context
+// false is retrieved when authentication is disabled
+func FromContext(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(ctxKey{}).(Token)
+	return token, ok
+}
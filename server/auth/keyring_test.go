@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// tempTokenFile retrieves the path of a token file in a temporary directory
+func tempTokenFile(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "tokens.json")
+}
+
+// TestKeyringEnablesOnceTheTokenFileExists creates the token file after the keyring,
+// the way 'token create' does while the server runs
+func TestKeyringEnablesOnceTheTokenFileExists(t *testing.T) {
+	path := tempTokenFile(t)
+
+	k, err := NewKeyring(path)
+	if err != nil {
+		t.Fatalf("could not create keyring: %v", err)
+	}
+	// the token file is checked on every call
+	k.recheck = 0
+	if k.Enabled() {
+		t.Fatal("expected the keyring to be disabled without a token file")
+	}
+
+	token, secret, err := CreateToken(path, "laptop", "", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("could not create token: %v", err)
+	}
+	if !k.Enabled() {
+		t.Fatal("expected the keyring to be enabled once the token file exists")
+	}
+	got, ok := k.Authenticate(secret)
+	if !ok || got.ID != token.ID {
+		t.Fatalf("expected token %s to authenticate, got %+v, %v", token.ID, got, ok)
+	}
+	if _, ok := k.Authenticate(secret + "x"); ok {
+		t.Error("expected a wrong secret to be rejected")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("could not remove token file: %v", err)
+	}
+	if !k.Enabled() {
+		t.Error("expected the keyring to stay enabled once the token file is removed")
+	}
+	if _, ok := k.Authenticate(secret); ok {
+		t.Error("expected the token to be rejected once the token file is removed")
+	}
+}
+
+// TestKeyringRechecksOnAnInterval checks that the token file is not checked on every request
+func TestKeyringRechecksOnAnInterval(t *testing.T) {
+	path := tempTokenFile(t)
+	k, err := NewKeyring(path)
+	if err != nil {
+		t.Fatalf("could not create keyring: %v", err)
+	}
+	k.recheck = time.Hour
+	if k.Enabled() {
+		t.Fatal("expected the keyring to be disabled without a token file")
+	}
+	token, secret, err := CreateToken(path, "laptop", "", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("could not create token: %v", err)
+	}
+	if k.Enabled() {
+		t.Error("expected the token file to not be checked again before the interval")
+	}
+
+	k.checkedAt = time.Now().Add(-time.Hour)
+	if !k.Enabled() {
+		t.Fatal("expected the keyring to be enabled once the interval passed")
+	}
+	if _, err := RevokeToken(path, token.ID); err != nil {
+		t.Fatalf("could not revoke token: %v", err)
+	}
+	if _, ok := k.Authenticate(secret); !ok {
+		t.Error("expected the revoked token to be accepted until the interval passed")
+	}
+	k.checkedAt = time.Now().Add(-time.Hour)
+	if _, ok := k.Authenticate(secret); ok {
+		t.Error("expected the revoked token to be rejected once the interval passed")
+	}
+}
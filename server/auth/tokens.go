@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// token scopes, every scope includes the ones before it
+const (
+	// ScopeCalendar allows reading the calendar feed of the user, e.g. from a calendar app
+	ScopeCalendar = "calendar"
+	// ScopeRead allows reading the reminders
+	ScopeRead = "read"
+	// ScopeWrite allows creating, changing & deleting the reminders
+	ScopeWrite = "write"
+	// ScopeAdmin allows everything
+	ScopeAdmin = "admin"
+)
+
+// tokenPrefix marks the secrets of the API tokens, so they are easy to recognize (e.g. by secret scanners)
+const tokenPrefix = "rmd"
+
+// scopeLevels orders the scopes
+var scopeLevels = map[string]int{
+	ScopeCalendar: 1,
+	ScopeRead:     2,
+	ScopeWrite:    3,
+	ScopeAdmin:    4,
+}
+
+// Token represents an API token, the token file only stores the hash of its secret
+// a user can have several tokens, e.g. one per machine
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	User      string    `json:"user,omitempty"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Owner retrieves the user of the token, which is named after the token unless it is set
+func (t Token) Owner() string {
+	if t.User != "" {
+		return t.User
+	}
+	return t.Name
+}
+
+// Allows checks whether the token has the given scope
+func (t Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if scopeLevels[s] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenFile represents the token file contents
+type tokenFile struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// ValidateScopes checks whether the token scopes are known ones
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return models.DataValidationError{Message: "at least one scope is required: calendar, read, write, admin"}
+	}
+	for _, s := range scopes {
+		if _, ok := scopeLevels[s]; !ok {
+			return models.DataValidationError{
+				Message: fmt.Sprintf("invalid scope '%s', expected one of: calendar, read, write, admin", s),
+			}
+		}
+	}
+	return nil
+}
+
+// LoadTokens reads the tokens of a token file, ordered by creation
+func LoadTokens(path string) ([]Token, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f tokenFile
+	if err := json.Unmarshal(bs, &f); err != nil {
+		return nil, models.WrapError("could not decode token file", err)
+	}
+	return f.Tokens, nil
+}
+
+// CreateToken adds a new token of a user to a token file, creating the file if it does not exist
+// the user is named after the token when it is empty
+// the secret is only retrieved here, it cannot be recovered afterwards
+func CreateToken(path, name, user string, scopes []string) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Token{}, "", models.DataValidationError{Message: "token name cannot be empty"}
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return Token{}, "", err
+	}
+	tokens, err := LoadTokens(path)
+	if err != nil && !os.IsNotExist(err) {
+		return Token{}, "", err
+	}
+	for _, t := range tokens {
+		if t.Name == name {
+			return Token{}, "", models.ConflictError{
+				Message: fmt.Sprintf("token with name: %s already exists with id: %s", name, t.ID),
+			}
+		}
+	}
+	// the id is hex, so it never contains the separator of the secret
+	id, err := random(6, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	key, err := random(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	scopes = append([]string(nil), scopes...)
+	sort.Slice(scopes, func(i, j int) bool { return scopeLevels[scopes[i]] < scopeLevels[scopes[j]] })
+	token := Token{
+		ID:        id,
+		Name:      name,
+		User:      strings.TrimSpace(user),
+		Hash:      hash(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := writeTokens(path, append(tokens, token)); err != nil {
+		return Token{}, "", err
+	}
+	return token, tokenPrefix + "_" + id + "_" + key, nil
+}
+
+// RevokeToken removes the token with the given id or name from a token file
+func RevokeToken(path, idOrName string) (Token, error) {
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		return Token{}, err
+	}
+	for i, t := range tokens {
+		if t.ID == idOrName || t.Name == idOrName {
+			tokens = append(tokens[:i:i], tokens[i+1:]...)
+			return t, writeTokens(path, tokens)
+		}
+	}
+	return Token{}, models.NotFoundError{
+		Message: fmt.Sprintf("could not find token with id or name: %s", idOrName),
+	}
+}
+
+// parseSecret splits a token secret into its id & key
+func parseSecret(secret string) (string, string, bool) {
+	parts := strings.SplitN(secret, "_", 3)
+	if len(parts) != 3 || parts[0] != tokenPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// writeTokens atomically replaces a token file, which is only readable by its owner
+func writeTokens(path string, tokens []Token) error {
+	if tokens == nil {
+		tokens = []Token{}
+	}
+	bs, err := json.MarshalIndent(tokenFile{Tokens: tokens}, "", "\t")
+	if err != nil {
+		return models.WrapError("could not marshal token file", err)
+	}
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return models.WrapError("could not create token file", err)
+	}
+	_, err = f.Write(append(bs, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return models.WrapError("could not write token file", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return models.WrapError("could not replace token file", err)
+	}
+	return nil
+}
+
+// random generates n random bytes and encodes them
+func random(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", models.WrapError("could not generate token", err)
+	}
+	return encode(b), nil
+}
+
+// hash hashes a token key, keys are random so a plain sha256 is enough
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
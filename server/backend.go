@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,27 +20,41 @@ type Backend struct {
 }
 
 // New initializes and creates a new server backend API
-func New(addr string, service *services.Reminders) *Backend {
-	cfg := controllers.RouterConfig{Service: service}
+// the API is served over HTTPS when tlsConfig is not nil
+func New(addr string, tlsConfig *tls.Config, service *services.Reminders, cfg controllers.RouterConfig) *Backend {
+	cfg.Service = service
 	router := controllers.NewRouter(cfg)
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+	// event streams never go idle, so they are closed for the shutdown to complete
+	srv.RegisterOnShutdown(service.StopEvents)
 	return &Backend{
-		server: &http.Server{
-			Addr:    addr,
-			Handler: router,
-		},
+		server:  srv,
 		service: service,
 	}
 }
 
 // Start starts the initialized server (backend) application
 func (b *Backend) Start() error {
-	log.Printf("application started on address %s\n", b.server.Addr)
+	scheme := "http"
+	if b.server.TLSConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("application started on address %s (%s)\n", b.server.Addr, scheme)
 	err := b.service.Populate()
 	if err != nil {
 		return models.WrapError("could not initialize reminders service", err)
 	}
 
-	err = b.server.ListenAndServe()
+	if b.server.TLSConfig != nil {
+		// the certificate comes from the TLS config, which reloads it whenever its files change
+		err = b.server.ListenAndServeTLS("", "")
+	} else {
+		err = b.server.ListenAndServe()
+	}
 	if err == http.ErrServerClosed {
 		log.Println("http server is closed")
 		return nil
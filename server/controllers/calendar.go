@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type calendarRenderer interface {
+	Calendar(user services.User, recurring bool) (services.Calendar, error)
+}
+
+func calendarFeed(service calendarRenderer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var recurring bool
+		if v := r.URL.Query().Get("recurring"); v != "" {
+			var err error
+			if recurring, err = strconv.ParseBool(v); err != nil {
+				transport.SendError(w, models.DataValidationError{Message: "invalid recurring value provided"})
+				return
+			}
+		}
+		cal, err := service.Calendar(ctxUser(r.Context()), recurring)
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		w.Header().Set("ETag", cal.ETag)
+		// clients keep the feed, but always revalidate it with If-None-Match
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), cal.ETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(cal.Body)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(cal.Body)
+	})
+}
+
+// etagMatches checks whether an If-None-Match header matches the entity tag
+// weak comparison is used, as the spec requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
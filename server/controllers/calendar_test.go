@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophertuts/reminders-cli/server/auth"
+	"github.com/gophertuts/reminders-cli/server/services"
+)
+
+// calendarService represents a service which renders the name of the feed user
+// the other service methods are not used by the tests
+type calendarService struct {
+	RemindersService
+}
+
+func (calendarService) Calendar(user services.User, recurring bool) (services.Calendar, error) {
+	body := user.Name
+	if user.Admin {
+		body += " (admin)"
+	}
+	return services.Calendar{Body: []byte(body), ETag: `"` + body + `"`}, nil
+}
+
+// TestCalendarFeedIsScopedToTheTokenUser checks that the feed only renders the reminders
+// of the user of its token, & that calendar tokens give access to nothing else
+func TestCalendarFeedIsScopedToTheTokenUser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "tokens.json")
+	secret := func(name, user, scope string) string {
+		t.Helper()
+		_, s, err := auth.CreateToken(path, name, user, []string{scope})
+		if err != nil {
+			t.Fatalf("could not create token: %v", err)
+		}
+		return s
+	}
+	alice := secret("alice-calendar", "alice", auth.ScopeCalendar)
+	bob := secret("bob-laptop", "bob", auth.ScopeRead)
+	keyring, err := auth.NewKeyring(path)
+	if err != nil {
+		t.Fatalf("could not create keyring: %v", err)
+	}
+	router := NewRouter(RouterConfig{Service: calendarService{}, Keyring: keyring})
+
+	tests := []struct {
+		name   string
+		target string
+		bearer string
+		code   int
+		body   string
+	}{
+		{"no token", "/calendar.ics", "", http.StatusUnauthorized, ""},
+		{"unknown token", "/calendar.ics?token=s3cret", "", http.StatusUnauthorized, ""},
+		{"calendar token", "/calendar.ics?token=" + alice, "", http.StatusOK, "alice"},
+		{"read token", "/calendar.ics?token=" + bob, "", http.StatusOK, "bob"},
+		{"bearer token", "/calendar.ics", bob, http.StatusOK, "bob"},
+		{"calendar token elsewhere", "/reminders", alice, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Fatalf("expected status %d, got %d: %s", tt.code, rec.Code, rec.Body.String())
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected the feed of %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
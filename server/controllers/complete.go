@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type completer interface {
+	Complete(user services.User, id int) (models.Reminder, error)
+}
+
+func completeReminder(service completer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseIDParam(r.Context())
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		reminder, err := service.Complete(ctxUser(r.Context()), id)
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		transport.SendJSON(w, reminder, http.StatusOK)
+	})
+}
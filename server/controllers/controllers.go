@@ -6,21 +6,33 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/gophertuts/reminders-cli/server/auth"
 	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
 )
 
 // ctx param fetches param from context
-func ctxParam(ctx context.Context, key string) urlParam {
-	ps, ok := ctx.Value(ctxKey(paramsKey)).(map[string]urlParam)
+func ctxParam(ctx context.Context, key string) string {
+	m, ok := ctx.Value(ctxKey(matchKey)).(routeMatch)
 	if !ok {
-		return urlParam{}
+		return ""
 	}
-	return ps[key]
+	return m.params[key]
+}
+
+// ctxUser retrieves the user of a request: the user of its API token,
+// or the default user as an admin when no API token was required
+func ctxUser(ctx context.Context) services.User {
+	token, ok := auth.FromContext(ctx)
+	if !ok {
+		return services.User{Name: models.DefaultOwner, Admin: true}
+	}
+	return services.User{Name: token.Owner(), Admin: token.Allows(auth.ScopeAdmin)}
 }
 
 // parseIDParam parses id url param
 func parseIDParam(ctx context.Context) (int, error) {
-	id, err := strconv.Atoi(ctxParam(ctx, idParamName).value)
+	id, err := strconv.Atoi(ctxParam(ctx, idParamName))
 	if err != nil {
 		return 0, models.DataValidationError{Message: "invalid id provided"}
 	}
@@ -29,7 +41,7 @@ func parseIDParam(ctx context.Context) (int, error) {
 
 // parseIDParam parses ids url param
 func parseIDsParam(ctx context.Context) ([]int, error) {
-	idsSlice := strings.Split(ctxParam(ctx, idsParamName).value, ",")
+	idsSlice := strings.Split(ctxParam(ctx, idsParamName), ",")
 	var res []int
 	var invalid []int
 	for _, id := range idsSlice {
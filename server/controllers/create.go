@@ -11,24 +11,36 @@ import (
 )
 
 type creator interface {
-	Create(reminderBody services.ReminderCreateBody) (models.Reminder, error)
+	Create(user services.User, reminderBody services.ReminderCreateBody) (models.Reminder, error)
 }
 
 func createReminder(service creator) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var body struct {
-			Title    string        `json:"title"`
-			Message  string        `json:"message"`
-			Duration time.Duration `json:"duration"`
+			UID         string        `json:"uid"`
+			Title       string        `json:"title"`
+			Message     string        `json:"message"`
+			Duration    time.Duration `json:"duration"`
+			DueAt       string        `json:"due_at"`
+			TimeZone    string        `json:"time_zone"`
+			Repeat      string        `json:"repeat"`
+			RepeatUntil string        `json:"repeat_until"`
+			RepeatCount int           `json:"repeat_count"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			transport.SendError(w, models.InvalidJSONError{Message: err.Error()})
 			return
 		}
-		reminder, err := service.Create(services.ReminderCreateBody{
-			Title:    body.Title,
-			Message:  body.Message,
-			Duration: body.Duration,
+		reminder, err := service.Create(ctxUser(r.Context()), services.ReminderCreateBody{
+			UID:         body.UID,
+			Title:       body.Title,
+			Message:     body.Message,
+			Duration:    body.Duration,
+			DueAt:       body.DueAt,
+			TimeZone:    body.TimeZone,
+			Repeat:      body.Repeat,
+			RepeatUntil: body.RepeatUntil,
+			RepeatCount: body.RepeatCount,
 		})
 		if err != nil {
 			transport.SendError(w, err)
@@ -3,11 +3,12 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/gophertuts/reminders-cli/server/services"
 	"github.com/gophertuts/reminders-cli/server/transport"
 )
 
 type deleter interface {
-	Delete(ids []int) error
+	Delete(user services.User, ids []int) error
 }
 
 func deleteReminders(service deleter) http.Handler {
@@ -17,7 +18,7 @@ func deleteReminders(service deleter) http.Handler {
 			transport.SendError(w, err)
 			return
 		}
-		err = service.Delete(ids)
+		err = service.Delete(ctxUser(r.Context()), ids)
 		if err != nil {
 			transport.SendError(w, err)
 			return
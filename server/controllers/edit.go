@@ -11,7 +11,7 @@ import (
 )
 
 type editor interface {
-	Edit(reminderBody services.ReminderEditBody) (models.Reminder, error)
+	Edit(user services.User, reminderBody services.ReminderEditBody) (models.Reminder, error)
 }
 
 func editReminder(service editor) http.Handler {
@@ -25,16 +25,20 @@ func editReminder(service editor) http.Handler {
 			Title    string        `json:"title"`
 			Message  string        `json:"message"`
 			Duration time.Duration `json:"duration"`
+			DueAt    string        `json:"due_at"`
+			TimeZone string        `json:"time_zone"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			transport.SendError(w, models.InvalidJSONError{Message: err.Error()})
 			return
 		}
-		reminder, err := service.Edit(services.ReminderEditBody{
+		reminder, err := service.Edit(ctxUser(r.Context()), services.ReminderEditBody{
 			ID:       id,
 			Title:    body.Title,
 			Message:  body.Message,
 			Duration: body.Duration,
+			DueAt:    body.DueAt,
+			TimeZone: body.TimeZone,
 		})
 		if err != nil {
 			transport.SendError(w, err)
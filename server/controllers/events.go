@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+const (
+	// eventsHeartbeat is how often an idle event stream is kept alive
+	eventsHeartbeat = 15 * time.Second
+	// eventsRetry is how long clients wait before they reconnect
+	eventsRetry = 3 * time.Second
+	// resetEvent tells the client that events were lost, so it must fetch the reminders again
+	resetEvent = "reset"
+)
+
+type subscriber interface {
+	Subscribe(user services.User, lastEventID uint64) (*services.Subscription, []services.Event, bool)
+}
+
+func streamEvents(service subscriber) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			// EventSource can not set headers on its first connection
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		var after uint64
+		if lastID != "" {
+			var err error
+			if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+				transport.SendError(w, models.DataValidationError{Message: "invalid last event id provided"})
+				return
+			}
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			transport.SendError(w, errors.New("could not stream events: streaming is not supported"))
+			return
+		}
+		sub, missed, complete := service.Subscribe(ctxUser(r.Context()), after)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := transport.SendRetry(w, eventsRetry); err != nil {
+			return
+		}
+		if !complete {
+			if err := transport.SendEvent(w, "", resetEvent, struct{}{}); err != nil {
+				return
+			}
+		}
+		for _, e := range missed {
+			if err := sendEvent(w, e); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					// the server is shutting down, or the client fell behind and has to resume
+					return
+				}
+				if err := sendEvent(w, e); err != nil {
+					log.Printf("could not send event: %v", err)
+					return
+				}
+			case <-heartbeat.C:
+				if err := transport.SendComment(w, "heartbeat"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+// sendEvent sends a reminder event to the event stream
+func sendEvent(w http.ResponseWriter, e services.Event) error {
+	return transport.SendEvent(w, strconv.FormatUint(e.ID, 10), e.Type, e)
+}
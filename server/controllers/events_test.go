@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+)
+
+// busService subscribes to an event bus & hands out its subscriptions
+type busService struct {
+	bus  *services.EventBus
+	subs chan *services.Subscription
+}
+
+func (s busService) Subscribe(user services.User, lastEventID uint64) (*services.Subscription, []services.Event, bool) {
+	sub, missed, complete := s.bus.Subscribe("", lastEventID)
+	s.subs <- sub
+	return sub, missed, complete
+}
+
+// readEvents reads the event types & ids of an event stream, until n events were read
+func readEvents(t *testing.T, s *bufio.Scanner, n int) []string {
+	t.Helper()
+	var events []string
+	var id string
+	for len(events) < n && s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			events = append(events, strings.TrimPrefix(line, "event: ")+" "+id)
+			id = ""
+		}
+	}
+	if len(events) < n {
+		t.Fatalf("expected %d events, got %v (%v)", n, events, s.Err())
+	}
+	return events
+}
+
+func TestStreamEventsResumes(t *testing.T) {
+	service := busService{bus: services.NewEventBus(2), subs: make(chan *services.Subscription, 1)}
+	sub, _, _ := service.bus.Subscribe("", 0)
+	var ids []string
+	for i := 1; i <= 4; i++ {
+		service.bus.Publish(services.EventCreated, models.Reminder{ID: i})
+		ids = append(ids, strconv.FormatUint((<-sub.C).ID, 10))
+	}
+	sub.Close()
+	srv := httptest.NewServer(streamEvents(service))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		lastID string
+		want   []string
+	}{
+		{"buffered", ids[2], []string{"created " + ids[3]}},
+		{"oldest buffered", ids[1], []string{"created " + ids[2], "created " + ids[3]}},
+		// the second event was evicted from the buffer of 2 events
+		{"evicted", ids[0], []string{"reset ", "created " + ids[2], "created " + ids[3]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?last_event_id="+tt.lastID, nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("could not stream events: %v", err)
+			}
+			defer res.Body.Close()
+			<-service.subs
+			got := readEvents(t, bufio.NewScanner(res.Body), len(tt.want))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected events %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStreamEventsUnsubscribesOnDisconnect(t *testing.T) {
+	service := busService{bus: services.NewEventBus(2), subs: make(chan *services.Subscription, 1)}
+	srv := httptest.NewServer(streamEvents(service))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("could not stream events: %v", err)
+	}
+	defer res.Body.Close()
+	sub := <-service.subs
+	service.bus.Publish(services.EventCreated, models.Reminder{ID: 1})
+	readEvents(t, bufio.NewScanner(res.Body), 1)
+
+	cancel()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected the subscription to be closed once the client disconnects")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gophertuts/reminders-cli/server/exchange"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type exporter interface {
+	Export(user services.User, w io.Writer, format string) error
+}
+
+func exportReminders(service exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = exchange.FormatJSON
+		}
+		if err := exchange.ValidateFormat(format); err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", exchange.ContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="reminders.`+format+`"`)
+		// the response is streamed, so an error can only be logged
+		if err := service.Export(ctxUser(r.Context()), w, format); err != nil {
+			log.Printf("could not export reminders: %v", err)
+		}
+	})
+}
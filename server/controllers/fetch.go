@@ -4,11 +4,12 @@ import (
 	"net/http"
 
 	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
 	"github.com/gophertuts/reminders-cli/server/transport"
 )
 
 type fetcher interface {
-	Fetch(ids []int) ([]models.Reminder, error)
+	Fetch(user services.User, ids []int) ([]models.Reminder, error)
 }
 
 func fetchReminders(service fetcher) http.Handler {
@@ -18,7 +19,7 @@ func fetchReminders(service fetcher) http.Handler {
 			transport.SendError(w, err)
 			return
 		}
-		reminders, err := service.Fetch(ids)
+		reminders, err := service.Fetch(ctxUser(r.Context()), ids)
 		if err != nil {
 			transport.SendError(w, err)
 			return
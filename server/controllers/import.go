@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gophertuts/reminders-cli/server/exchange"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type importer interface {
+	Import(user services.User, r io.Reader, format, conflict string) (services.ImportReport, error)
+}
+
+func importReminders(service importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format == "" {
+			format = exchange.FormatOf(r.Header.Get("Content-Type"))
+		}
+		if format == "" {
+			format = exchange.FormatJSON
+		}
+		conflict := query.Get("conflict")
+		if conflict == "" {
+			conflict = services.ConflictSkip
+		}
+		report, err := service.Import(ctxUser(r.Context()), r.Body, format, conflict)
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		transport.SendJSON(w, report, http.StatusOK)
+	})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type lister interface {
+	List(user services.User, query services.ReminderListQuery) (services.ReminderList, error)
+}
+
+func listReminders(service lister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseListQuery(r.URL.Query())
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		list, err := service.List(ctxUser(r.Context()), query)
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		transport.SendJSON(w, list, http.StatusOK)
+	})
+}
+
+// parseListQuery parses the list url query params
+func parseListQuery(values url.Values) (services.ReminderListQuery, error) {
+	query := services.ReminderListQuery{
+		Owner:  values.Get("owner"),
+		Status: values.Get("status"),
+		Title:  values.Get("title"),
+		SortBy: values.Get("sort"),
+		Order:  values.Get("order"),
+		Cursor: values.Get("cursor"),
+	}
+	var err error
+	if query.DueBefore, err = parseTimeParam(values, "due_before"); err != nil {
+		return services.ReminderListQuery{}, err
+	}
+	if query.DueAfter, err = parseTimeParam(values, "due_after"); err != nil {
+		return services.ReminderListQuery{}, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return services.ReminderListQuery{}, models.DataValidationError{
+				Message: "invalid limit provided",
+			}
+		}
+	}
+	return query, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 time url query param
+func parseTimeParam(values url.Values, name string) (time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, models.DataValidationError{
+			Message: fmt.Sprintf("invalid %s provided, expected RFC 3339 time", name),
+		}
+	}
+	return t, nil
+}
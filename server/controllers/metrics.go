@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gophertuts/reminders-cli/server/metrics"
+)
+
+func serveMetrics() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		if _, err := metrics.Default.WriteTo(w); err != nil {
+			log.Printf("could not write metrics: %v", err)
+		}
+	})
+}
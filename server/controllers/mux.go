@@ -2,65 +2,58 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/gophertuts/reminders-cli/server/models"
 	"github.com/gophertuts/reminders-cli/server/transport"
 )
 
-const paramsKey = "ps"
+const matchKey = "match"
 
 // ctxKey represents the context key for accessing it
 type ctxKey string
 
-// urlParam represents HTTP url param from regex
-type urlParam struct {
-	name     string
-	regEx    string
-	value    string
-	position int
-}
-
-// route represents a Handler route
-type route struct {
-	path    string
-	method  string
-	params  map[string]urlParam
-	handler http.Handler
-}
-
-// populate populates a route based on the actual serving request
-func (r *route) populate(req *http.Request) string {
-	urlSlice := splitURL(req.URL.Path)
-	pathSlice := splitURL(r.path)
-	if len(pathSlice) != len(urlSlice) {
-		return ""
-	}
-	for name, param := range r.params {
-		regexParamVal := urlSlice[param.position]
-		regex := regexp.MustCompile(param.regEx)
-		if name != "" && regex.MatchString(regexParamVal) {
-			param.value = regexParamVal
-			r.params[name] = param
-			pathSlice[param.position] = regexParamVal
-		}
-	}
-	pathStr := "/" + strings.Join(pathSlice, "/")
-	if req.URL.Path == pathStr {
-		return r.method + pathStr
-	}
-	return ""
+// routeMatch represents the route a request matched, with the values of its params
+type routeMatch struct {
+	route  string
+	params map[string]string
+}
+
+// paramPattern matches a {param}:Regex path segment
+var paramPattern = regexp.MustCompile(`^{([a-z]+)}:(.+)$`)
+
+// node represents a path segment of the routing tree
+// static children are matched before the param ones, which are matched in registration order
+// route is the pattern of the node without the param regexes, e.g. /reminders/{id}
+type node struct {
+	static   map[string]*node
+	params   []*paramNode
+	handlers map[string]http.Handler
+	route    string
+}
+
+// paramNode represents a {param}:Regex path segment of the routing tree
+// the regex is matched as written, so it has to be anchored to match the whole segment
+type paramNode struct {
+	name  string
+	expr  string
+	regex *regexp.Regexp
+	node  *node
 }
 
 // RegexpMux represents a router (mux) responsible for routing
+// the routes are compiled into a tree once, when they are registered,
+// so the mux must not be changed once it serves requests
 type RegexpMux struct {
-	routes    []*route
-	routesMap map[string]*route
+	root *node
 }
 
 // Get registers an HTTP handler with GET method
+// HEAD requests are served by it too, unless a HEAD handler is registered
 func (h *RegexpMux) Get(pattern string, handler http.Handler) {
 	h.Handle(http.MethodGet, pattern, handler)
 }
@@ -85,79 +78,182 @@ func (h *RegexpMux) Delete(pattern string, handler http.Handler) {
 	h.Handle(http.MethodDelete, pattern, handler)
 }
 
-// Handle works with a request Handler
+// Handle registers an HTTP handler for a method & a pattern
+// it panics on an invalid param regex, or when the route is already registered
 func (h *RegexpMux) Handle(method, pattern string, handler http.Handler) {
-	ps := h.params(pattern)
-	r := &route{
-		method:  method,
-		path:    pattern,
-		params:  ps,
-		handler: handler,
+	if h.root == nil {
+		h.root = newNode()
+	}
+	n := h.root
+	var route strings.Builder
+	for _, segment := range splitURL(pattern) {
+		n = n.child(segment)
+		route.WriteString("/")
+		if m := paramPattern.FindStringSubmatch(segment); m != nil {
+			segment = "{" + m[1] + "}"
+		}
+		route.WriteString(segment)
+	}
+	if _, ok := n.handlers[method]; ok {
+		panic(fmt.Sprintf("route %s %s is already registered", method, pattern))
+	}
+	n.handlers[method] = handler
+	n.route = route.String()
+	if n.route == "" {
+		n.route = "/"
 	}
-	h.routes = append(h.routes, r)
 }
 
-func (h RegexpMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.routesMap = map[string]*route{}
-	for _, route := range h.routes {
-		key := route.populate(r)
-		h.routesMap[key] = route
-	}
-	key := r.Method + r.URL.Path
-	route, ok := h.routesMap[key]
-	if !ok {
+func (h *RegexpMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, match, allowed := h.lookup(r.Method, r.URL.Path, true)
+	switch {
+	case handler != nil:
+	case len(allowed) == 0:
 		transport.SendError(w, models.NotFoundError{})
 		return
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", allow(allowed))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allow(allowed))
+		transport.SendError(w, models.MethodNotAllowedError{
+			Message: fmt.Sprintf("method %s is not allowed, allowed: %s", r.Method, allow(allowed)),
+		})
+		return
 	}
-	ctx := r.Context()
-	if len(route.params) != 0 {
-		ctx = context.WithValue(ctx, ctxKey(paramsKey), route.params)
+	r = r.WithContext(context.WithValue(r.Context(), ctxKey(matchKey), match))
+	handler.ServeHTTP(w, r)
+}
+
+// Route retrieves the route pattern of a request, e.g. /reminders/{id}, for the metrics
+// requests of a known path with another method get the route of the path,
+// the other ones which are not matched get "unmatched"
+func (h *RegexpMux) Route(r *http.Request) string {
+	_, match, _ := h.lookup(r.Method, r.URL.Path, false)
+	if match.route == "" {
+		return "unmatched"
 	}
-	route.handler.ServeHTTP(w, r.WithContext(ctx))
+	return match.route
 }
 
-// params retrieves a map of url params for a given url
-func (h RegexpMux) params(url string) map[string]urlParam {
-	ps := map[string]urlParam{}
-	for _, v := range splitURL(url) {
-		p := h.parseParam(url, v)
-		if p.name != "" {
-			ps[p.name] = p
+// lookup matches a method & a path against the routes
+// it retrieves the handler & the match, with its params when params is set,
+// or the methods allowed for the path & the route of the first node which matched it when no handler did
+func (h *RegexpMux) lookup(method, path string, params bool) (http.Handler, routeMatch, map[string]bool) {
+	var handler http.Handler
+	var match routeMatch
+	var allowed map[string]bool
+	if h.root == nil {
+		return handler, match, allowed
+	}
+	segments := splitURL(path)
+	values := make([]string, 0, len(segments))
+	h.root.match(segments, &values, nil, func(n *node, names []string) bool {
+		handler = n.handler(method)
+		if handler == nil {
+			if allowed == nil {
+				allowed = map[string]bool{}
+				match.route = n.route
+			}
+			for m := range n.handlers {
+				allowed[m] = true
+			}
+			return false
 		}
+		match.route = n.route
+		if params && len(names) > 0 {
+			match.params = make(map[string]string, len(names))
+			for i, name := range names {
+				match.params[name] = values[i]
+			}
+		}
+		return true
+	})
+	return handler, match, allowed
+}
+
+func newNode() *node {
+	return &node{
+		static:   map[string]*node{},
+		handlers: map[string]http.Handler{},
 	}
-	return ps
 }
 
-// parseParam parses URL parameters given a {param}:Regex expression
-func (h RegexpMux) parseParam(url, regexParam string) urlParam {
-	r := regexp.MustCompile(`({[a-z]+}:)(.+)`)
-	matches := r.FindStringSubmatch(regexParam)
-	// 1 - entire match
-	// 2 - 1st group -> param name
-	// 3 - 2nd group -> param regex
-	if len(matches) < 3 {
-		return urlParam{
-			regEx: ".+",
+// child retrieves the child node of a pattern segment, creating it if it does not exist
+func (n *node) child(segment string) *node {
+	m := paramPattern.FindStringSubmatch(segment)
+	if m == nil {
+		c, ok := n.static[segment]
+		if !ok {
+			c = newNode()
+			n.static[segment] = c
+		}
+		return c
+	}
+	name, expr := m[1], m[2]
+	for _, p := range n.params {
+		if p.name == name && p.expr == expr {
+			return p.node
 		}
 	}
-	replacer := strings.NewReplacer(
-		"{", "",
-		"}", "",
-		":", "",
-	)
-	name := replacer.Replace(matches[1])
-	regEx := matches[2]
-	var position int
-	for i, v := range splitURL(url) {
-		if v == matches[1]+matches[2] {
-			position = i
+	p := &paramNode{
+		name:  name,
+		expr:  expr,
+		regex: regexp.MustCompile(expr),
+		node:  newNode(),
+	}
+	n.params = append(n.params, p)
+	return p.node
+}
+
+// match walks the tree along the path segments and calls found with every node
+// which matches the whole path, until found retrieves true
+// values holds the matched param values, names the matching param names
+func (n *node) match(segments []string, values *[]string, names []string, found func(*node, []string) bool) bool {
+	if len(segments) == 0 {
+		return len(n.handlers) > 0 && found(n, names)
+	}
+	segment, rest := segments[0], segments[1:]
+	if c, ok := n.static[segment]; ok && c.match(rest, values, names, found) {
+		return true
+	}
+	for _, p := range n.params {
+		if !p.regex.MatchString(segment) {
+			continue
+		}
+		*values = append(*values, segment)
+		if p.node.match(rest, values, append(names, p.name), found) {
+			return true
 		}
+		*values = (*values)[:len(*values)-1]
+	}
+	return false
+}
+
+// handler retrieves the handler of a method, HEAD falls back to GET
+func (n *node) handler(method string) http.Handler {
+	if h, ok := n.handlers[method]; ok {
+		return h
+	}
+	if method == http.MethodHead {
+		return n.handlers[http.MethodGet]
+	}
+	return nil
+}
+
+// allow formats the allowed methods as an Allow header value
+func allow(methods map[string]bool) string {
+	if methods[http.MethodGet] {
+		methods[http.MethodHead] = true
 	}
-	return urlParam{
-		name:     name,
-		regEx:    regEx,
-		position: position,
+	methods[http.MethodOptions] = true
+	list := make([]string, 0, len(methods))
+	for method := range methods {
+		list = append(list, method)
 	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
 }
 
 // splitURL splits the request URL by / and retrieves a slice
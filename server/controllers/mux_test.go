@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+func TestMain(m *testing.M) {
+	// the middlewares log every request, which drowns the test output
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// echo represents a handler which writes the method, the route & the params it was served with
+func echo() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, _ := r.Context().Value(ctxKey(matchKey)).(routeMatch)
+		names := make([]string, 0, len(m.params))
+		for name := range m.params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		res := r.Method + " " + m.route
+		for _, name := range names {
+			res += " " + name + "=" + m.params[name]
+		}
+		w.Header().Set("X-Route", m.route)
+		fmt.Fprint(w, res)
+	})
+}
+
+// testRoutes are registered the same way NewRouter registers the server routes
+var testRoutes = []struct {
+	method  string
+	pattern string
+}{
+	{http.MethodGet, "/health"},
+	{http.MethodPost, "/reminders"},
+	{http.MethodGet, "/reminders"},
+	{http.MethodGet, "/reminders/" + idsParam},
+	{http.MethodDelete, "/reminders/" + idsParam},
+	{http.MethodPatch, "/reminders/" + idParam},
+	{http.MethodPost, "/reminders/" + idParam + "/snooze"},
+	{http.MethodPost, "/reminders/" + idParam + "/complete"},
+	{http.MethodPost, "/reminders/" + idParam + "/reopen"},
+	{http.MethodGet, "/export"},
+	{http.MethodPost, "/import"},
+	{http.MethodGet, "/events"},
+	{http.MethodGet, "/calendar.ics"},
+	{http.MethodGet, "/metrics"},
+}
+
+func newTestMux() *RegexpMux {
+	mux := &RegexpMux{}
+	for _, route := range testRoutes {
+		mux.Handle(route.method, route.pattern, echo())
+	}
+	return mux
+}
+
+// serve serves a request with the mux and retrieves the recorded response
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestMuxRoutes(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/health", http.StatusOK, "GET /health"},
+		{http.MethodGet, "/reminders/", http.StatusOK, "GET /reminders"},
+		{http.MethodPost, "/reminders", http.StatusOK, "POST /reminders"},
+		{http.MethodGet, "/reminders/1,2,3", http.StatusOK, "GET /reminders/{ids} ids=1,2,3"},
+		{http.MethodDelete, "/reminders/7", http.StatusOK, "DELETE /reminders/{ids} ids=7"},
+		{http.MethodPatch, "/reminders/42", http.StatusOK, "PATCH /reminders/{id} id=42"},
+		{http.MethodPost, "/reminders/42/snooze", http.StatusOK, "POST /reminders/{id}/snooze id=42"},
+		{http.MethodPost, "/reminders/42/reopen", http.StatusOK, "POST /reminders/{id}/reopen id=42"},
+		{http.MethodGet, "/missing", http.StatusNotFound, ""},
+		{http.MethodGet, "/reminders/abc", http.StatusNotFound, ""},
+		{http.MethodGet, "/reminders/x1", http.StatusNotFound, ""},
+		{http.MethodDelete, "/reminders/1,2x", http.StatusNotFound, ""},
+		{http.MethodGet, "/reminders/1,,2", http.StatusNotFound, ""},
+		{http.MethodGet, "/reminders/1/2", http.StatusNotFound, ""},
+		{http.MethodPost, "/reminders/42/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := serve(mux, tt.method, tt.path)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMuxMethodNotAllowed(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodDelete, "/health", "GET, HEAD, OPTIONS"},
+		{http.MethodPut, "/reminders", "GET, HEAD, OPTIONS, POST"},
+		// both the {ids} & the {id} routes match a single id
+		{http.MethodPost, "/reminders/1", "DELETE, GET, HEAD, OPTIONS, PATCH"},
+		{http.MethodPatch, "/reminders/1,2", "DELETE, GET, HEAD, OPTIONS"},
+		{http.MethodGet, "/reminders/1/snooze", "OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := serve(mux, tt.method, tt.path)
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("expected Allow %q, got %q", tt.allow, got)
+			}
+		})
+	}
+}
+
+func TestMuxHead(t *testing.T) {
+	mux := newTestMux()
+	mux.Handle(http.MethodHead, "/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Route", "head")
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	tests := []struct {
+		path  string
+		route string
+	}{
+		{"/health", "/health"},
+		{"/reminders/1", "/reminders/{ids}"},
+		{"/metrics", "head"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Head(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("could not send request: %v", err)
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+			}
+			if got := res.Header.Get("X-Route"); got != tt.route {
+				t.Errorf("expected HEAD to be served by %q, got %q", tt.route, got)
+			}
+			if len(body) != 0 {
+				t.Errorf("expected no body, got %q", body)
+			}
+		})
+	}
+	w := serve(mux, http.MethodHead, "/reminders/1/snooze")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected HEAD of a route without GET to be %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestMuxOptions(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		path   string
+		status int
+		allow  string
+	}{
+		{"/health", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"/reminders/42/complete", http.StatusNoContent, "OPTIONS, POST"},
+		{"/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(mux, http.MethodOptions, tt.path)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("expected Allow %q, got %q", tt.allow, got)
+			}
+		})
+	}
+}
+
+// TestMuxParamsConcurrent serves requests for different ids at once,
+// it is meant to run under the race detector: go test -race ./server/controllers
+func TestMuxParamsConcurrent(t *testing.T) {
+	mux := newTestMux()
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				id := fmt.Sprint(i*rounds + j)
+				w := serve(mux, http.MethodPost, "/reminders/"+id+"/snooze")
+				if want := "POST /reminders/{id}/snooze id=" + id; w.Body.String() != want {
+					t.Errorf("expected body %q, got %q", want, w.Body.String())
+					return
+				}
+				w = serve(mux, http.MethodGet, "/reminders/"+id+","+id)
+				if want := "GET /reminders/{ids} ids=" + id + "," + id; w.Body.String() != want {
+					t.Errorf("expected body %q, got %q", want, w.Body.String())
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// benchmarkPaths are matched by the first, a middle & the last registered routes, and none
+var benchmarkPaths = []struct {
+	method string
+	path   string
+}{
+	{http.MethodGet, "/health"},
+	{http.MethodGet, "/reminders/1,2,3"},
+	{http.MethodPost, "/reminders/42/reopen"},
+	{http.MethodGet, "/metrics"},
+	{http.MethodGet, "/missing"},
+}
+
+func benchmarkMux(b *testing.B, mux http.Handler) {
+	for _, p := range benchmarkPaths {
+		b.Run(p.method+" "+p.path, func(b *testing.B) {
+			r := httptest.NewRequest(p.method, p.path, nil)
+			w := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.Body.Reset()
+				mux.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func TestMuxRoute(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		method string
+		path   string
+		route  string
+	}{
+		{http.MethodGet, "/reminders/1,2", "/reminders/{ids}"},
+		{http.MethodPatch, "/reminders/42", "/reminders/{id}"},
+		{http.MethodHead, "/health", "/health"},
+		// requests of a known path with another method get the route of the path
+		{http.MethodDelete, "/health", "/health"},
+		{http.MethodOptions, "/reminders/1/snooze", "/reminders/{id}/snooze"},
+		{http.MethodGet, "/missing", "unmatched"},
+		{http.MethodGet, "/reminders/abc", "unmatched"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := mux.Route(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.route {
+				t.Errorf("expected route %q, got %q", tt.route, got)
+			}
+		})
+	}
+}
+
+// BenchmarkMux measures routing with the routing tree
+func BenchmarkMux(b *testing.B) {
+	benchmarkMux(b, newTestMux())
+}
+
+// BenchmarkLinearMux measures routing with the mux the routing tree replaced
+func BenchmarkLinearMux(b *testing.B) {
+	mux := linearMux{}
+	for _, route := range testRoutes {
+		mux.Handle(route.method, route.pattern, echo())
+	}
+	benchmarkMux(b, mux)
+}
+
+// linearMux is the mux the routing tree replaced, kept as the baseline of the benchmarks
+// it compiles the param regexes of every route on every request and shares
+// the param values between requests, so it is not safe for concurrent use
+type linearMux struct {
+	routes    []*linearRoute
+	routesMap map[string]*linearRoute
+}
+
+// linearParam represents HTTP url param from regex
+type linearParam struct {
+	name     string
+	regEx    string
+	value    string
+	position int
+}
+
+// linearRoute represents a Handler route
+type linearRoute struct {
+	path    string
+	method  string
+	params  map[string]linearParam
+	handler http.Handler
+}
+
+func (r *linearRoute) populate(req *http.Request) string {
+	urlSlice := splitURL(req.URL.Path)
+	pathSlice := splitURL(r.path)
+	if len(pathSlice) != len(urlSlice) {
+		return ""
+	}
+	for name, param := range r.params {
+		regexParamVal := urlSlice[param.position]
+		regex := regexp.MustCompile(param.regEx)
+		if name != "" && regex.MatchString(regexParamVal) {
+			param.value = regexParamVal
+			r.params[name] = param
+			pathSlice[param.position] = regexParamVal
+		}
+	}
+	pathStr := "/" + strings.Join(pathSlice, "/")
+	if req.URL.Path == pathStr {
+		return r.method + pathStr
+	}
+	return ""
+}
+
+func (h *linearMux) Handle(method, pattern string, handler http.Handler) {
+	h.routes = append(h.routes, &linearRoute{
+		method:  method,
+		path:    pattern,
+		params:  h.params(pattern),
+		handler: handler,
+	})
+}
+
+func (h linearMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.routesMap = map[string]*linearRoute{}
+	for _, route := range h.routes {
+		key := route.populate(r)
+		h.routesMap[key] = route
+	}
+	route, ok := h.routesMap[r.Method+r.URL.Path]
+	if !ok {
+		transport.SendError(w, models.NotFoundError{})
+		return
+	}
+	ctx := r.Context()
+	if len(route.params) != 0 {
+		ctx = context.WithValue(ctx, ctxKey("ps"), route.params)
+	}
+	route.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (h linearMux) params(url string) map[string]linearParam {
+	ps := map[string]linearParam{}
+	for _, v := range splitURL(url) {
+		p := h.parseParam(url, v)
+		if p.name != "" {
+			ps[p.name] = p
+		}
+	}
+	return ps
+}
+
+func (h linearMux) parseParam(url, regexParam string) linearParam {
+	r := regexp.MustCompile(`({[a-z]+}:)(.+)`)
+	matches := r.FindStringSubmatch(regexParam)
+	if len(matches) < 3 {
+		return linearParam{regEx: ".+"}
+	}
+	name := strings.NewReplacer("{", "", "}", "", ":", "").Replace(matches[1])
+	var position int
+	for i, v := range splitURL(url) {
+		if v == matches[1]+matches[2] {
+			position = i
+		}
+	}
+	return linearParam{name: name, regEx: matches[2], position: position}
+}
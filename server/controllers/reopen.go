@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type reopener interface {
+	Reopen(user services.User, body services.ReminderReopenBody) (models.Reminder, error)
+}
+
+func reopenReminder(service reopener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseIDParam(r.Context())
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		var body struct {
+			Duration time.Duration `json:"duration"`
+			DueAt    string        `json:"due_at"`
+			TimeZone string        `json:"time_zone"`
+		}
+		// the body is optional, when the reminder is still due in the future
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil && err != io.EOF {
+			transport.SendError(w, models.InvalidJSONError{Message: err.Error()})
+			return
+		}
+		reminder, err := service.Reopen(ctxUser(r.Context()), services.ReminderReopenBody{
+			ID:       id,
+			Duration: body.Duration,
+			DueAt:    body.DueAt,
+			TimeZone: body.TimeZone,
+		})
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		transport.SendJSON(w, reminder, http.StatusOK)
+	})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/gophertuts/reminders-cli/server/auth"
 	"github.com/gophertuts/reminders-cli/server/middleware"
 )
 
@@ -11,7 +12,7 @@ const (
 	idParamName  = "id"
 	idsParamName = "ids"
 	idParam      = `{` + idParamName + `}:^[0-9]+$`
-	idsParam     = `{` + idsParamName + `}:[0-9]+(,[0-9]+)*`
+	idsParam     = `{` + idsParamName + `}:^[0-9]+(,[0-9]+)*$`
 )
 
 // RemindersService represents the Reminders service
@@ -19,24 +20,59 @@ type RemindersService interface {
 	creator
 	editor
 	fetcher
+	lister
 	deleter
+	snoozer
+	completer
+	reopener
+	exporter
+	importer
+	calendarRenderer
+	subscriber
 }
 
 // RouterConfig represents router specific configuration
 type RouterConfig struct {
 	Service RemindersService
+	// Keyring holds the API tokens, which are required for every endpoint but /health
+	// when it is enabled
+	Keyring *auth.Keyring
 }
 
 // NewRouter creates a new server (backend) application router
 func NewRouter(cfg RouterConfig) http.Handler {
-	r := RegexpMux{}
+	r := &RegexpMux{}
 	m := middleware.New(
 		middleware.HTTPLogger,
 	)
+	read := middleware.New(
+		middleware.HTTPLogger,
+		middleware.Authenticate(cfg.Keyring, auth.ScopeRead),
+	)
+	write := middleware.New(
+		middleware.HTTPLogger,
+		middleware.Authenticate(cfg.Keyring, auth.ScopeWrite),
+	)
+	// calendar apps can not send bearer tokens, so the feed also takes the token from its url
+	feed := middleware.New(
+		middleware.HTTPLogger,
+		middleware.AuthenticateQuery(cfg.Keyring, auth.ScopeCalendar, "token"),
+	)
 	r.Get("/health", m.Then(health()))
-	r.Post("/reminders", m.Then(createReminder(cfg.Service)))
-	r.Get("/reminders/"+idsParam, m.Then(fetchReminders(cfg.Service)))
-	r.Delete("/reminders/"+idsParam, m.Then(deleteReminders(cfg.Service)))
-	r.Patch("/reminders/"+idParam, m.Then(editReminder(cfg.Service)))
-	return r
+	r.Post("/reminders", write.Then(createReminder(cfg.Service)))
+	r.Get("/reminders", read.Then(listReminders(cfg.Service)))
+	r.Get("/reminders/"+idsParam, read.Then(fetchReminders(cfg.Service)))
+	r.Delete("/reminders/"+idsParam, write.Then(deleteReminders(cfg.Service)))
+	r.Patch("/reminders/"+idParam, write.Then(editReminder(cfg.Service)))
+	r.Post("/reminders/"+idParam+"/snooze", write.Then(snoozeReminder(cfg.Service)))
+	r.Post("/reminders/"+idParam+"/complete", write.Then(completeReminder(cfg.Service)))
+	r.Post("/reminders/"+idParam+"/reopen", write.Then(reopenReminder(cfg.Service)))
+	r.Get("/export", read.Then(exportReminders(cfg.Service)))
+	// users import as their own reminders, only admins keep the owners of the imported ones
+	r.Post("/import", write.Then(importReminders(cfg.Service)))
+	r.Get("/events", read.Then(streamEvents(cfg.Service)))
+	r.Get("/calendar.ics", feed.Then(calendarFeed(cfg.Service)))
+	r.Get("/metrics", read.Then(serveMetrics()))
+	// the mux itself is measured, so the requests it rejects (404, 405) are counted too
+	return middleware.Metrics(r.Route)(r)
 }
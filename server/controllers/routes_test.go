@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRouterMeasuresEveryRequest checks that the requests the mux answers itself are counted too
+func TestRouterMeasuresEveryRequest(t *testing.T) {
+	router := NewRouter(RouterConfig{Service: calendarService{}})
+	tests := []struct {
+		method string
+		path   string
+		series string
+	}{
+		{http.MethodPut, "/missing", `{route="unmatched",method="PUT",code="404"}`},
+		{http.MethodDelete, "/health", `{route="/health",method="DELETE",code="405"}`},
+		{http.MethodOptions, "/export", `{route="/export",method="OPTIONS",code="204"}`},
+		{http.MethodGet, "/health", `{route="/health",method="GET",code="200"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			before := requestsTotal(t, router, tt.series)
+			serve(router, tt.method, tt.path)
+			if got := requestsTotal(t, router, tt.series); got != before+1 {
+				t.Errorf("expected reminders_http_requests_total%s to be %v, got %v", tt.series, before+1, got)
+			}
+		})
+	}
+}
+
+// requestsTotal scrapes the metrics of the router & retrieves the value of a requests counter series
+func requestsTotal(t *testing.T, router http.Handler, series string) float64 {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/metrics")
+	prefix := "reminders_http_requests_total" + series + " "
+	s := bufio.NewScanner(w.Body)
+	for s.Scan() {
+		if !strings.HasPrefix(s.Text(), prefix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(s.Text(), prefix), 64)
+		if err != nil {
+			t.Fatalf("could not parse %q: %v", s.Text(), err)
+		}
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+type snoozer interface {
+	Snooze(user services.User, body services.ReminderSnoozeBody) (models.Reminder, error)
+}
+
+func snoozeReminder(service snoozer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseIDParam(r.Context())
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		var body struct {
+			Duration time.Duration `json:"duration"`
+			Until    string        `json:"until"`
+			TimeZone string        `json:"time_zone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			transport.SendError(w, models.InvalidJSONError{Message: err.Error()})
+			return
+		}
+		reminder, err := service.Snooze(ctxUser(r.Context()), services.ReminderSnoozeBody{
+			ID:       id,
+			Duration: body.Duration,
+			Until:    body.Until,
+			TimeZone: body.TimeZone,
+		})
+		if err != nil {
+			transport.SendError(w, err)
+			return
+		}
+		transport.SendJSON(w, reminder, http.StatusOK)
+	})
+}
@@ -0,0 +1,186 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// csvColumns holds the columns of the csv export, in order
+// the number of occurrences of recurring reminders is not exported
+var csvColumns = []string{
+	"id", "uid", "owner", "title", "message", "status", "due_at", "time_zone",
+	"repeat", "repeat_until", "repeat_count", "created_at", "modified_at", "completed_at",
+}
+
+// csvEncoder writes the reminders as csv rows, after a header row
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(reminder models.Reminder) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	var rule, until, count, completedAt string
+	if reminder.Repeat != nil {
+		rule = reminder.Repeat.Rule
+		until = formatTime(reminder.Repeat.Until)
+		if reminder.Repeat.Count > 0 {
+			count = strconv.Itoa(reminder.Repeat.Count)
+		}
+	}
+	completedAt = formatTime(reminder.CompletedAt)
+	due := reminder.Due()
+	return e.w.Write([]string{
+		strconv.Itoa(reminder.ID),
+		reminder.UID,
+		reminder.Owner,
+		reminder.Title,
+		reminder.Message,
+		string(reminder.Status),
+		formatTime(&due),
+		reminder.TimeZone,
+		rule,
+		until,
+		count,
+		formatTime(&reminder.CreatedAt),
+		formatTime(&reminder.ModifiedAt),
+		completedAt,
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader writes the header row once
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+// decodeCSV decodes csv rows of reminders, the columns are matched by the header row
+// so they can be in any order and unknown ones are ignored, only 'title' is required
+func decodeCSV(r io.Reader) ([]models.Reminder, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, formatError("invalid csv header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, formatError("csv header has no 'title' column")
+	}
+	var reminders []models.Reminder
+	for row := 1; ; row++ {
+		values, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return reminders, nil
+		}
+		if err != nil {
+			return nil, formatError("invalid csv: %v", err)
+		}
+		reminder, err := decodeCSVRow(columns, values)
+		if err != nil {
+			return nil, formatError("record %d is invalid: %v", row, err)
+		}
+		reminders = append(reminders, reminder)
+	}
+}
+
+// decodeCSVRow decodes a single csv row
+func decodeCSVRow(columns map[string]int, values []string) (models.Reminder, error) {
+	get := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(values) {
+			return ""
+		}
+		return strings.TrimSpace(values[i])
+	}
+	reminder := models.Reminder{
+		UID:      get("uid"),
+		Owner:    get("owner"),
+		Title:    get("title"),
+		Message:  get("message"),
+		Status:   models.Status(get("status")),
+		TimeZone: get("time_zone"),
+	}
+	var err error
+	if id := get("id"); id != "" {
+		if reminder.ID, err = strconv.Atoi(id); err != nil {
+			return models.Reminder{}, errors.New("invalid id")
+		}
+	}
+	times := map[string]*time.Time{
+		"due_at":      &reminder.DueAt,
+		"created_at":  &reminder.CreatedAt,
+		"modified_at": &reminder.ModifiedAt,
+	}
+	for name, t := range times {
+		if *t, err = parseTime(get(name)); err != nil {
+			return models.Reminder{}, errors.New("invalid " + name)
+		}
+	}
+	if completedAt, err := parseTime(get("completed_at")); err != nil {
+		return models.Reminder{}, errors.New("invalid completed_at")
+	} else if !completedAt.IsZero() {
+		reminder.CompletedAt = &completedAt
+	}
+	if rule := get("repeat"); rule != "" {
+		reminder.Repeat = &models.Recurrence{Rule: rule, Start: reminder.DueAt}
+		until, err := parseTime(get("repeat_until"))
+		if err != nil {
+			return models.Reminder{}, errors.New("invalid repeat_until")
+		}
+		if !until.IsZero() {
+			reminder.Repeat.Until = &until
+		}
+		if count := get("repeat_count"); count != "" {
+			if reminder.Repeat.Count, err = strconv.Atoi(count); err != nil {
+				return models.Reminder{}, errors.New("invalid repeat_count")
+			}
+		}
+	}
+	return reminder, nil
+}
+
+// formatTime formats an optional time as RFC 3339
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseTime parses an optional RFC 3339 time
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,95 @@
+// Package exchange encodes reminders into the formats they are exported to
+// (json, csv and iCalendar) and decodes them back when they are imported
+package exchange
+
+import (
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// exchange formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatICS  = "ics"
+)
+
+// contentTypes maps every format to its media type
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatCSV:  "text/csv",
+	FormatICS:  "text/calendar",
+}
+
+// ValidateFormat checks whether the format is a known one
+func ValidateFormat(format string) error {
+	if _, ok := contentTypes[format]; !ok {
+		return models.DataValidationError{
+			Message: fmt.Sprintf("invalid format '%s', expected one of: json, csv, ics", format),
+		}
+	}
+	return nil
+}
+
+// ContentType retrieves the media type of a format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FormatOf retrieves the format of a media type, or an empty string if it is not a known one
+func FormatOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	for format, t := range contentTypes {
+		if t == mediaType {
+			return format
+		}
+	}
+	return ""
+}
+
+// Encoder represents a streaming encoder, which writes one reminder at a time
+type Encoder interface {
+	Encode(reminder models.Reminder) error
+	// Close writes whatever follows the last reminder, it does not close the writer
+	Close() error
+}
+
+// NewEncoder creates the encoder of a format, nothing is written until the first Encode
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonEncoder{w: w}, nil
+	case FormatCSV:
+		return newCSVEncoder(w), nil
+	case FormatICS:
+		return newICSEncoder(w), nil
+	default:
+		return nil, ValidateFormat(format)
+	}
+}
+
+// Decode decodes every reminder of an export
+// the errors name the record which could not be decoded
+func Decode(r io.Reader, format string) ([]models.Reminder, error) {
+	switch format {
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	case FormatICS:
+		return decodeICS(r)
+	default:
+		return nil, ValidateFormat(format)
+	}
+}
+
+// formatError creates the error returned for an undecodable export
+func formatError(format string, args ...interface{}) error {
+	return models.FormatValidationError{Message: fmt.Sprintf(format, args...)}
+}
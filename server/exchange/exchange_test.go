@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// testReminders retrieves reminders with the values which are hard to encode:
+// quotes, separators & line breaks, a recurrence with an end & a cron recurrence
+func testReminders() []models.Reminder {
+	due := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	created := time.Date(2029, 12, 1, 8, 30, 0, 0, time.UTC)
+	completed := time.Date(2030, 1, 2, 9, 5, 0, 0, time.UTC)
+	until := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []models.Reminder{
+		{
+			ID:         1,
+			UID:        "0190a0b0-0000-7000-8000-000000000001",
+			Owner:      "alice",
+			Title:      `say "hi", then; leave \ now`,
+			Message:    "line one\nline two, with a comma",
+			Status:     models.StatusPending,
+			DueAt:      due,
+			TimeZone:   "Europe/Paris",
+			Repeat:     &models.Recurrence{Rule: "FREQ=WEEKLY;BYDAY=MO", Start: due, Count: 5},
+			CreatedAt:  created,
+			ModifiedAt: created,
+		},
+		{
+			ID:          2,
+			Title:       "cron",
+			Message:     "m",
+			Status:      models.StatusCompleted,
+			DueAt:       due,
+			Repeat:      &models.Recurrence{Rule: "0 9 * * 1,3", Start: due, Until: &until},
+			CompletedAt: &completed,
+			CreatedAt:   created,
+			ModifiedAt:  completed,
+		},
+	}
+}
+
+// encode encodes the reminders in the given format
+func encode(t *testing.T, format string, reminders []models.Reminder) string {
+	t.Helper()
+	var b bytes.Buffer
+	enc, err := NewEncoder(&b, format)
+	if err != nil {
+		t.Fatalf("could not create encoder: %v", err)
+	}
+	for _, reminder := range reminders {
+		if err := enc.Encode(reminder); err != nil {
+			t.Fatalf("could not encode reminder: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("could not close encoder: %v", err)
+	}
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			want := testReminders()
+			got, err := Decode(strings.NewReader(encode(t, format, want)), format)
+			if err != nil {
+				t.Fatalf("could not decode reminders: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestEmptyExport(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV, FormatICS} {
+		got, err := Decode(strings.NewReader(encode(t, format, nil)), format)
+		if err != nil {
+			t.Errorf("%s: could not decode empty export: %v", format, err)
+		}
+		if len(got) != 0 {
+			t.Errorf("%s: expected no reminders, got %+v", format, got)
+		}
+	}
+}
+
+func TestDecodeCSVMatchesColumnsByHeader(t *testing.T) {
+	in := "Extra, Due_At ,title\nx,2030-01-02T09:00:00Z,\"a, \"\"quoted\"\"\nline\"\n"
+	got, err := Decode(strings.NewReader(in), FormatCSV)
+	if err != nil {
+		t.Fatalf("could not decode reminders: %v", err)
+	}
+	want := models.Reminder{Title: "a, \"quoted\"\nline", DueAt: time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeJSONObject(t *testing.T) {
+	in := `{"last_id": 3, "reminders": [{"id": 3, "title": "t"}], "after": true}`
+	got, err := Decode(strings.NewReader(in), FormatJSON)
+	if err != nil {
+		t.Fatalf("could not decode reminders: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("expected reminder 3, got %+v", got)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		in     string
+	}{
+		{"json not json", FormatJSON, "reminders"},
+		{"json scalar", FormatJSON, "42"},
+		{"json object without reminders", FormatJSON, `{"last_id": 3}`},
+		{"json invalid record", FormatJSON, `[{"id": "x"}]`},
+		{"json truncated", FormatJSON, `[{"id": 1}`},
+		{"csv without title", FormatCSV, "id,message\n1,m\n"},
+		{"csv unterminated quote", FormatCSV, "title\n\"t\n"},
+		{"csv invalid id", FormatCSV, "id,title\nx,t\n"},
+		{"csv invalid due_at", FormatCSV, "title,due_at\nt,tomorrow\n"},
+		{"csv invalid repeat_count", FormatCSV, "title,repeat,repeat_count\nt,0 9 * * *,x\n"},
+		{"ics line without colon", FormatICS, "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY\r\n"},
+		{"ics truncated", FormatICS, "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nDUE:20300102T090000Z\r\n"},
+		{"ics without due", FormatICS, "BEGIN:VTODO\r\nSUMMARY:t\r\nEND:VTODO\r\n"},
+		{"ics invalid due", FormatICS, "BEGIN:VTODO\r\nDUE:tomorrow\r\nEND:VTODO\r\n"},
+		{"ics invalid id", FormatICS, "BEGIN:VTODO\r\nDUE:20300102T090000Z\r\nX-REMINDERS-ID:x\r\nEND:VTODO\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.in), tt.format)
+			if _, ok := err.(models.FormatValidationError); !ok {
+				t.Errorf("expected a format validation error, got: %v", err)
+			}
+		})
+	}
+}
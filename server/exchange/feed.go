@@ -0,0 +1,82 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+const (
+	feedName = "Reminders"
+	// feedRefresh is how often calendar apps are asked to poll the feed
+	feedRefresh = "PT15M"
+)
+
+// FeedEncoder writes a subscribable iCalendar feed of reminder occurrences, as VEVENTs
+// every event has a VALARM which is triggered when it starts
+// the output only depends on the reminders, so an unchanged feed renders the same bytes
+type FeedEncoder struct {
+	icsWriter
+	header bool
+}
+
+// NewFeedEncoder creates a new instance of FeedEncoder
+func NewFeedEncoder(w io.Writer) *FeedEncoder {
+	return &FeedEncoder{icsWriter: icsWriter{w: bufio.NewWriter(w)}}
+}
+
+// Encode writes an occurrence of a reminder, which starts at the given time
+// occurrence is the number of the occurrence of a recurring reminder, which keeps
+// the uids of the events stable while the reminder moves on to its next occurrences
+func (e *FeedEncoder) Encode(reminder models.Reminder, start time.Time, occurrence int) error {
+	e.writeHeader()
+	uid := icsUID(reminder)
+	if reminder.Repeat != nil {
+		uid = fmt.Sprintf("%d-%s", occurrence, uid)
+	}
+	stamp := reminder.ModifiedAt
+	if stamp.IsZero() {
+		stamp = reminder.CreatedAt
+	}
+	e.line("BEGIN", "VEVENT")
+	e.line("UID", uid)
+	e.line("DTSTAMP", icsTime(stamp))
+	e.line("DTSTART", icsTime(start))
+	e.line("SUMMARY", icsEscape(reminder.Title))
+	e.line("DESCRIPTION", icsEscape(reminder.Message))
+	e.line("STATUS", "CONFIRMED")
+	e.line("TRANSP", "TRANSPARENT")
+	e.line("BEGIN", "VALARM")
+	e.line("ACTION", "DISPLAY")
+	e.line("DESCRIPTION", icsEscape(reminder.Title))
+	e.line("TRIGGER", "PT0S")
+	e.line("END", "VALARM")
+	e.line("END", "VEVENT")
+	return nil
+}
+
+// Close writes the end of the calendar and flushes it
+func (e *FeedEncoder) Close() error {
+	e.writeHeader()
+	e.line("END", "VCALENDAR")
+	return e.flush()
+}
+
+// writeHeader writes the calendar properties once
+func (e *FeedEncoder) writeHeader() {
+	if e.header {
+		return
+	}
+	e.header = true
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", icsProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	e.line("METHOD", "PUBLISH")
+	e.line("X-WR-CALNAME", feedName)
+	e.line("REFRESH-INTERVAL;VALUE=DURATION", feedRefresh)
+	e.line("X-PUBLISHED-TTL", feedRefresh)
+}
@@ -0,0 +1,421 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+const (
+	icsProdID     = "-//gophertuts//reminders-cli//EN"
+	icsTimeLayout = "20060102T150405Z"
+	icsLineLimit  = 75
+	// icsUIDDomain is the domain of the uids made up for the reminders which have none
+	icsUIDDomain = "reminders-cli"
+)
+
+var (
+	// icsUIDPattern matches the uids made up for the reminders which have none
+	icsUIDPattern = regexp.MustCompile(`^reminder-([0-9]+)@` + icsUIDDomain + `$`)
+	// uuidPattern matches the uids which are kept as reminder uids
+	// other apps use uids of any form, which are dropped
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// icsStatuses maps the reminder states to the VTODO ones
+// the exact state is kept in X-REMINDERS-STATUS
+var icsStatuses = map[models.Status]string{
+	models.StatusPending:   "NEEDS-ACTION",
+	models.StatusSnoozed:   "NEEDS-ACTION",
+	models.StatusNotifying: "IN-PROCESS",
+	models.StatusCompleted: "COMPLETED",
+	models.StatusCancelled: "CANCELLED",
+}
+
+// icsWriter writes the content lines of an iCalendar (RFC 5545) file
+type icsWriter struct {
+	w *bufio.Writer
+}
+
+// line writes a content line, folded to lines of at most 75 octets
+// (the leading space of the continuation lines included), never within a character
+// write errors are reported by the next flush
+func (w icsWriter) line(name, value string) {
+	l := name + ":" + value
+	limit := icsLineLimit
+	for len(l) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(l[cut]) {
+			cut--
+		}
+		_, _ = w.w.WriteString(l[:cut] + "\r\n ")
+		l = l[cut:]
+		limit = icsLineLimit - 1
+	}
+	_, _ = w.w.WriteString(l + "\r\n")
+}
+
+// flush writes the buffered lines
+func (w icsWriter) flush() error {
+	return w.w.Flush()
+}
+
+// icsEncoder writes the reminders as an iCalendar calendar of VTODOs
+// every reminder has a VALARM which is triggered when it is due
+type icsEncoder struct {
+	icsWriter
+	header bool
+}
+
+func newICSEncoder(w io.Writer) *icsEncoder {
+	return &icsEncoder{icsWriter: icsWriter{w: bufio.NewWriter(w)}}
+}
+
+func (e *icsEncoder) Encode(reminder models.Reminder) error {
+	e.writeHeader()
+	stamp := reminder.ModifiedAt
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	e.line("BEGIN", "VTODO")
+	e.line("UID", icsUID(reminder))
+	e.line("DTSTAMP", icsTime(stamp))
+	if !reminder.CreatedAt.IsZero() {
+		e.line("CREATED", icsTime(reminder.CreatedAt))
+	}
+	if !reminder.ModifiedAt.IsZero() {
+		e.line("LAST-MODIFIED", icsTime(reminder.ModifiedAt))
+	}
+	e.line("SUMMARY", icsEscape(reminder.Title))
+	e.line("DESCRIPTION", icsEscape(reminder.Message))
+	e.line("DUE", icsTime(reminder.Due()))
+	if status, ok := icsStatuses[reminder.Status]; ok {
+		e.line("STATUS", status)
+	}
+	if reminder.CompletedAt != nil {
+		e.line("COMPLETED", icsTime(*reminder.CompletedAt))
+	}
+	if reminder.Repeat != nil {
+		if rule, ok := icsRRule(*reminder.Repeat); ok {
+			e.line("RRULE", rule)
+		} else {
+			e.line("X-REMINDERS-CRON", icsEscape(reminder.Repeat.Rule))
+		}
+	}
+	if reminder.ID != 0 {
+		e.line("X-REMINDERS-ID", strconv.Itoa(reminder.ID))
+	}
+	if reminder.Status != "" {
+		e.line("X-REMINDERS-STATUS", string(reminder.Status))
+	}
+	if reminder.TimeZone != "" {
+		e.line("X-REMINDERS-TIME-ZONE", reminder.TimeZone)
+	}
+	if reminder.Owner != "" {
+		e.line("X-REMINDERS-OWNER", icsEscape(reminder.Owner))
+	}
+	e.line("BEGIN", "VALARM")
+	e.line("ACTION", "DISPLAY")
+	e.line("DESCRIPTION", icsEscape(reminder.Title))
+	e.line("TRIGGER;RELATED=END", "PT0S")
+	e.line("END", "VALARM")
+	e.line("END", "VTODO")
+	return e.flush()
+}
+
+func (e *icsEncoder) Close() error {
+	e.writeHeader()
+	e.line("END", "VCALENDAR")
+	return e.flush()
+}
+
+// writeHeader writes the calendar properties once
+func (e *icsEncoder) writeHeader() {
+	if e.header {
+		return
+	}
+	e.header = true
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", icsProdID)
+	e.line("CALSCALE", "GREGORIAN")
+}
+
+// icsUID retrieves the uid of a reminder, a uid is made up for the reminders which have none
+func icsUID(reminder models.Reminder) string {
+	if reminder.UID != "" {
+		return reminder.UID
+	}
+	return fmt.Sprintf("reminder-%d@%s", reminder.ID, icsUIDDomain)
+}
+
+// icsRRule retrieves the RRULE of a recurrence, with its end conditions
+// false is retrieved for cron expressions, which have no RRULE equivalent
+func icsRRule(repeat models.Recurrence) (string, bool) {
+	rule := strings.TrimPrefix(strings.TrimPrefix(repeat.Rule, "RRULE:"), "rrule:")
+	upper := strings.ToUpper(rule)
+	if !strings.Contains(upper, "FREQ=") {
+		return "", false
+	}
+	if repeat.Until != nil && !strings.Contains(upper, "UNTIL=") && !strings.Contains(upper, "COUNT=") {
+		rule += ";UNTIL=" + icsTime(*repeat.Until)
+	}
+	if repeat.Count > 0 && !strings.Contains(upper, "UNTIL=") && !strings.Contains(upper, "COUNT=") {
+		rule += ";COUNT=" + strconv.Itoa(repeat.Count)
+	}
+	return rule, true
+}
+
+// icsTime formats a time as an UTC DATE-TIME
+func icsTime(t time.Time) string {
+	return t.UTC().Format(icsTimeLayout)
+}
+
+// icsEscape escapes a TEXT value
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icsUnescape unescapes a TEXT value
+func icsUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// icsProperty represents a content line of an iCalendar file
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// decodeICS decodes the VTODOs of an iCalendar file, VEVENTs are decoded too
+// with their start as the due time, so calendars of other apps can be imported
+func decodeICS(r io.Reader) ([]models.Reminder, error) {
+	lines, err := icsLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var reminders []models.Reminder
+	var component []icsProperty
+	depth := 0
+	inside := false
+	for _, l := range lines {
+		p, err := parseICSLine(l)
+		if err != nil {
+			return nil, formatError("invalid icalendar line '%s': %v", l, err)
+		}
+		switch {
+		case p.name == "BEGIN" && (p.value == "VTODO" || p.value == "VEVENT") && !inside:
+			inside = true
+			depth = 0
+			component = []icsProperty{p}
+		case !inside:
+		case p.name == "BEGIN":
+			depth++
+		case p.name == "END" && depth > 0:
+			depth--
+		case p.name == "END":
+			inside = false
+			reminder, err := decodeICSComponent(component)
+			if err != nil {
+				return nil, formatError("record %d is invalid: %v", len(reminders)+1, err)
+			}
+			reminders = append(reminders, reminder)
+		case depth == 0:
+			component = append(component, p)
+		}
+	}
+	if inside {
+		return nil, formatError("icalendar file is truncated after record %d", len(reminders))
+	}
+	return reminders, nil
+}
+
+// decodeICSComponent decodes the properties of a single VTODO or VEVENT
+func decodeICSComponent(props []icsProperty) (models.Reminder, error) {
+	var reminder models.Reminder
+	var status, rrule, dtstart, tzid string
+	var err error
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			if m := icsUIDPattern.FindStringSubmatch(p.value); m != nil {
+				reminder.ID, _ = strconv.Atoi(m[1])
+			} else if uuidPattern.MatchString(p.value) {
+				reminder.UID = p.value
+			}
+		case "SUMMARY":
+			reminder.Title = icsUnescape(p.value)
+		case "DESCRIPTION":
+			reminder.Message = icsUnescape(p.value)
+		case "DUE":
+			reminder.DueAt, err = parseICSTime(p)
+			tzid = p.params["TZID"]
+		case "DTSTART":
+			if dtstart == "" {
+				dtstart = p.value
+				if reminder.DueAt.IsZero() {
+					reminder.DueAt, err = parseICSTime(p)
+					tzid = p.params["TZID"]
+				}
+			}
+		case "CREATED":
+			reminder.CreatedAt, err = parseICSTime(p)
+		case "LAST-MODIFIED":
+			reminder.ModifiedAt, err = parseICSTime(p)
+		case "COMPLETED":
+			var t time.Time
+			if t, err = parseICSTime(p); err == nil {
+				reminder.CompletedAt = &t
+			}
+		case "STATUS":
+			if status == "" {
+				status = p.value
+			}
+		case "X-REMINDERS-STATUS":
+			status = p.value
+		case "RRULE":
+			rrule = p.value
+		case "X-REMINDERS-CRON":
+			rrule = icsUnescape(p.value)
+		case "X-REMINDERS-ID":
+			if reminder.ID, err = strconv.Atoi(p.value); err != nil {
+				err = fmt.Errorf("invalid X-REMINDERS-ID '%s'", p.value)
+			}
+		case "X-REMINDERS-TIME-ZONE":
+			reminder.TimeZone = p.value
+		case "X-REMINDERS-OWNER":
+			reminder.Owner = icsUnescape(p.value)
+		}
+		if err != nil {
+			return models.Reminder{}, fmt.Errorf("invalid %s: %v", p.name, err)
+		}
+	}
+	if reminder.DueAt.IsZero() {
+		return models.Reminder{}, fmt.Errorf("%s has no DUE or DTSTART", props[0].value)
+	}
+	if reminder.Message == "" {
+		reminder.Message = reminder.Title
+	}
+	// the time zone of the due time, unless the exact one was exported
+	if reminder.TimeZone == "" {
+		reminder.TimeZone = tzid
+	}
+	reminder.Status = icsStatus(status)
+	if rrule != "" {
+		reminder.Repeat = &models.Recurrence{Rule: rrule, Start: reminder.DueAt}
+	}
+	return reminder, nil
+}
+
+// icsStatus maps an iCalendar status, or an exact X-REMINDERS-STATUS, to a reminder state
+func icsStatus(status string) models.Status {
+	if s := models.Status(status); s.Valid() {
+		return s
+	}
+	switch status {
+	case "COMPLETED":
+		return models.StatusCompleted
+	case "CANCELLED":
+		return models.StatusCancelled
+	default:
+		return models.StatusPending
+	}
+}
+
+// icsLines reads the content lines of an iCalendar file, unfolding them
+func icsLines(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, formatError("could not read icalendar file: %v", err)
+	}
+	return lines, nil
+}
+
+// parseICSLine parses a content line: NAME;PARAM=VALUE;...:VALUE
+// colons and semicolons inside quoted parameter values are not separators
+func parseICSLine(l string) (icsProperty, error) {
+	quoted := false
+	colon := -1
+	for i, c := range l {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icsProperty{}, fmt.Errorf("missing ':'")
+	}
+	p := icsProperty{value: l[colon+1:], params: map[string]string{}}
+	parts := strings.Split(l[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return p, nil
+}
+
+// parseICSTime parses a DATE-TIME (UTC, in a TZID or floating) or a DATE value
+// floating times and dates are taken in the server local time, TZIDs must be IANA time zones
+func parseICSTime(p icsProperty) (time.Time, error) {
+	loc := time.Local
+	if tzid := p.params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID '%s'", tzid)
+		}
+		loc = l
+	}
+	switch {
+	case strings.HasSuffix(p.value, "Z"):
+		return time.Parse(icsTimeLayout, p.value)
+	case len(p.value) == len("20060102"):
+		return time.ParseInLocation("20060102", p.value, loc)
+	default:
+		return time.ParseInLocation("20060102T150405", p.value, loc)
+	}
+}
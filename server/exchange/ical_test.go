@@ -0,0 +1,155 @@
+package exchange
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+func TestICSEscape(t *testing.T) {
+	in := "a\\b;c,d\r\ne\nf"
+	escaped := icsEscape(in)
+	if want := `a\\b\;c\,d\ne\nf`; escaped != want {
+		t.Errorf("expected %q, got %q", want, escaped)
+	}
+	if got, want := icsUnescape(escaped), "a\\b;c,d\ne\nf"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := icsUnescape(`\N trailing \`); got != "\n trailing \\" {
+		t.Errorf("expected an upper case \\N & a trailing backslash to be kept, got %q", got)
+	}
+}
+
+func TestICSFolding(t *testing.T) {
+	reminder := testReminders()[0]
+	// multibyte characters across every possible cut
+	reminder.Title = strings.Repeat("é€😀a", 40)
+	out := encode(t, FormatICS, []models.Reminder{reminder})
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(l) > icsLineLimit {
+			t.Errorf("expected lines of at most %d octets, got %d: %q", icsLineLimit, len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("expected lines to never be folded within a character: %q", l)
+		}
+	}
+	got, err := Decode(strings.NewReader(out), FormatICS)
+	if err != nil {
+		t.Fatalf("could not decode reminders: %v", err)
+	}
+	if len(got) != 1 || got[0].Title != reminder.Title {
+		t.Errorf("expected title %q, got %+v", reminder.Title, got)
+	}
+}
+
+func TestICSRoundTrip(t *testing.T) {
+	reminders := testReminders()
+	out := encode(t, FormatICS, reminders)
+	if !strings.Contains(out, "\r\nRRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=5\r\n") {
+		t.Errorf("expected the count to be added to the RRULE:\n%s", out)
+	}
+	if !strings.Contains(out, "\r\nX-REMINDERS-CRON:0 9 * * 1\\,3\r\n") {
+		t.Errorf("expected the cron expression to be escaped in X-REMINDERS-CRON:\n%s", out)
+	}
+	got, err := Decode(strings.NewReader(out), FormatICS)
+	if err != nil {
+		t.Fatalf("could not decode reminders: %v", err)
+	}
+	if len(got) != len(reminders) {
+		t.Fatalf("expected %d reminders, got %d", len(reminders), len(got))
+	}
+	rules := []string{"FREQ=WEEKLY;BYDAY=MO;COUNT=5", "0 9 * * 1,3"}
+	for i, want := range reminders {
+		g := got[i]
+		if g.ID != want.ID || g.UID != want.UID || g.Owner != want.Owner || g.TimeZone != want.TimeZone {
+			t.Errorf("reminder %d: expected %+v, got %+v", i, want, g)
+		}
+		if g.Title != want.Title || g.Message != want.Message || g.Status != want.Status {
+			t.Errorf("reminder %d: expected %q, %q & %s, got %q, %q & %s",
+				i, want.Title, want.Message, want.Status, g.Title, g.Message, g.Status)
+		}
+		if !g.DueAt.Equal(want.DueAt) || !g.CreatedAt.Equal(want.CreatedAt) || !g.ModifiedAt.Equal(want.ModifiedAt) {
+			t.Errorf("reminder %d: expected the times of %+v, got %+v", i, want, g)
+		}
+		if g.Repeat == nil || g.Repeat.Rule != rules[i] || !g.Repeat.Start.Equal(want.DueAt) {
+			t.Errorf("reminder %d: expected rule %q, got %+v", i, rules[i], g.Repeat)
+		}
+	}
+	if got[1].CompletedAt == nil || !got[1].CompletedAt.Equal(*reminders[1].CompletedAt) {
+		t.Errorf("expected completed at %v, got %v", reminders[1].CompletedAt, got[1].CompletedAt)
+	}
+}
+
+func TestICSUntil(t *testing.T) {
+	until := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		repeat models.Recurrence
+		want   string
+	}{
+		{models.Recurrence{Rule: "RRULE:FREQ=DAILY", Until: &until}, "FREQ=DAILY;UNTIL=20300601T000000Z"},
+		// the end of the rule itself wins
+		{models.Recurrence{Rule: "FREQ=DAILY;COUNT=2", Until: &until, Count: 3}, "FREQ=DAILY;COUNT=2"},
+	}
+	for _, tt := range tests {
+		if got, ok := icsRRule(tt.repeat); !ok || got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestICSTZID(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone America/New_York is not available: %v", err)
+	}
+	tests := []struct {
+		name string
+		in   string
+		due  time.Time
+		tz   string
+	}{
+		{
+			"due",
+			"BEGIN:VTODO\r\nDUE;TZID=America/New_York:20300102T090000\r\nEND:VTODO\r\n",
+			time.Date(2030, 1, 2, 9, 0, 0, 0, ny),
+			"America/New_York",
+		},
+		{
+			"quoted event start",
+			"BEGIN:VEVENT\r\nDTSTART;TZID=\"America/New_York\":20300102T090000\r\nEND:VEVENT\r\n",
+			time.Date(2030, 1, 2, 9, 0, 0, 0, ny),
+			"America/New_York",
+		},
+		{
+			"exported time zone",
+			"BEGIN:VTODO\r\nDUE;TZID=America/New_York:20300102T090000\r\nX-REMINDERS-TIME-ZONE:Asia/Tokyo\r\nEND:VTODO\r\n",
+			time.Date(2030, 1, 2, 9, 0, 0, 0, ny),
+			"Asia/Tokyo",
+		},
+		{
+			"utc",
+			"BEGIN:VTODO\r\nDUE:20300102T090000Z\r\nEND:VTODO\r\n",
+			time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC),
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(tt.in), FormatICS)
+			if err != nil {
+				t.Fatalf("could not decode reminders: %v", err)
+			}
+			if len(got) != 1 || !got[0].DueAt.Equal(tt.due) || got[0].TimeZone != tt.tz {
+				t.Errorf("expected due at %v in '%s', got %+v", tt.due, tt.tz, got)
+			}
+		})
+	}
+
+	in := "BEGIN:VTODO\r\nDUE;TZID=Mars/Olympus:20300102T090000\r\nEND:VTODO\r\n"
+	if _, err := Decode(strings.NewReader(in), FormatICS); err == nil {
+		t.Error("expected an unknown TZID to be rejected")
+	}
+}
@@ -0,0 +1,88 @@
+package exchange
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// jsonEncoder writes the reminders as a json array, one reminder per line
+type jsonEncoder struct {
+	w       io.Writer
+	written int
+}
+
+func (e *jsonEncoder) Encode(reminder models.Reminder) error {
+	bs, err := json.Marshal(reminder)
+	if err != nil {
+		return models.WrapError("could not marshal reminder", err)
+	}
+	sep := ",\n"
+	if e.written == 0 {
+		sep = "[\n"
+	}
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(bs); err != nil {
+		return err
+	}
+	e.written++
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if e.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// decodeJSON decodes a json array of reminders, or the reminders of
+// an object holding them under 'reminders' (such as db.json)
+func decodeJSON(r io.Reader) ([]models.Reminder, error) {
+	dec := json.NewDecoder(r)
+	t, err := dec.Token()
+	if err != nil {
+		return nil, formatError("invalid json: %v", err)
+	}
+	if t == json.Delim('{') {
+		for {
+			if !dec.More() {
+				return nil, formatError("json object holds no reminders array")
+			}
+			key, err := dec.Token()
+			if err != nil {
+				return nil, formatError("invalid json: %v", err)
+			}
+			if key == "reminders" {
+				break
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, formatError("invalid json: %v", err)
+			}
+		}
+		if t, err = dec.Token(); err != nil {
+			return nil, formatError("invalid json: %v", err)
+		}
+	}
+	if t != json.Delim('[') {
+		return nil, formatError("expected a json array of reminders")
+	}
+	var reminders []models.Reminder
+	for dec.More() {
+		var reminder models.Reminder
+		if err := dec.Decode(&reminder); err != nil {
+			return nil, formatError("record %d is invalid: %v", len(reminders)+1, err)
+		}
+		reminders = append(reminders, reminder)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, formatError("json array is truncated after record %d", len(reminders))
+	}
+	return reminders, nil
+}
@@ -0,0 +1,292 @@
+// Package metrics keeps the server metrics in memory and writes them
+// in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds (in seconds) of the latency histograms
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric represents a metric family, which can be written to a registry
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry represents a set of metrics, written in registration order
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// Default is the registry the metrics are created in
+var Default = &Registry{}
+
+// register adds a metric to the registry, it panics when the name is already taken
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names == nil {
+		r.names = map[string]bool{}
+	}
+	if r.names[m.name()] {
+		panic(fmt.Sprintf("metric %s is already registered", m.name()))
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes all the metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// desc represents the name, help & label names of a metric family
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+// header writes the HELP & TYPE lines of a metric family
+func (d desc) header(w *bufio.Writer, kind string) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, kind)
+}
+
+// key joins label values into a series key, it panics when the number of values is wrong
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label value(s), got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series writes a sample line, extra is an extra label pair (e.g. the le of a bucket)
+func (d desc) series(w *bufio.Writer, suffix, key string, extra []string, v float64) {
+	w.WriteString(d.metricName + suffix)
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escape(value)+`"`)
+		}
+	}
+	if extra != nil {
+		pairs = append(pairs, extra[0]+`="`+escape(extra[1])+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+// Counter represents a counter, optionally partitioned by labels
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates a new counter in the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, labels}, values: map[string]float64{}}
+	Default.register(c)
+	return c
+}
+
+// Inc increments the counter of the label values by one
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter of the label values, v must not be negative
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.metricName))
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		c.series(w, "", "", nil, 0)
+	}
+	for _, key := range sortedKeys(c.values) {
+		c.series(w, "", key, nil, c.values[key])
+	}
+}
+
+// Gauge represents a value which goes up & down
+type Gauge struct {
+	desc
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a new gauge in the default registry
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{metricName: name, help: help}}
+	Default.register(g)
+	return g
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series(w, "", "", nil, g.value)
+}
+
+// Histogram represents a histogram of observed values, optionally partitioned by labels
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValues
+}
+
+// histogramValues represents the bucket counts, the sum & the count of the values of a series
+type histogramValues struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a new histogram in the default registry
+// buckets are the upper bounds of the buckets, in ascending order
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		values:  map[string]*histogramValues{},
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe adds a value to the histogram of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValues{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	// the counts are per bucket, they are only made cumulative when written
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.labels) == 0 && len(h.values) == 0 {
+		h.values[""] = &histogramValues{counts: make([]uint64, len(h.buckets))}
+	}
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			h.series(w, "_bucket", key, []string{"le", formatFloat(upper)}, float64(cumulative))
+		}
+		h.series(w, "_bucket", key, []string{"le", "+Inf"}, float64(hv.count))
+		h.series(w, "_sum", key, nil, hv.sum)
+		h.series(w, "_count", key, nil, float64(hv.count))
+	}
+}
+
+// sortedKeys retrieves the series keys in order, so the output is stable
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]float64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramValues:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape escapes a label value
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter represents a writer which counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestRegistry creates metrics of every kind in a registry of their own,
+// so the default one is left alone
+func newTestRegistry() (*Registry, *Counter, *Counter, *Gauge, *Histogram) {
+	r := &Registry{}
+	requests := &Counter{desc: desc{"test_requests_total", "Requests.\nBy \\ path", []string{"path", "code"}}, values: map[string]float64{}}
+	errs := &Counter{desc: desc{metricName: "test_errors_total", help: "Errors."}, values: map[string]float64{}}
+	pending := &Gauge{desc: desc{metricName: "test_pending", help: "Pending."}}
+	latency := &Histogram{
+		desc:    desc{"test_latency_seconds", "Latency.", []string{"path"}},
+		buckets: []float64{.125, 1},
+		values:  map[string]*histogramValues{},
+	}
+	r.register(requests)
+	r.register(errs)
+	r.register(pending)
+	r.register(latency)
+	return r, requests, errs, pending, latency
+}
+
+func TestExposition(t *testing.T) {
+	r, requests, _, pending, latency := newTestRegistry()
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc("a\"b\\c\nd", "404")
+	pending.Set(-1.5)
+	// the upper bounds are inclusive, values beyond the last one only count in +Inf
+	for _, v := range []float64{.0625, .125, .5, 3} {
+		latency.Observe(v, "/a")
+	}
+	latency.Observe(2, "/")
+
+	want := `# HELP test_requests_total Requests.\nBy \\ path
+# TYPE test_requests_total counter
+test_requests_total{path="/a",code="200"} 2
+test_requests_total{path="/b",code="200"} 1
+test_requests_total{path="a\"b\\c\nd",code="404"} 1
+# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_pending Pending.
+# TYPE test_pending gauge
+test_pending -1.5
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{path="/",le="0.125"} 0
+test_latency_seconds_bucket{path="/",le="1"} 0
+test_latency_seconds_bucket{path="/",le="+Inf"} 1
+test_latency_seconds_sum{path="/"} 2
+test_latency_seconds_count{path="/"} 1
+test_latency_seconds_bucket{path="/a",le="0.125"} 2
+test_latency_seconds_bucket{path="/a",le="1"} 3
+test_latency_seconds_bucket{path="/a",le="+Inf"} 4
+test_latency_seconds_sum{path="/a"} 3.6875
+test_latency_seconds_count{path="/a"} 4
+`
+	var b bytes.Buffer
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("could not write metrics: %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("expected %d bytes to be written, got %d", b.Len(), n)
+	}
+}
+
+func TestExpositionOfEmptyMetrics(t *testing.T) {
+	r, _, _, _, _ := newTestRegistry()
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("could not write metrics: %v", err)
+	}
+	got := b.String()
+	// labelled metrics have no series until they are used, the other ones start at zero
+	if strings.Contains(got, "test_requests_total{") || strings.Contains(got, "test_latency_seconds_bucket") {
+		t.Errorf("expected no series of the labelled metrics, got:\n%s", got)
+	}
+	for _, want := range []string{"\ntest_errors_total 0\n", "\ntest_pending 0\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q, got:\n%s", want, got)
+		}
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteToReportsErrors(t *testing.T) {
+	r, _, _, _, _ := newTestRegistry()
+	if _, err := r.WriteTo(failingWriter{}); err == nil {
+		t.Error("expected the write error to be retrieved")
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gophertuts/reminders-cli/server/auth"
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/transport"
+)
+
+// Authenticate checks that every request carries a bearer token of the keyring with the given scope
+// the authenticated token is stored in the request context
+// requests are not checked while the keyring is disabled
+func Authenticate(keyring *auth.Keyring, scope string) func(h http.Handler) http.Handler {
+	return authenticate(keyring, scope, "missing bearer token", bearerToken)
+}
+
+// AuthenticateQuery works like Authenticate, but also takes the token from a query parameter
+// when there is no bearer token, for clients which can not send headers (e.g. calendar apps)
+func AuthenticateQuery(keyring *auth.Keyring, scope, param string) func(h http.Handler) http.Handler {
+	return authenticate(keyring, scope, "missing bearer token or "+param+" parameter", func(r *http.Request) string {
+		if secret := bearerToken(r); secret != "" {
+			return secret
+		}
+		return strings.TrimSpace(r.URL.Query().Get(param))
+	})
+}
+
+// authenticate checks the token which secret retrieves from every request
+func authenticate(keyring *auth.Keyring, scope, missing string, secret func(r *http.Request) string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !keyring.Enabled() {
+				h.ServeHTTP(w, r)
+				return
+			}
+			secret := secret(r)
+			if secret == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="reminders"`)
+				transport.SendError(w, models.UnauthorizedError{Message: missing})
+				return
+			}
+			token, ok := keyring.Authenticate(secret)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="reminders", error="invalid_token"`)
+				transport.SendError(w, models.UnauthorizedError{Message: "invalid or revoked token"})
+				return
+			}
+			if !token.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="reminders", error="insufficient_scope", scope="%s"`, scope))
+				transport.SendError(w, models.ForbiddenError{
+					Message: fmt.Sprintf("token: %s does not have the '%s' scope", token.Name, scope),
+				})
+				return
+			}
+			h.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// bearerToken retrieves the token of the Authorization header
+func bearerToken(r *http.Request) string {
+	const prefix = "bearer "
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter(
+		"reminders_http_requests_total",
+		"Number of HTTP requests by route, method & status code",
+		"route", "method", "code",
+	)
+	httpDuration = metrics.NewHistogram(
+		"reminders_http_request_duration_seconds",
+		"Latency of the HTTP requests by route & method (event streams last until they disconnect)",
+		metrics.DefaultBuckets,
+		"route", "method",
+	)
+)
+
+// Metrics counts & times every request by the route it matched, which is retrieved by route
+func Metrics(route func(r *http.Request) string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			begin := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(sw, r)
+			name := route(r)
+			httpRequests.Inc(name, r.Method, strconv.Itoa(sw.status))
+			httpDuration.Observe(time.Since(begin).Seconds(), name, r.Method)
+		})
+	}
+}
+
+// statusWriter represents a response writer which records the status code
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status, sw.wroteHeader = status, true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(bs []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(bs)
+}
+
+// Flush flushes the response, so event streams keep working behind the middleware
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
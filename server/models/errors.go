@@ -56,6 +56,46 @@ func (e NotFoundError) Error() string {
 	return e.Message
 }
 
+// ConflictError represents the error returned when a request conflicts
+// with the current state of a resource
+type ConflictError struct {
+	Message string
+}
+
+func (e ConflictError) Error() string {
+	return e.Message
+}
+
+// UnauthorizedError represents the error returned when a request
+// does not carry valid credentials for the resource
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.Message
+}
+
+// ForbiddenError represents the error returned when the credentials of a request
+// are valid, but do not give access to the resource
+type ForbiddenError struct {
+	Message string
+}
+
+func (e ForbiddenError) Error() string {
+	return e.Message
+}
+
+// MethodNotAllowedError represents the error returned when a resource
+// does not support the method of the request
+type MethodNotAllowedError struct {
+	Message string
+}
+
+func (e MethodNotAllowedError) Error() string {
+	return e.Message
+}
+
 // WrapError wraps a plain error into a custom error
 func WrapError(customErr string, originalErr error) error {
 	err := fmt.Errorf("%s: %v", customErr, originalErr)
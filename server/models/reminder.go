@@ -2,12 +2,75 @@ package models
 
 import "time"
 
+// Status represents the lifecycle state of a reminder
+type Status string
+
+// reminder lifecycle states
+const (
+	StatusPending   Status = "pending"
+	StatusNotifying Status = "notifying"
+	StatusSnoozed   Status = "snoozed"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Active reports whether a reminder in this state still has to be notified
+func (s Status) Active() bool {
+	return s == StatusPending || s == StatusNotifying || s == StatusSnoozed
+}
+
+// Valid reports whether the status is one of the known lifecycle states
+func (s Status) Valid() bool {
+	return s.Active() || s == StatusCompleted || s == StatusCancelled
+}
+
+// DefaultOwner owns the reminders when API tokens are disabled,
+// and the ones which were stored before reminders had owners
+const DefaultOwner = "default"
+
 // Reminder represents the reminder data structure
 type Reminder struct {
-	ID         int           `json:"id"`
-	Title      string        `json:"title"`
-	Message    string        `json:"message"`
-	Duration   time.Duration `json:"duration"`
-	CreatedAt  time.Time     `json:"created_at"`
-	ModifiedAt time.Time     `json:"modified_at"`
+	ID          int           `json:"id"`
+	UID         string        `json:"uid,omitempty"`
+	Owner       string        `json:"owner,omitempty"`
+	Title       string        `json:"title"`
+	Message     string        `json:"message"`
+	Duration    time.Duration `json:"duration"`
+	DueAt       time.Time     `json:"due_at"`
+	TimeZone    string        `json:"time_zone,omitempty"`
+	Repeat      *Recurrence   `json:"repeat,omitempty"`
+	Status      Status        `json:"status"`
+	NotifiedAt  *time.Time    `json:"notified_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	Missed      *Missed       `json:"missed,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	ModifiedAt  time.Time     `json:"modified_at"`
+}
+
+// Due retrieves the time at which the reminder is due
+// records which were saved before due_at existed only have a duration,
+// which is counted from the last modification time
+func (r Reminder) Due() time.Time {
+	if !r.DueAt.IsZero() {
+		return r.DueAt
+	}
+	return r.ModifiedAt.Add(r.Duration)
+}
+
+// Recurrence represents the schedule of a recurring reminder
+// Rule is either an RFC 5545 RRULE subset or a 5-field cron expression
+// and Start is the first occurrence which the rule is anchored to
+type Recurrence struct {
+	Rule        string     `json:"rule"`
+	Start       time.Time  `json:"start"`
+	Until       *time.Time `json:"until,omitempty"`
+	Count       int        `json:"count,omitempty"`
+	Occurrences int        `json:"occurrences"`
+}
+
+// Missed represents how a reminder which came due while the server was down was handled
+type Missed struct {
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	HandledAt time.Time `json:"handled_at"`
 }
@@ -0,0 +1,178 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField represents the allowed values of a single cron expression field
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{
+		name: "month",
+		min:  1,
+		max:  12,
+		names: map[string]int{
+			"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+			"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+		},
+	}
+	dowField = cronField{
+		name: "day of week",
+		min:  0,
+		max:  7,
+		names: map[string]int{
+			"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+		},
+	}
+)
+
+// cron represents a parsed 5-field cron expression
+// each field is a bit set of its allowed values
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// parseCron parses a 5-field cron expression: minute hour day-of-month month day-of-week
+func parseCron(expr string) (Rule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Rule{}, fmt.Errorf("cron expression '%s' must have 5 fields", expr)
+	}
+	var c cron
+	var err error
+	if c.minute, err = minuteField.parse(fields[0]); err != nil {
+		return Rule{}, err
+	}
+	if c.hour, err = hourField.parse(fields[1]); err != nil {
+		return Rule{}, err
+	}
+	if c.dom, err = domField.parse(fields[2]); err != nil {
+		return Rule{}, err
+	}
+	if c.month, err = monthField.parse(fields[3]); err != nil {
+		return Rule{}, err
+	}
+	if c.dow, err = dowField.parse(fields[4]); err != nil {
+		return Rule{}, err
+	}
+	// 7 is an alias for sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return Rule{next: c.next}, nil
+}
+
+// parse parses a comma separated list of values, ranges and steps
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step in '%s'", f.name, s)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid %s range in '%s'", f.name, s)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single numeric or named field value
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s value '%s'", f.name, s)
+	}
+	return v, nil
+}
+
+// matchesDay reports whether the day of t matches the expression
+// like in classic cron, restricted day of month & day of week fields are OR-ed
+func (c cron) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next retrieves the first matching minute strictly after the given time
+// wall clock times skipped by a DST gap never match, like in many crons
+func (c cron) next(start, after time.Time) time.Time {
+	loc := start.Location()
+	t := after.In(loc).Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < maxIterations; i++ {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		// a wall clock time repeated by a DST overlap only matches once, like in classic cron
+		if w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc); !w.Equal(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,71 @@
+package recurrence
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxIterations bounds the search for the next occurrence of a rule
+// which can never match again (e.g. cron '0 0 31 2 *')
+const maxIterations = 100000
+
+// Rule represents a parsed recurrence rule
+// either an RFC 5545 RRULE subset or a 5-field cron expression
+type Rule struct {
+	// Count is the number of occurrences after which the rule ends, 0 meaning no limit
+	Count int
+	// Until is the time after which the rule ends, zero meaning no end
+	// a floating UNTIL is parsed as UTC, see UntilIn
+	Until         time.Time
+	floatingUntil bool
+	next          func(start, after time.Time) time.Time
+}
+
+// Parse parses a recurrence rule, RRULEs are recognised by their FREQ part
+// all the other rules are treated as cron expressions
+func Parse(rule string) (Rule, error) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return Rule{}, fmt.Errorf("recurrence rule cannot be empty")
+	}
+	upper := strings.ToUpper(rule)
+	if strings.HasPrefix(upper, "RRULE:") || strings.Contains(upper, "FREQ=") {
+		return parseRRule(rule)
+	}
+	return parseCron(rule)
+}
+
+// Next retrieves the first occurrence strictly after the given time
+// start is the first occurrence of the rule and defines its time zone
+// the zero time is returned when the rule has no more occurrences
+func (r Rule) Next(start, after time.Time) time.Time {
+	next := r.next(start, after)
+	if until := r.UntilIn(start.Location()); next.IsZero() || (!until.IsZero() && next.After(until)) {
+		return time.Time{}
+	}
+	return next
+}
+
+// UntilIn retrieves the end of the rule for occurrences in the given time zone:
+// a floating UNTIL is a wall clock time in the time zone of the occurrences
+func (r Rule) UntilIn(loc *time.Location) time.Time {
+	if !r.floatingUntil {
+		return r.Until
+	}
+	u := r.Until
+	return time.Date(u.Year(), u.Month(), u.Day(), u.Hour(), u.Minute(), u.Second(), u.Nanosecond(), loc)
+}
+
+// date is like time.Date, except for a wall clock time skipped by a DST gap:
+// it is moved forward by the length of the gap like in RFC 5545, where time.Date moves it backward
+func date(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, nsec, loc)
+	wall := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+	if t.Hour() == wall.Hour() && t.Minute() == wall.Minute() {
+		return t
+	}
+	// t is in the zone from before the gap, whose offset applies to the skipped time
+	_, offset := t.Zone()
+	return wall.Add(-time.Duration(offset) * time.Second).In(loc)
+}
@@ -0,0 +1,246 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// occurrences retrieves the n first occurrences of a rule after its start
+// fewer are returned when the rule ends before
+func occurrences(t *testing.T, rule string, start time.Time, n int) []time.Time {
+	t.Helper()
+	r, err := Parse(rule)
+	if err != nil {
+		t.Fatalf("could not parse '%s': %v", rule, err)
+	}
+	var res []time.Time
+	for after := start; len(res) < n; {
+		next := r.Next(start, after)
+		if next.IsZero() {
+			break
+		}
+		res = append(res, next)
+		after = next
+	}
+	return res
+}
+
+func checkOccurrences(t *testing.T, got []time.Time, want []string, loc *time.Location) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d occurrences, got %d: %v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		wt, err := time.ParseInLocation("2006-01-02 15:04", w, loc)
+		if err != nil {
+			t.Fatalf("invalid expected time '%s': %v", w, err)
+		}
+		if !got[i].Equal(wt) {
+			t.Errorf("occurrence %d: expected %v, got %v", i, wt, got[i])
+		}
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s is not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestRRuleOccurrences(t *testing.T) {
+	// monday
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rule string
+		want []string
+	}{
+		{"daily", "FREQ=DAILY", []string{"2024-01-02 09:00", "2024-01-03 09:00"}},
+		{"rrule prefix", "RRULE:FREQ=DAILY;INTERVAL=3", []string{"2024-01-04 09:00", "2024-01-07 09:00"}},
+		{"daily by day", "FREQ=DAILY;BYDAY=SA,SU", []string{"2024-01-06 09:00", "2024-01-07 09:00", "2024-01-13 09:00"}},
+		{
+			"weekly by day every other week",
+			"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			[]string{"2024-01-05 09:00", "2024-01-15 09:00", "2024-01-19 09:00", "2024-01-29 09:00"},
+		},
+		{"monthly", "FREQ=MONTHLY", []string{"2024-02-01 09:00", "2024-03-01 09:00"}},
+		{"second tuesday", "FREQ=MONTHLY;BYDAY=2TU", []string{"2024-01-09 09:00", "2024-02-13 09:00", "2024-03-12 09:00"}},
+		{"last friday", "FREQ=MONTHLY;BYDAY=-1FR", []string{"2024-01-26 09:00", "2024-02-23 09:00", "2024-03-29 09:00"}},
+		{"every monday of the month", "FREQ=MONTHLY;BYDAY=MO", []string{"2024-01-08 09:00", "2024-01-15 09:00"}},
+		{
+			"friday the 13th",
+			"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+			[]string{"2024-09-13 09:00", "2024-12-13 09:00", "2025-06-13 09:00"},
+		},
+		{
+			"last day of the month",
+			"FREQ=MONTHLY;BYMONTHDAY=-1",
+			[]string{"2024-01-31 09:00", "2024-02-29 09:00", "2024-03-31 09:00", "2024-04-30 09:00"},
+		},
+		{"31st skips short months", "FREQ=MONTHLY;BYMONTHDAY=31", []string{"2024-01-31 09:00", "2024-03-31 09:00", "2024-05-31 09:00"}},
+		{"yearly", "FREQ=YEARLY", []string{"2025-01-01 09:00", "2026-01-01 09:00"}},
+		{"until utc", "FREQ=DAILY;UNTIL=20240103T090000Z", []string{"2024-01-02 09:00", "2024-01-03 09:00"}},
+		{"until date", "FREQ=DAILY;UNTIL=20240103", []string{"2024-01-02 09:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := len(tt.want)
+			if strings.Contains(tt.rule, "UNTIL") {
+				// making sure there are no more
+				n++
+			}
+			checkOccurrences(t, occurrences(t, tt.rule, start, n), tt.want, time.UTC)
+		})
+	}
+}
+
+func TestRRuleLeapDay(t *testing.T) {
+	start := time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	got := occurrences(t, "FREQ=YEARLY", start, 1)
+	checkOccurrences(t, got, []string{"2028-02-29 09:00"}, time.UTC)
+}
+
+func TestRRuleEnd(t *testing.T) {
+	r, err := Parse("FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3")
+	if err != nil {
+		t.Fatalf("could not parse rule: %v", err)
+	}
+	if r.Count != 3 || !r.Until.IsZero() {
+		t.Errorf("expected count 3 without until, got count %d & until %v", r.Count, r.Until)
+	}
+
+	// a floating UNTIL is a wall clock time in the time zone of the occurrences
+	ny := mustLoadLocation(t, "America/New_York")
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, ny)
+	got := occurrences(t, "FREQ=DAILY;UNTIL=20240103T090000", start, 3)
+	checkOccurrences(t, got, []string{"2024-01-02 09:00", "2024-01-03 09:00"}, ny)
+
+	r, err = Parse("FREQ=DAILY;UNTIL=20240103T090000Z")
+	if err != nil {
+		t.Fatalf("could not parse rule: %v", err)
+	}
+	want := time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)
+	if until := r.UntilIn(ny); !until.Equal(want) {
+		t.Errorf("expected a utc until to stay %v, got %v", want, until)
+	}
+}
+
+func TestRRuleDST(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+
+	// 2024-03-10 02:30 does not exist in new york, that day is due an hour later
+	start := time.Date(2024, 3, 9, 2, 30, 0, 0, ny)
+	got := occurrences(t, "FREQ=DAILY", start, 2)
+	checkOccurrences(t, got, []string{"2024-03-10 03:30", "2024-03-11 02:30"}, ny)
+
+	// 2024-11-03 01:30 happens twice in new york, a daily rule is only due once
+	start = time.Date(2024, 11, 2, 1, 30, 0, 0, ny)
+	got = occurrences(t, "FREQ=DAILY", start, 2)
+	checkOccurrences(t, got, []string{"2024-11-03 01:30", "2024-11-04 01:30"}, ny)
+	if got[1].Sub(got[0]) != 25*time.Hour {
+		t.Errorf("expected 25h between the overlap day & the next one, got %v", got[1].Sub(got[0]))
+	}
+
+	// while an hourly rule counts elapsed hours, going through both
+	start = time.Date(2024, 11, 3, 0, 30, 0, 0, ny)
+	got = occurrences(t, "FREQ=HOURLY", start, 3)
+	for i, g := range got {
+		if want := start.Add(time.Duration(i+1) * time.Hour); !g.Equal(want) {
+			t.Errorf("occurrence %d: expected %v, got %v", i, want, g)
+		}
+	}
+}
+
+func TestCronOccurrences(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		after string
+		want  []string
+	}{
+		{"weekday range", "0 9 * * 1-5", "2024-01-05 09:00", []string{"2024-01-08 09:00", "2024-01-09 09:00"}},
+		{"steps within a range", "*/15 9-10 * * *", "2024-01-01 10:50", []string{"2024-01-02 09:00", "2024-01-02 09:15"}},
+		{"step from a value", "5/20 * * * *", "2024-01-01 00:45", []string{"2024-01-01 01:05", "2024-01-01 01:25"}},
+		{"lists", "0 8,20 * * *", "2024-01-01 09:00", []string{"2024-01-01 20:00", "2024-01-02 08:00"}},
+		{"names", "0 12 * jan,JUL MON", "2024-01-29 12:00", []string{"2024-07-01 12:00", "2024-07-08 12:00"}},
+		{"day of month only", "0 0 13 * *", "2024-01-01 00:00", []string{"2024-01-13 00:00", "2024-02-13 00:00"}},
+		// monday
+		{"day of month or day of week", "0 0 13 * 5", "2024-01-01 00:00", []string{"2024-01-05 00:00", "2024-01-12 00:00", "2024-01-13 00:00"}},
+		{"7 is sunday", "0 8 * * 7", "2024-01-01 00:00", []string{"2024-01-07 08:00", "2024-01-14 08:00"}},
+		{"range to 7", "0 8 * * 5-7", "2024-01-01 00:00", []string{"2024-01-05 08:00", "2024-01-06 08:00", "2024-01-07 08:00"}},
+		{"leap day", "0 0 29 2 *", "2024-03-01 00:00", []string{"2028-02-29 00:00"}},
+		{"never", "0 0 31 2 *", "2024-01-01 00:00", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, err := time.Parse("2006-01-02 15:04", tt.after)
+			if err != nil {
+				t.Fatalf("invalid after time: %v", err)
+			}
+			// at least one is searched, making sure a rule never matching returns none
+			n := len(tt.want)
+			if n == 0 {
+				n = 1
+			}
+			checkOccurrences(t, occurrences(t, tt.expr, after, n), tt.want, time.UTC)
+		})
+	}
+}
+
+func TestCronDST(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+
+	// 2024-03-10 02:30 does not exist in new york, like in many crons that day is skipped
+	start := time.Date(2024, 3, 9, 2, 30, 0, 0, ny)
+	got := occurrences(t, "30 2 * * *", start, 1)
+	checkOccurrences(t, got, []string{"2024-03-11 02:30"}, ny)
+
+	// 2024-11-03 01:30 happens twice in new york, it only matches once
+	start = time.Date(2024, 11, 2, 1, 30, 0, 0, ny)
+	got = occurrences(t, "30 1 * * *", start, 2)
+	checkOccurrences(t, got, []string{"2024-11-03 01:30", "2024-11-04 01:30"}, ny)
+
+	// while the minutes of the repeated hour which are not wall clock duplicates still match
+	start = time.Date(2024, 11, 3, 0, 0, 0, 0, ny)
+	got = occurrences(t, "0 * * * *", start, 3)
+	checkOccurrences(t, got, []string{"2024-11-03 01:00", "2024-11-03 02:00", "2024-11-03 03:00"}, ny)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=SECONDLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;WKST=MO",
+		"FREQ=DAILY;BYDAY=XX",
+		"FREQ=DAILY;BYMONTHDAY=1",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=-32",
+		"FREQ=DAILY;COUNT",
+		"* * * *",
+		"60 * * * *",
+		"0 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"0 0 * FOO *",
+	}
+	for _, rule := range tests {
+		if _, err := Parse(rule); err == nil {
+			t.Errorf("expected '%s' to be rejected", rule)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRULE frequencies
+const (
+	freqMinutely = "MINUTELY"
+	freqHourly   = "HOURLY"
+	freqDaily    = "DAILY"
+	freqWeekly   = "WEEKLY"
+	freqMonthly  = "MONTHLY"
+	freqYearly   = "YEARLY"
+)
+
+// longest length of a single period (DST included), used for skipping ahead
+// to the searched time without ever skipping past it
+var freqPeriods = map[string]time.Duration{
+	freqMinutely: time.Minute,
+	freqHourly:   time.Hour,
+	freqDaily:    25 * time.Hour,
+	freqWeekly:   7*24*time.Hour + time.Hour,
+	freqMonthly:  31*24*time.Hour + time.Hour,
+	freqYearly:   366*24*time.Hour + time.Hour,
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// UNTIL layouts accepted by RFC 5545
+var untilLayouts = []string{
+	"20060102T150405Z",
+	"20060102T150405",
+	"20060102",
+}
+
+// rrule represents the supported subset of an RFC 5545 recurrence rule:
+// FREQ, INTERVAL, BYDAY (DAILY, WEEKLY & MONTHLY, with ordinals such as 2TU or -1FR for MONTHLY),
+// BYMONTHDAY (MONTHLY), COUNT and UNTIL
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      []weekdayNum
+	byMonthDay []int
+}
+
+// weekdayNum represents a BYDAY value, n is the ordinal of the weekday within the month
+// counted from its end when negative, 0 meaning every such weekday
+type weekdayNum struct {
+	n       int
+	weekday time.Weekday
+}
+
+// parseRRule parses an RRULE such as 'FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10'
+func parseRRule(s string) (Rule, error) {
+	r := rrule{interval: 1}
+	var rule Rule
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "RRULE:"), "rrule:")
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return Rule{}, fmt.Errorf("invalid rrule part '%s'", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			if _, ok := freqPeriods[value]; !ok {
+				return Rule{}, fmt.Errorf("unsupported rrule frequency '%s'", value)
+			}
+			r.freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return Rule{}, fmt.Errorf("invalid rrule interval '%s'", value)
+			}
+			r.interval = n
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(d)
+				if err != nil {
+					return Rule{}, err
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, fmt.Errorf("invalid rrule month day '%s'", d)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return Rule{}, fmt.Errorf("invalid rrule count '%s'", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			rule.Until = until
+			rule.floatingUntil = !strings.HasSuffix(value, "Z")
+		default:
+			return Rule{}, fmt.Errorf("unsupported rrule part '%s'", key)
+		}
+	}
+	if r.freq == "" {
+		return Rule{}, fmt.Errorf("rrule '%s' is missing FREQ", s)
+	}
+	if r.byDay != nil && r.freq != freqDaily && r.freq != freqWeekly && r.freq != freqMonthly {
+		return Rule{}, fmt.Errorf("rrule BYDAY is only supported with DAILY, WEEKLY or MONTHLY frequency")
+	}
+	for _, wd := range r.byDay {
+		if wd.n != 0 && r.freq != freqMonthly {
+			return Rule{}, fmt.Errorf("rrule BYDAY ordinals are only supported with MONTHLY frequency")
+		}
+	}
+	if r.byMonthDay != nil && r.freq != freqMonthly {
+		return Rule{}, fmt.Errorf("rrule BYMONTHDAY is only supported with MONTHLY frequency")
+	}
+	rule.next = r.next
+	return rule, nil
+}
+
+// parseWeekdayNum parses a BYDAY value such as MO, 2TU or -1FR
+func parseWeekdayNum(s string) (weekdayNum, error) {
+	if len(s) < 2 {
+		return weekdayNum{}, fmt.Errorf("unsupported rrule day '%s'", s)
+	}
+	wd, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return weekdayNum{}, fmt.Errorf("unsupported rrule day '%s'", s)
+	}
+	res := weekdayNum{weekday: wd}
+	if ordinal := s[:len(s)-2]; ordinal != "" {
+		n, err := strconv.Atoi(ordinal)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return weekdayNum{}, fmt.Errorf("invalid rrule day ordinal '%s'", s)
+		}
+		res.n = n
+	}
+	return res, nil
+}
+
+// parseUntil parses an RRULE UNTIL value, a floating one (without the Z suffix) is parsed as UTC
+// and moved to the time zone of the rule by Rule.UntilIn
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range untilLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid rrule until '%s'", s)
+}
+
+// period retrieves the start of the k-th period counted from start
+// periods of a day or more start at the wall clock time of start
+func (r rrule) period(start time.Time, k int) time.Time {
+	n := k * r.interval
+	y, m, d := start.Date()
+	switch r.freq {
+	case freqMinutely:
+		return start.Add(time.Duration(n) * time.Minute)
+	case freqHourly:
+		return start.Add(time.Duration(n) * time.Hour)
+	case freqDaily:
+		return r.at(start, y, m, d+n)
+	case freqWeekly:
+		return r.at(start, y, m, d+7*n)
+	case freqMonthly:
+		return r.at(start, y, m+time.Month(n), 1)
+	default:
+		return r.at(start, y+n, m, 1)
+	}
+}
+
+// at retrieves the given day at the wall clock time of start
+func (r rrule) at(start time.Time, year int, month time.Month, day int) time.Time {
+	return date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+}
+
+// occurrences retrieves the ordered occurrences within the period starting at p
+func (r rrule) occurrences(start, p time.Time) []time.Time {
+	switch r.freq {
+	case freqDaily:
+		if r.byDay != nil && !r.matchesWeekday(p) {
+			return nil
+		}
+		return []time.Time{p}
+	case freqWeekly:
+		if r.byDay == nil {
+			return []time.Time{p}
+		}
+		// weeks start on monday, like the RFC 5545 default WKST
+		offset := (int(p.Weekday()) + 6) % 7
+		var res []time.Time
+		for i := 0; i < 7; i++ {
+			d := r.at(start, p.Year(), p.Month(), p.Day()-offset+i)
+			if r.matchesWeekday(d) && !d.Before(start) {
+				res = append(res, d)
+			}
+		}
+		return res
+	case freqMonthly:
+		days := r.byMonthDay
+		if days == nil && r.byDay == nil {
+			days = []int{start.Day()}
+		}
+		lastDay := time.Date(p.Year(), p.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		var res []time.Time
+		for day := 1; day <= lastDay; day++ {
+			t := r.at(start, p.Year(), p.Month(), day)
+			// like in RFC 5545, BYDAY limits the BYMONTHDAY days when both are given
+			if days != nil && !matchesMonthDay(days, day, lastDay) {
+				continue
+			}
+			if r.byDay != nil && !r.matchesMonthWeekday(t, lastDay) {
+				continue
+			}
+			if !t.Before(start) {
+				res = append(res, t)
+			}
+		}
+		return res
+	case freqYearly:
+		t := r.at(start, p.Year(), start.Month(), start.Day())
+		// skip years without such a day, e.g. feb 29
+		if t.Month() != start.Month() {
+			return nil
+		}
+		return []time.Time{t}
+	default:
+		return []time.Time{p}
+	}
+}
+
+// matchesWeekday reports whether the weekday of t is one of the BYDAY ones
+func (r rrule) matchesWeekday(t time.Time) bool {
+	for _, wd := range r.byDay {
+		if wd.weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthWeekday reports whether t is one of the BYDAY days of its month,
+// e.g. the 2nd tuesday (2TU) or the last friday (-1FR) of a month with lastDay days
+func (r rrule) matchesMonthWeekday(t time.Time, lastDay int) bool {
+	for _, wd := range r.byDay {
+		if wd.weekday != t.Weekday() {
+			continue
+		}
+		switch {
+		case wd.n == 0,
+			wd.n > 0 && (t.Day()-1)/7+1 == wd.n,
+			wd.n < 0 && (lastDay-t.Day())/7+1 == -wd.n:
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay reports whether the day is one of the BYMONTHDAY days of a month with lastDay days
+// negative days are counted from the end of the month, -1 being its last day
+func matchesMonthDay(days []int, day, lastDay int) bool {
+	for _, d := range days {
+		if d == day || lastDay+d+1 == day {
+			return true
+		}
+	}
+	return false
+}
+
+// next retrieves the first occurrence strictly after the given time
+func (r rrule) next(start, after time.Time) time.Time {
+	k := 0
+	if after.After(start) {
+		// skip ahead close to the searched time
+		period := freqPeriods[r.freq] * time.Duration(r.interval)
+		k = int(after.Sub(start) / period)
+	}
+	for i := 0; i < maxIterations; i, k = i+1, k+1 {
+		for _, t := range r.occurrences(start, r.period(start, k)) {
+			if t.After(after) {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
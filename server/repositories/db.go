@@ -10,7 +10,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/gophertuts/reminders-cli/server"
 	"github.com/gophertuts/reminders-cli/server/models"
 )
 
@@ -21,24 +26,82 @@ type dbConfig struct {
 }
 
 // DB represents the application server database (json file)
+// the reminders are written to the snapshot file in id order and read back one record at a time
+// every mutation is first appended to a write-ahead journal (db.json.journal)
+// which is compacted into the snapshot file whenever the snapshot is written
+// only the mutations journaled since are kept in memory, so the reminders never are as a whole
+// it is safe for concurrent use
 type DB struct {
-	dbPath    string
-	dbCfgPath string
-	cfg       dbConfig
-	db        []byte
+	mu          sync.Mutex
+	saveMu      sync.Mutex
+	dbPath      string
+	dbCfgPath   string
+	journalPath string
+	journal     *os.File
+	journalSize int64
+	lockPath    string
+	lock        *fileLock
+	waitForLock bool
+	integrity   string
+	createdBy   string
+	cfg         dbConfig
+	storedCfg   dbConfig
+	// changes holds the reminders put (or deleted, nil) since the snapshot file was written
+	changes map[int]*models.Reminder
+	// unchecked reports whether the records of the snapshot file were not read since it was verified
+	unchecked bool
+}
+
+func init() {
+	Register("json", Driver{
+		DefaultPath: "db.json",
+		New: func(opts Options) Store {
+			return NewDB(opts)
+		},
+	})
 }
 
 // NewDB creates a new instance of application file DB
-func NewDB(dbPath, dbCfgPath string) *DB {
+// the integrity policy decides what happens if the snapshot fails verification
+func NewDB(opts Options) *DB {
+	cfgPath := opts.CfgPath
+	if cfgPath == "" {
+		cfgPath = filepath.Join(filepath.Dir(opts.Path), ".db.config.json")
+	}
 	db := &DB{
-		dbPath:    dbPath,
-		dbCfgPath: dbCfgPath,
+		dbPath:      opts.Path,
+		dbCfgPath:   cfgPath,
+		journalPath: opts.Path + ".journal",
+		lockPath:    opts.Path + ".lock",
+		waitForLock: opts.WaitForLock,
+		integrity:   opts.Integrity,
+		changes:     map[int]*models.Reminder{},
 	}
 	return db
 }
 
-// Start starts and initializes the file database
+// Start locks and initializes the file database
 func (d *DB) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lock, err := acquireLock(d.lockPath, d.waitForLock)
+	if err != nil {
+		return err
+	}
+	if err := d.open(); err != nil {
+		if d.journal != nil {
+			d.close(d.journal)
+			d.journal = nil
+		}
+		_ = lock.release()
+		return err
+	}
+	d.lock = lock
+	return nil
+}
+
+// open reads the config and the snapshot, migrates it and replays the journal
+func (d *DB) open() error {
 	bs, err := d.read(d.dbCfgPath)
 	if err != nil {
 		return models.WrapError("could not read db config contents", err)
@@ -52,86 +115,450 @@ func (d *DB) Start() error {
 		return models.WrapError("could not unmarshal db config", err)
 	}
 
-	bs, err = d.read(d.dbPath)
+	d.cfg = cfg
+	d.storedCfg = cfg
+
+	d.journal, err = openJournal(d.journalPath)
 	if err != nil {
-		return models.WrapError("could not read db contents", err)
+		return err
 	}
-	d.db = bs
-	if d.cfg.Checksum == "" {
-		checksum, err := genChecksum(bytes.NewReader(bs))
-		if err != nil {
+	entries, err := readJournal(d.journal)
+	if err != nil {
+		return err
+	}
+	info, err := d.journal.Stat()
+	if err != nil {
+		return models.WrapError("could not stat journal file", err)
+	}
+	d.journalSize = info.Size()
+	begin := time.Now()
+	d.changes = map[int]*models.Reminder{}
+	d.unchecked = false
+	stats, checked, err := d.checkSnapshot(entries)
+	if err != nil {
+		return err
+	}
+	if checked {
+		log.Printf(
+			"verified %s (%d bytes) in %v",
+			d.dbPath, stats.size, time.Since(begin).Round(time.Millisecond),
+		)
+	} else {
+		if stats, err = d.loadDocument(entries); err != nil {
 			return err
 		}
-		cfg.Checksum = checksum
+		log.Printf(
+			"loaded %d reminders (%d bytes) from %s in %v",
+			stats.count, stats.size, d.dbPath, time.Since(begin).Round(time.Millisecond),
+		)
 	}
-	d.cfg = cfg
+	if d.createdBy == "" {
+		d.createdBy = server.Version
+	}
+	// files written before ids were journaled can hold ids beyond the stored one
+	if stats.maxID > d.cfg.ID {
+		d.cfg.ID = stats.maxID
+	}
+	return d.replay(entries)
+}
+
+// loadDocument reads the whole snapshot, verifies it, migrates it to the current schema
+// version and writes it back the way readSnapshot reads it, before the journal is replayed
+func (d *DB) loadDocument(entries []journalEntry) (snapshotStats, error) {
+	var stats snapshotStats
+	bs, err := d.read(d.dbPath)
+	if err != nil {
+		return stats, models.WrapError("could not read db contents", err)
+	}
+	doc, err := d.verify(bs, entries)
+	if err != nil {
+		return stats, err
+	}
+	from := doc.Version
+	steps, err := migrate(doc)
+	if err != nil {
+		return stats, fmt.Errorf("could not migrate %s: %v", d.dbPath, err)
+	}
+	reminders, err := doc.reminders()
+	if err != nil {
+		return stats, models.WrapError("could not decode db snapshot", err)
+	}
+	if err := checkCollisions(reminders); err != nil {
+		return stats, err
+	}
+	d.createdBy = doc.CreatedBy
+	if len(steps) != 0 {
+		backup := fmt.Sprintf("%s.v%d.bak", d.dbPath, from)
+		if _, err := d.write(backup, bs); err != nil {
+			return stats, models.WrapError("could not back up db before migrating it", err)
+		}
+		for _, step := range steps {
+			log.Printf("migrated %s to schema version %d: %s (%d change(s))",
+				d.dbPath, step.Version, step.Description, len(step.Changes))
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].ID < reminders[j].ID
+	})
+	// the snapshot misses the journaled mutations, so none of them is compacted
+	if _, err := d.writeSnapshot(0, reminders); err != nil {
+		return stats, err
+	}
+	stats.size = int64(len(bs))
+	stats.count = len(reminders)
+	if len(reminders) > 0 {
+		stats.maxID = reminders[len(reminders)-1].ID
+	}
+	return stats, nil
+}
+
+// replay applies the mutations left in the journal by an unclean shutdown
+// and compacts them into the snapshot file
+func (d *DB) replay(entries []journalEntry) error {
+	if len(entries) == 0 {
+		return d.truncateJournal()
+	}
+	log.Printf("replaying %d journal entries", len(entries))
+	for _, entry := range entries {
+		d.apply(entry)
+		if entry.Op == opPut && entry.Reminder != nil && entry.Reminder.ID > d.cfg.ID {
+			d.cfg.ID = entry.Reminder.ID
+		}
+	}
+	// the reminders are held in memory as a whole only here, after an unclean shutdown
+	reminders, err := d.sorted()
+	if err != nil {
+		return err
+	}
+	_, err = d.writeSnapshot(d.journalSize, reminders)
+	return err
+}
 
+// Get fetches a single reminder by id
+func (d *DB) Get(id int) (models.Reminder, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if reminder, ok := d.changes[id]; ok {
+		if reminder != nil {
+			return *reminder, nil
+		}
+	} else {
+		var found *models.Reminder
+		err := d.readSnapshot(func(reminder models.Reminder) bool {
+			if reminder.ID == id {
+				found = &reminder
+			}
+			return reminder.ID < id
+		})
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		if found != nil {
+			return *found, nil
+		}
+	}
+	return models.Reminder{}, models.NotFoundError{
+		Message: fmt.Sprintf("could not find reminder with id: %d", id),
+	}
+}
+
+// Put journals and applies created or updated reminders
+func (d *DB) Put(reminders ...models.Reminder) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := make([]journalEntry, len(reminders))
+	for i := range reminders {
+		entries[i] = journalEntry{Op: opPut, Reminder: &reminders[i]}
+	}
+	if err := d.append(entries...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		d.apply(entry)
+	}
 	return nil
 }
 
-// Read fetches a list of reminders by given ids
-func (d *DB) Read(bs []byte) (int, error) {
-	n, err := bytes.NewReader(d.db).Read(bs)
-	if err != nil && err != io.EOF {
-		return 0, models.WrapError("could not read db file bytes", err)
+// Delete journals and applies deleted reminders
+func (d *DB) Delete(ids ...int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := make([]journalEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = journalEntry{Op: opDelete, ID: id}
 	}
-	return n, nil
+	if err := d.append(entries...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		d.apply(entry)
+	}
+	return nil
 }
 
-// Write writes a list of reminders to DB
-func (d *DB) Write(bs []byte) (int, error) {
-	bs = append(bs, '\n')
-	checksum, err := genChecksum(bytes.NewReader(bs))
+// Query fetches the reminders matching the filtering function, in id order
+func (d *DB) Query(filterFn func(reminder models.Reminder) bool) ([]models.Reminder, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]models.Reminder, 0)
+	err := d.each(func(reminder models.Reminder) {
+		if filterFn == nil || filterFn(reminder) {
+			res = append(res, reminder)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// Scan calls fn for every reminder, in no particular order
+// the snapshot file is read one record at a time, so the reminders are streamed straight into fn
+func (d *DB) Scan(fn func(reminder models.Reminder)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.each(fn)
+}
+
+// Mark retrieves the end of the journal, which a snapshot taken right now holds
+func (d *DB) Mark() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.journalSize
+}
+
+// Save writes a full snapshot of reminders, taken at the mark
+// the snapshot is encoded & written without holding the lock, so mutations go on meanwhile,
+// and the journal is compacted only up to the mark, which keeps the mutations the snapshot misses
+func (d *DB) Save(mark int64, reminders []models.Reminder) (int, error) {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	d.mu.Lock()
+	createdBy := d.createdBy
+	d.mu.Unlock()
+	bs, checksum, err := encodeChecksum(reminders, createdBy)
 	if err != nil {
 		return 0, err
 	}
-	if d.cfg.Checksum == checksum {
-		return 0, nil
+
+	d.mu.Lock()
+	changed, err := d.beginSnapshot(checksum)
+	d.mu.Unlock()
+	if err != nil {
+		return 0, err
 	}
-	d.cfg.Checksum = checksum
+	var n int
+	if changed {
+		if n, err = d.write(d.dbPath, bs); err != nil {
+			return 0, err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return n, d.commitSnapshot(mark, checksum)
+}
 
-	if err := d.writeDBCfg(); err != nil {
+// writeSnapshot writes the snapshot file (if changed) and compacts the journal up to the mark
+// the caller must hold the lock
+func (d *DB) writeSnapshot(mark int64, reminders []models.Reminder) (int, error) {
+	bs, checksum, err := encodeChecksum(reminders, d.createdBy)
+	if err != nil {
 		return 0, err
 	}
-	n, err := d.write(d.dbPath, bs)
+	changed, err := d.beginSnapshot(checksum)
 	if err != nil {
 		return 0, err
 	}
-	d.db = bs
+	var n int
+	if changed {
+		if n, err = d.write(d.dbPath, bs); err != nil {
+			return 0, err
+		}
+	}
+	return n, d.commitSnapshot(mark, checksum)
+}
+
+// encodeChecksum encodes a snapshot and retrieves its checksum
+func encodeChecksum(reminders []models.Reminder, createdBy string) ([]byte, string, error) {
+	bs, err := encodeSnapshot(reminders, createdBy)
+	if err != nil {
+		return nil, "", err
+	}
+	checksum, err := genChecksum(bytes.NewReader(bs))
+	if err != nil {
+		return nil, "", err
+	}
+	return bs, checksum, nil
+}
 
-	return n, nil
+// beginSnapshot journals the intent of writing a snapshot with the checksum
+// false is retrieved when the snapshot file already holds it, so it is not written
+// the caller must hold the lock
+func (d *DB) beginSnapshot(checksum string) (bool, error) {
+	if d.cfg.Checksum == checksum {
+		return false, nil
+	}
+	// the intent makes a snapshot written right before a crash,
+	// without its config, pass the integrity verification
+	if err := d.append(journalEntry{Op: opSnapshot, Checksum: checksum}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commitSnapshot stores the checksum of the written snapshot and compacts the journal
+// up to the mark, the mutations journaled after it are kept on top of the snapshot
+// the caller must hold the lock
+func (d *DB) commitSnapshot(mark int64, checksum string) error {
+	d.cfg.Checksum = checksum
+	// the snapshot file holds the records as they were encoded, in id order
+	d.unchecked = false
+	// the config holds the allocated ids, so it is written even if the snapshot is unchanged
+	if d.cfg != d.storedCfg {
+		if err := d.writeDBCfg(); err != nil {
+			return err
+		}
+	}
+	tail, err := d.compactJournal(mark)
+	if err != nil {
+		return err
+	}
+	d.changes = map[int]*models.Reminder{}
+	for _, entry := range tail {
+		d.apply(entry)
+	}
+	return nil
 }
 
-// Size retrieves the current size of the database
-func (d *DB) Size() int {
-	if len(d.db) == 0 {
-		d.db = []byte("[]")
+// each calls fn for every reminder: the records of the snapshot file, read one at a time,
+// overlaid with the changes journaled since it was written
+func (d *DB) each(fn func(reminder models.Reminder)) error {
+	err := d.readSnapshot(func(reminder models.Reminder) bool {
+		if _, changed := d.changes[reminder.ID]; !changed {
+			fn(reminder)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, reminder := range d.changes {
+		if reminder != nil {
+			fn(*reminder)
+		}
+	}
+	return nil
+}
+
+// sorted retrieves all the reminders ordered by id, which holds them in memory as a whole
+func (d *DB) sorted() ([]models.Reminder, error) {
+	var res []models.Reminder
+	if err := d.each(func(reminder models.Reminder) {
+		res = append(res, reminder)
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// apply applies a single journal entry to the changes since the snapshot
+func (d *DB) apply(entry journalEntry) {
+	switch {
+	case entry.Op == opPut && entry.Reminder != nil:
+		reminder := *entry.Reminder
+		d.changes[reminder.ID] = &reminder
+	case entry.Op == opDelete:
+		d.changes[entry.ID] = nil
+	case entry.Op == opID:
+		if entry.ID > d.cfg.ID {
+			d.cfg.ID = entry.ID
+		}
+	}
+}
+
+// append appends mutations to the journal and syncs them to the disk at once
+func (d *DB) append(entries ...journalEntry) error {
+	if d.journal == nil {
+		return errors.New("journal is not open, the db is not started")
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			return models.WrapError("could not marshal journal entry", err)
+		}
+		buf.Write(append(bs, '\n'))
+	}
+	if _, err := d.journal.Write(buf.Bytes()); err != nil {
+		// drop the partial entries, so the next append does not follow a torn one
+		_ = d.journal.Truncate(d.journalSize)
+		return models.WrapError("could not append to journal", err)
+	}
+	if err := d.journal.Sync(); err != nil {
+		return models.WrapError("could not sync journal", err)
 	}
-	return len(d.db)
+	d.journalSize += int64(buf.Len())
+	return nil
 }
 
-// GenerateID generates the next AUTOINCREMENT id for a reminder
-func (d *DB) GenerateID() int {
-	d.cfg.ID++
-	return d.cfg.ID
+// NextID allocates the next AUTOINCREMENT id for a reminder
+// the allocation is journaled before the id is handed out
+func (d *DB) NextID() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.unchecked {
+		// the snapshot may hold ids beyond the stored one, which are only known once its records are read
+		if err := d.readSnapshot(func(models.Reminder) bool { return true }); err != nil {
+			return 0, err
+		}
+	}
+	id := d.cfg.ID + 1
+	if err := d.append(journalEntry{Op: opID, ID: id}); err != nil {
+		return 0, err
+	}
+	d.cfg.ID = id
+	return id, nil
 }
 
 // Stop shuts down properly the file database by saving metadata to config file
-func (d DB) Stop() error {
+func (d *DB) Stop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	log.Println("shutting down the database")
 	_, errDB := os.Open(d.dbPath)
 	_, errDBCfg := os.Open(d.dbCfgPath)
 	if errors.Is(errDB, os.ErrNotExist) {
-		_, err := d.write(d.dbPath, d.db)
+		reminders, err := d.sorted()
 		if err != nil {
 			return err
 		}
+		bs, err := encodeSnapshot(reminders, d.createdBy)
+		if err != nil {
+			return err
+		}
+		if _, err := d.write(d.dbPath, bs); err != nil {
+			return err
+		}
 	}
 	if errors.Is(errDBCfg, os.ErrNotExist) {
 		if err := d.writeDBCfg(); err != nil {
 			return err
 		}
 	}
+	if d.journal != nil {
+		d.close(d.journal)
+		d.journal = nil
+	}
+	if err := d.lock.release(); err != nil {
+		return err
+	}
+	d.lock = nil
 	log.Println("database was successfully shut down")
 	return nil
 }
@@ -155,6 +582,7 @@ func (d *DB) read(path string) ([]byte, error) {
 	if err != nil {
 		return nil, models.WrapError("could not open or create db file", err)
 	}
+	defer d.close(dbFile)
 	return ioutil.ReadAll(dbFile)
 }
 
@@ -169,21 +597,105 @@ func (d *DB) writeDBCfg() error {
 	if err != nil {
 		return models.WrapError("could not write to db cfg file", err)
 	}
+	d.storedCfg = d.cfg
 	return nil
 }
 
+// write atomically replaces a file: the contents are written and synced to
+// a temporary file which is then renamed over the original one, so a crash
+// never leaves a partially written file behind
 func (d *DB) write(path string, bs []byte) (int, error) {
-	dbFile, err := os.Create(path)
+	tmpPath := path + ".tmp"
+	dbFile, err := os.Create(tmpPath)
 	if err != nil {
 		return 0, models.WrapError("could not create file", err)
 	}
-	defer d.close(dbFile)
 
 	n, err := dbFile.Write(bs)
 	if err == nil {
-		log.Printf("successfully wrote %d byte(s) to %s file", n, dbFile.Name())
+		err = dbFile.Sync()
+	}
+	d.close(dbFile)
+	if err != nil {
+		return 0, models.WrapError("could not write file", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, models.WrapError("could not replace file", err)
+	}
+	syncDir(filepath.Dir(path))
+	log.Printf("successfully wrote %d byte(s) to %s file", n, path)
+	return n, nil
+}
+
+// truncateJournal drops the journal entries, once they are part of the snapshot
+func (d *DB) truncateJournal() error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.Truncate(0); err != nil {
+		return models.WrapError("could not truncate journal", err)
+	}
+	if err := d.journal.Sync(); err != nil {
+		return models.WrapError("could not sync journal", err)
+	}
+	d.journalSize = 0
+	return nil
+}
+
+// compactJournal drops the journal entries before the mark, once they are part of the snapshot,
+// and retrieves the mutations after it, which the snapshot misses
+// the rest of the journal atomically replaces it, so a crash leaves either of them behind,
+// and replaying either on top of the new snapshot recovers the same reminders
+func (d *DB) compactJournal(mark int64) ([]journalEntry, error) {
+	if d.journal == nil || mark >= d.journalSize {
+		return nil, d.truncateJournal()
+	}
+	rest := make([]byte, d.journalSize-mark)
+	if _, err := d.journal.ReadAt(rest, mark); err != nil {
+		return nil, models.WrapError("could not read journal", err)
+	}
+	entries, err := decodeJournal(bytes.NewReader(rest))
+	if err != nil {
+		return nil, err
+	}
+	// the snapshot intents are no longer needed, the config holds the checksum now
+	var buf bytes.Buffer
+	var tail []journalEntry
+	for _, entry := range entries {
+		if entry.Op == opSnapshot {
+			continue
+		}
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			return nil, models.WrapError("could not marshal journal entry", err)
+		}
+		buf.Write(append(bs, '\n'))
+		tail = append(tail, entry)
+	}
+	if len(tail) == 0 {
+		return nil, d.truncateJournal()
+	}
+	if _, err := d.write(d.journalPath, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	journal, err := openJournal(d.journalPath)
+	if err != nil {
+		return nil, err
+	}
+	d.close(d.journal)
+	d.journal = journal
+	d.journalSize = int64(buf.Len())
+	return tail, nil
+}
+
+// syncDir syncs a directory, which makes a rename inside of it durable
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
 	}
-	return n, err
+	defer dir.Close()
+	_ = dir.Sync()
 }
 
 // close closes an open db file
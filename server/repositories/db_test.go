@@ -0,0 +1,364 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+func TestMain(m *testing.M) {
+	// the db logs every write, which drowns the test output
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// db files, relative to the directory of the db
+const (
+	dbFile      = "db.json"
+	cfgFile     = ".db.config.json"
+	journalFile = "db.json.journal"
+)
+
+// tempDir creates a temporary directory, which is removed once the test is done
+func tempDir(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "reminders-db")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// testReminder creates a reminder which survives a json round trip unchanged
+func testReminder(id int, title string) models.Reminder {
+	at := time.Date(2020, 1, 1, 0, 0, id, 0, time.UTC)
+	return models.Reminder{
+		ID:         id,
+		Owner:      models.DefaultOwner,
+		Title:      title,
+		Message:    fmt.Sprintf("message of %d", id),
+		Duration:   time.Hour,
+		DueAt:      at.Add(time.Hour),
+		Status:     models.StatusPending,
+		CreatedAt:  at,
+		ModifiedAt: at,
+	}
+}
+
+// startDB starts a json db in dir, which refuses any snapshot failing verification
+func startDB(t testing.TB, dir string) *DB {
+	t.Helper()
+	db := NewDB(Options{Path: filepath.Join(dir, dbFile), Integrity: IntegrityRefuse})
+	if err := db.Start(); err != nil {
+		t.Fatalf("could not start db: %v", err)
+	}
+	return db
+}
+
+// stopDB stops a db, which is used by the test as a cleanup
+func stopDB(t testing.TB, db *DB) {
+	t.Helper()
+	if err := db.Stop(); err != nil {
+		t.Errorf("could not stop db: %v", err)
+	}
+}
+
+// readImage reads the db files of dir, the way a crash would leave them on the disk
+func readImage(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	image := map[string][]byte{}
+	for _, name := range []string{dbFile, cfgFile, journalFile} {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("could not read %s: %v", name, err)
+		}
+		image[name] = bs
+	}
+	return image
+}
+
+// writeImage writes the db files to a new directory, so a db can be started from them
+func writeImage(t *testing.T, image map[string][]byte) string {
+	t.Helper()
+	dir := tempDir(t)
+	for name, bs := range image {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), bs, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// with copies an image, replacing (or adding) a file
+func with(image map[string][]byte, name string, bs []byte) map[string][]byte {
+	res := make(map[string][]byte, len(image)+1)
+	for n, contents := range image {
+		res[n] = contents
+	}
+	res[name] = bs
+	return res
+}
+
+// concat concatenates byte slices into a new one
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// checkRecovered starts a db from the image and checks it holds exactly the wanted reminders
+// a reminder in maybe is a mutation which was not acknowledged, so it may or may not be recovered
+// and lastID is the last id which was handed out, which must never be handed out again
+func checkRecovered(t *testing.T, image map[string][]byte, want []models.Reminder, maybe *models.Reminder, lastID int) {
+	t.Helper()
+	db := startDB(t, writeImage(t, image))
+	defer stopDB(t, db)
+	got, err := db.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query db: %v", err)
+	}
+	if maybe != nil && len(got) == len(want)+1 {
+		want = append(append([]models.Reminder(nil), want...), *maybe)
+		sort.Slice(want, func(i, j int) bool { return want[i].ID < want[j].ID })
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reminders %v, got %v", ids(want), ids(got))
+	}
+	id, err := db.NextID()
+	if err != nil {
+		t.Fatalf("could not allocate an id: %v", err)
+	}
+	if id <= lastID {
+		t.Errorf("expected an id after %d, got %d", lastID, id)
+	}
+}
+
+func ids(reminders []models.Reminder) []int {
+	res := make([]int, len(reminders))
+	for i, r := range reminders {
+		res[i] = r.ID
+	}
+	return res
+}
+
+// acknowledge runs a few mutations of every kind on a saved db
+// and retrieves the reminders they leave behind & the last allocated id
+func acknowledge(t *testing.T, db *DB) ([]models.Reminder, int) {
+	t.Helper()
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	if _, err := db.Save(db.Mark(), []models.Reminder{r1, r2}); err != nil {
+		t.Fatalf("could not save db: %v", err)
+	}
+	r2.Title = "two edited"
+	if err := db.Put(r2, r3); err != nil {
+		t.Fatalf("could not put reminders: %v", err)
+	}
+	if err := db.Delete(r1.ID); err != nil {
+		t.Fatalf("could not delete reminder: %v", err)
+	}
+	lastID := 0
+	for i := 0; i < 5; i++ {
+		id, err := db.NextID()
+		if err != nil {
+			t.Fatalf("could not allocate an id: %v", err)
+		}
+		lastID = id
+	}
+	return []models.Reminder{r2, r3}, lastID
+}
+
+// TestDBRecoversFromTornAppends crashes the db at every byte of a journal append
+func TestDBRecoversFromTornAppends(t *testing.T) {
+	dir := tempDir(t)
+	db := startDB(t, dir)
+	defer stopDB(t, db)
+	want, lastID := acknowledge(t, db)
+	before := readImage(t, dir)
+
+	r4 := testReminder(lastID, "four")
+	if err := db.Put(r4); err != nil {
+		t.Fatalf("could not put reminder: %v", err)
+	}
+	entry := readImage(t, dir)[journalFile][len(before[journalFile]):]
+	if len(entry) == 0 {
+		t.Fatal("expected the put to be journaled")
+	}
+	for n := 0; n <= len(entry); n++ {
+		t.Run(fmt.Sprintf("written=%d", n), func(t *testing.T) {
+			image := with(before, journalFile, concat(before[journalFile], entry[:n]))
+			checkRecovered(t, image, want, &r4, lastID)
+		})
+	}
+	t.Run("acknowledged", func(t *testing.T) {
+		checkRecovered(t, readImage(t, dir), append(want, r4), nil, lastID)
+	})
+}
+
+// TestDBRecoversFromTornSnapshots crashes the db at every step of a snapshot write:
+// the intent entry, the temporary snapshot, its rename, the config & the journal compaction
+func TestDBRecoversFromTornSnapshots(t *testing.T) {
+	dir := tempDir(t)
+	db := startDB(t, dir)
+	defer stopDB(t, db)
+	want, lastID := acknowledge(t, db)
+	before := readImage(t, dir)
+
+	if _, err := db.Save(db.Mark(), want); err != nil {
+		t.Fatalf("could not save db: %v", err)
+	}
+	after := readImage(t, dir)
+	snapshot, cfg := after[dbFile], after[cfgFile]
+	if bytes.Equal(snapshot, before[dbFile]) {
+		t.Fatal("expected the save to write a new snapshot")
+	}
+	checksum, err := genChecksum(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent, err := json.Marshal(journalEntry{Op: opSnapshot, Checksum: checksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent = append(intent, '\n')
+	journal := before[journalFile]
+	intended := with(before, journalFile, concat(journal, intent))
+
+	var steps []struct {
+		name  string
+		image map[string][]byte
+	}
+	step := func(name string, image map[string][]byte) {
+		steps = append(steps, struct {
+			name  string
+			image map[string][]byte
+		}{name, image})
+	}
+	for n := 0; n < len(intent); n++ {
+		step(fmt.Sprintf("intent written=%d", n), with(before, journalFile, concat(journal, intent[:n])))
+	}
+	for _, n := range []int{0, 1, len(snapshot) / 2, len(snapshot) - 1, len(snapshot)} {
+		step(fmt.Sprintf("snapshot tmp written=%d", n), with(intended, dbFile+".tmp", snapshot[:n]))
+	}
+	renamed := with(intended, dbFile, snapshot)
+	step("snapshot renamed", renamed)
+	for _, n := range []int{0, len(cfg) / 2, len(cfg)} {
+		step(fmt.Sprintf("config tmp written=%d", n), with(renamed, cfgFile+".tmp", cfg[:n]))
+	}
+	step("config renamed", with(renamed, cfgFile, cfg))
+	step("journal compacted", after)
+
+	for _, s := range steps {
+		t.Run(s.name, func(t *testing.T) {
+			checkRecovered(t, s.image, want, nil, lastID)
+		})
+	}
+}
+
+// TestDBCompactionKeepsLaterMutations saves a snapshot which misses a mutation after its mark
+// and crashes the db before & after the journal is compacted
+func TestDBCompactionKeepsLaterMutations(t *testing.T) {
+	dir := tempDir(t)
+	db := startDB(t, dir)
+	defer stopDB(t, db)
+	want, lastID := acknowledge(t, db)
+	mark := db.Mark()
+	r4 := testReminder(lastID, "four")
+	if err := db.Put(r4); err != nil {
+		t.Fatalf("could not put reminder: %v", err)
+	}
+	before := readImage(t, dir)
+
+	if _, err := db.Save(mark, want); err != nil {
+		t.Fatalf("could not save db: %v", err)
+	}
+	after := readImage(t, dir)
+	want = append(want, r4)
+	t.Run("journal not compacted", func(t *testing.T) {
+		// the config holds the checksum of the new snapshot, which the whole journal is replayed on
+		checkRecovered(t, with(after, journalFile, before[journalFile]), want, nil, lastID)
+	})
+	t.Run("journal compacted", func(t *testing.T) {
+		if len(after[journalFile]) == 0 {
+			t.Fatal("expected the mutation after the mark to be left in the journal")
+		}
+		checkRecovered(t, after, want, nil, lastID)
+	})
+}
+
+// TestDBChecksRecordsOnFirstRead saves snapshots with a matching checksum, which pass the start
+// so their records are checked when the reminders are first read
+func TestDBChecksRecordsOnFirstRead(t *testing.T) {
+	withUID := func(r models.Reminder, uid string) models.Reminder {
+		r.UID = uid
+		return r
+	}
+	uid := "0190a0b0-0000-7000-8000-000000000001"
+	tests := []struct {
+		name      string
+		reminders []models.Reminder
+		err       string
+	}{
+		{"unordered ids", []models.Reminder{testReminder(2, "two"), testReminder(1, "one")}, "does not come after"},
+		{"duplicate ids", []models.Reminder{testReminder(1, "one"), testReminder(1, "one")}, "does not come after"},
+		{"duplicate uids", []models.Reminder{
+			withUID(testReminder(1, "one"), uid), withUID(testReminder(2, "two"), uid),
+		}, "colliding reminder uids: " + uid},
+		{"ids beyond the stored one", []models.Reminder{testReminder(1, "one"), testReminder(7, "seven")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			db := startDB(t, dir)
+			if _, err := db.Save(db.Mark(), tt.reminders); err != nil {
+				t.Fatalf("could not save db: %v", err)
+			}
+			stopDB(t, db)
+
+			db = startDB(t, dir)
+			defer stopDB(t, db)
+			_, err := db.Query(nil)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("could not query db: %v", err)
+				}
+				if id, err := db.NextID(); err != nil || id != 8 {
+					t.Errorf("expected id 8 after the stored ids, got %d (%v)", id, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error mentioning %q, got: %v", tt.err, err)
+			}
+			// the records are checked until they are read as a whole
+			if _, err := db.NextID(); err == nil {
+				t.Error("expected no id to be allocated from an invalid snapshot")
+			}
+		})
+	}
+
+	// a fresh db allocates ids after the stored ones, even before they are read
+	dir := tempDir(t)
+	db := startDB(t, dir)
+	if _, err := db.Save(db.Mark(), []models.Reminder{testReminder(3, "three")}); err != nil {
+		t.Fatalf("could not save db: %v", err)
+	}
+	stopDB(t, db)
+	db = startDB(t, dir)
+	defer stopDB(t, db)
+	if id, err := db.NextID(); err != nil || id != 4 {
+		t.Errorf("expected id 4 after the stored ids, got %d (%v)", id, err)
+	}
+}
@@ -0,0 +1,331 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// FsckReport represents the result of checking a json file DB
+type FsckReport struct {
+	// SchemaVersion is the schema version of the snapshot file
+	SchemaVersion int
+	// Records is the number of records found in the snapshot file
+	Records int
+	// Migrations lists the schema migrations applied to the records before checking them
+	Migrations []MigrationStep
+	// Pending is the number of journal entries which were not compacted yet
+	Pending int
+	// Problems lists everything that is wrong with the file
+	Problems []string
+	// Repaired reports whether a repaired file was written
+	Repaired bool
+	// Kept is the number of records in the repaired file
+	Kept int
+	// Backup is the path of the original file, when it was repaired
+	Backup string
+}
+
+// Fsck checks a json file DB, which must not be in use: the snapshot checksum,
+// the schema of every record and zero or duplicate ids (and uids)
+// with repair, a repaired file is written, with the pending journal entries
+// applied, and the original one is kept as a backup next to it
+func Fsck(dbPath, dbCfgPath string, repair bool) (FsckReport, error) {
+	var report FsckReport
+	d := NewDB(Options{Path: dbPath, CfgPath: dbCfgPath, Integrity: IntegrityRefuse})
+	lock, err := acquireLock(d.lockPath, false)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if err := lock.release(); err != nil {
+			log.Printf("could not release database lock: %v", err)
+		}
+	}()
+	if bs, err := readIfExists(dbCfgPath); err != nil {
+		return report, err
+	} else if len(bytes.TrimSpace(bs)) != 0 {
+		if err := json.Unmarshal(bs, &d.cfg); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("config is not valid json: %v", err))
+		}
+	}
+	bs, err := readIfExists(dbPath)
+	if err != nil {
+		return report, err
+	}
+	var entries []journalEntry
+	if f, err := os.Open(d.journalPath); err == nil {
+		entries, err = readJournal(f)
+		d.close(f)
+		if err != nil {
+			return report, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return report, models.WrapError("could not open journal file", err)
+	}
+
+	checksum, err := genChecksum(bytes.NewReader(bs))
+	if err != nil {
+		return report, err
+	}
+	if d.cfg.Checksum != "" && d.cfg.Checksum != checksum && !snapshotIntended(entries, checksum) {
+		report.Problems = append(report.Problems, fmt.Sprintf(
+			"checksum %s does not match the stored %s", checksum, d.cfg.Checksum,
+		))
+	}
+
+	records, version, problems := salvageRecords(bs)
+	report.SchemaVersion = version
+	report.Records = len(records)
+	report.Problems = append(report.Problems, problems...)
+	records, report.Migrations, problems, err = migrateRecords(records, version)
+	if err != nil {
+		return report, err
+	}
+	report.Problems = append(report.Problems, problems...)
+	reminders, problems := checkRecords(records)
+	report.Problems = append(report.Problems, problems...)
+	for _, entry := range entries {
+		if entry.Op != opSnapshot {
+			report.Pending++
+		}
+	}
+
+	if !repair || (len(report.Problems) == 0 && report.Pending == 0 && len(report.Migrations) == 0) {
+		return report, nil
+	}
+	kept := make(map[int]models.Reminder, len(reminders))
+	for _, r := range reminders {
+		kept[r.ID] = r
+	}
+	for _, entry := range entries {
+		d.apply(entry)
+	}
+	for id, r := range d.changes {
+		if r == nil {
+			delete(kept, id)
+		} else {
+			kept[id] = *r
+		}
+	}
+	reminders = make([]models.Reminder, 0, len(kept))
+	for id, r := range kept {
+		if id > d.cfg.ID {
+			d.cfg.ID = id
+		}
+		reminders = append(reminders, r)
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].ID < reminders[j].ID
+	})
+	report.Kept = len(reminders)
+	if len(bs) != 0 {
+		report.Backup = fmt.Sprintf("%s.bak-%s", dbPath, time.Now().Format("20060102T150405"))
+		if _, err := d.write(report.Backup, bs); err != nil {
+			return report, err
+		}
+	}
+	var createdBy string
+	if doc, err := parseDocument(bs); err == nil {
+		createdBy = doc.CreatedBy
+	}
+	out, err := encodeSnapshot(reminders, createdBy)
+	if err != nil {
+		return report, err
+	}
+	if _, err := d.write(dbPath, out); err != nil {
+		return report, err
+	}
+	if d.cfg.Checksum, err = genChecksum(bytes.NewReader(out)); err != nil {
+		return report, err
+	}
+	if err := d.writeDBCfg(); err != nil {
+		return report, err
+	}
+	if len(entries) != 0 {
+		if err := os.Truncate(d.journalPath, 0); err != nil {
+			return report, models.WrapError("could not truncate journal", err)
+		}
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// salvageRecords splits the snapshot (of any schema version) into its raw records
+// a truncated or malformed file is read up to its first broken record
+func salvageRecords(bs []byte) ([]json.RawMessage, int, []string) {
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return nil, SchemaVersion, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	t, err := dec.Token()
+	if err == nil && t == json.Delim('[') {
+		records, problems := salvageArray(dec)
+		return records, 0, problems
+	}
+	if err != nil || t != json.Delim('{') {
+		return nil, 0, []string{"file is neither a versioned db nor a json array of reminders"}
+	}
+	version := 0
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if key == "reminders" {
+			if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+				return nil, version, []string{"reminders are not a json array"}
+			}
+			records, problems := salvageArray(dec)
+			return records, version, problems
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+		if key == "schema_version" {
+			_ = json.Unmarshal(value, &version)
+		}
+	}
+	return nil, version, []string{"file holds no reminders array"}
+}
+
+// salvageArray reads the records of a json array, whose opening bracket was already read
+func salvageArray(dec *json.Decoder) ([]json.RawMessage, []string) {
+	var records []json.RawMessage
+	for dec.More() {
+		var record json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return records, []string{fmt.Sprintf("file is malformed after record %d: %v", len(records), err)}
+		}
+		records = append(records, record)
+	}
+	if _, err := dec.Token(); err != nil {
+		return records, []string{fmt.Sprintf("file is truncated after record %d", len(records))}
+	}
+	return records, nil
+}
+
+// migrateRecords upgrades salvaged records to the current schema version
+func migrateRecords(records []json.RawMessage, version int) ([]json.RawMessage, []MigrationStep, []string, error) {
+	var problems []string
+	doc := &rawDocument{Version: version}
+	for i, record := range records {
+		var r rawRecord
+		dec := json.NewDecoder(bytes.NewReader(record))
+		dec.UseNumber()
+		if err := dec.Decode(&r); err != nil {
+			problems = append(problems, fmt.Sprintf("record %d is not an object, dropping it", i))
+			continue
+		}
+		doc.Records = append(doc.Records, r)
+	}
+	steps, err := migrate(doc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	res := make([]json.RawMessage, 0, len(doc.Records))
+	for _, r := range doc.Records {
+		bs, err := json.Marshal(r)
+		if err != nil {
+			return nil, nil, nil, models.WrapError("could not marshal migrated record", err)
+		}
+		res = append(res, bs)
+	}
+	return res, steps, problems, nil
+}
+
+// checkRecords validates the schema of every record and retrieves the repairable ones
+// zero ids and undecodable records are dropped, missing or invalid fields are filled in,
+// out of duplicate ids the most recently modified record is kept
+// and duplicate uids are cleared from all but one record
+func checkRecords(records []json.RawMessage) ([]models.Reminder, []string) {
+	var problems []string
+	byID := map[int]models.Reminder{}
+	for i, record := range records {
+		var reminder models.Reminder
+		dec := json.NewDecoder(bytes.NewReader(record))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&reminder); err != nil {
+			if err := json.Unmarshal(record, &reminder); err != nil {
+				problems = append(problems, fmt.Sprintf("record %d is invalid, dropping it: %v", i, err))
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("record %d has unknown fields, dropping them", i))
+		}
+		if reminder.ID <= 0 {
+			problems = append(problems, fmt.Sprintf("record %d has id %d, dropping it", i, reminder.ID))
+			continue
+		}
+		if reminder.Status != "" && !reminder.Status.Valid() {
+			problems = append(problems, fmt.Sprintf(
+				"reminder %d has an unknown status '%s', resetting it", reminder.ID, reminder.Status,
+			))
+			reminder.Status = ""
+		}
+		migrateStatus(&reminder)
+		// a negative duration only ever marked completed reminders
+		if reminder.Duration < 0 && reminder.Status.Active() {
+			problems = append(problems, fmt.Sprintf(
+				"reminder %d is %s with a negative duration, resetting it to 0", reminder.ID, reminder.Status,
+			))
+			reminder.Duration = 0
+		}
+		if reminder.Title == "" {
+			problems = append(problems, fmt.Sprintf("reminder %d has an empty title, setting it to 'untitled'", reminder.ID))
+			reminder.Title = "untitled"
+		}
+		if reminder.Message == "" {
+			problems = append(problems, fmt.Sprintf("reminder %d has an empty message, setting it to 'no message'", reminder.ID))
+			reminder.Message = "no message"
+		}
+		if prev, ok := byID[reminder.ID]; ok {
+			problems = append(problems, fmt.Sprintf("id %d is used by several records, keeping the latest one", reminder.ID))
+			if prev.ModifiedAt.After(reminder.ModifiedAt) {
+				continue
+			}
+		}
+		byID[reminder.ID] = reminder
+	}
+
+	res := make([]models.Reminder, 0, len(byID))
+	for _, r := range byID {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ModifiedAt.After(res[j].ModifiedAt)
+	})
+	uids := map[string]bool{}
+	for i, r := range res {
+		if r.UID == "" {
+			continue
+		}
+		if uids[r.UID] {
+			problems = append(problems, fmt.Sprintf("uid %s is used by several reminders, clearing it from %d", r.UID, r.ID))
+			res[i].UID = ""
+			continue
+		}
+		uids[r.UID] = true
+	}
+	return res, problems
+}
+
+// readIfExists reads a file, a missing file reads as empty
+func readIfExists(path string) ([]byte, error) {
+	bs, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, models.WrapError(fmt.Sprintf("could not read %s", path), err)
+	}
+	return bs, nil
+}
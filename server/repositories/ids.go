@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// CollisionError represents the error returned when the stored reminders
+// hold the same id (or uid) more than once, which means an id was reused
+type CollisionError struct {
+	IDs  []int
+	UIDs []string
+}
+
+func (e CollisionError) Error() string {
+	var parts []string
+	if len(e.IDs) > 0 {
+		ids := make([]string, len(e.IDs))
+		for i, id := range e.IDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		parts = append(parts, "ids: "+strings.Join(ids, ", "))
+	}
+	if len(e.UIDs) > 0 {
+		parts = append(parts, "uids: "+strings.Join(e.UIDs, ", "))
+	}
+	return fmt.Sprintf("found colliding reminder %s", strings.Join(parts, "; "))
+}
+
+// checkCollisions retrieves a CollisionError if any id or uid is used by several reminders
+func checkCollisions(reminders []models.Reminder) error {
+	var c collisions
+	seen := make(map[int]bool, len(reminders))
+	for _, r := range reminders {
+		c.add(r, seen[r.ID])
+		seen[r.ID] = true
+	}
+	return c.err()
+}
+
+// collisions accumulates the ids and uids used by several reminders
+// so they can be checked while the reminders are being loaded
+type collisions struct {
+	ids  map[int]bool
+	uids map[string]int
+	e    CollisionError
+}
+
+// add records a loaded reminder, dupID reports whether its id was already loaded
+func (c *collisions) add(r models.Reminder, dupID bool) {
+	if dupID && !c.ids[r.ID] {
+		if c.ids == nil {
+			c.ids = map[int]bool{}
+		}
+		c.ids[r.ID] = true
+		c.e.IDs = append(c.e.IDs, r.ID)
+	}
+	if r.UID == "" {
+		return
+	}
+	if c.uids == nil {
+		c.uids = map[string]int{}
+	}
+	if c.uids[r.UID]++; c.uids[r.UID] == 2 {
+		c.e.UIDs = append(c.e.UIDs, r.UID)
+	}
+}
+
+// err retrieves a CollisionError if any collision was recorded
+func (c *collisions) err() error {
+	if len(c.e.IDs) == 0 && len(c.e.UIDs) == 0 {
+		return nil
+	}
+	sort.Ints(c.e.IDs)
+	sort.Strings(c.e.UIDs)
+	return c.e
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// integrity policies, applied when the snapshot does not match its stored checksum
+const (
+	IntegrityRefuse     = "refuse"
+	IntegrityWarn       = "warn"
+	IntegrityQuarantine = "quarantine"
+)
+
+// ValidateIntegrity checks whether the integrity policy is a known one
+func ValidateIntegrity(policy string) error {
+	switch policy {
+	case IntegrityRefuse, IntegrityWarn, IntegrityQuarantine:
+		return nil
+	default:
+		return fmt.Errorf("invalid integrity policy '%s', expected one of: refuse, warn, quarantine", policy)
+	}
+}
+
+// IntegrityError represents the error returned when the snapshot file is corrupted
+// or was edited by hand, so it does not match its stored checksum
+type IntegrityError struct {
+	Path    string
+	Message string
+}
+
+func (e IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check of %s failed: %s", e.Path, e.Message)
+}
+
+// verify checks the snapshot against the stored checksum, or the checksum of
+// a snapshot write which was interrupted before the config got updated
+// and applies the integrity policy to a corrupted snapshot
+func (d *DB) verify(bs []byte, entries []journalEntry) (*rawDocument, error) {
+	checksum, err := genChecksum(bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	doc, parseErr := parseDocument(bs)
+	var e *IntegrityError
+	switch {
+	case parseErr != nil:
+		e = &IntegrityError{Path: d.dbPath, Message: parseErr.Error()}
+	case d.cfg.Checksum != "" && d.cfg.Checksum != checksum && !snapshotIntended(entries, checksum):
+		e = &IntegrityError{
+			Path:    d.dbPath,
+			Message: fmt.Sprintf("checksum %s does not match the stored %s", checksum, d.cfg.Checksum),
+		}
+	default:
+		d.cfg.Checksum = checksum
+		return doc, nil
+	}
+
+	switch {
+	case d.integrity == IntegrityWarn && parseErr == nil:
+		log.Printf("warning: %v, loading it anyway", e)
+		// the config is rewritten with the current checksum by the next save
+		d.cfg.Checksum = checksum
+		return doc, nil
+	case d.integrity == IntegrityQuarantine:
+		path := fmt.Sprintf("%s.quarantine-%s", d.dbPath, time.Now().Format("20060102T150405"))
+		if err := os.Rename(d.dbPath, path); err != nil {
+			return nil, models.WrapError("could not quarantine db file", err)
+		}
+		log.Printf("%v, moved it to %s and starting with an empty db", e, path)
+		empty, err := encodeSnapshot(nil, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.write(d.dbPath, empty); err != nil {
+			return nil, err
+		}
+		if d.cfg.Checksum, err = genChecksum(bytes.NewReader(empty)); err != nil {
+			return nil, err
+		}
+		// the config keeps the allocated ids, so they are not reused
+		if err := d.writeDBCfg(); err != nil {
+			return nil, err
+		}
+		return parseDocument(nil)
+	default:
+		return nil, fmt.Errorf("%v (run 'server fsck' or start with --integrity=warn)", e)
+	}
+}
+
+// snapshotIntended reports whether the journal records a write of a snapshot with the checksum
+func snapshotIntended(entries []journalEntry, checksum string) bool {
+	for _, entry := range entries {
+		if entry.Op == opSnapshot && entry.Checksum == checksum {
+			return true
+		}
+	}
+	return false
+}
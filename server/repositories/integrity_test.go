@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// corruptDB saves reminders 1 to 3 to a db, then edits its snapshot by hand
+// so it no longer matches its checksum: reminder 2 gets an unknown status,
+// reminder 3 a negative duration and, with duplicate, reminder 1 gets a later copy
+// it retrieves the directory of the db & the corrupted snapshot
+func corruptDB(t *testing.T, duplicate bool) (string, []byte) {
+	t.Helper()
+	dir := tempDir(t)
+	db := startDB(t, dir)
+	for i := 0; i < 3; i++ {
+		if _, err := db.NextID(); err != nil {
+			t.Fatalf("could not allocate an id: %v", err)
+		}
+	}
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	if _, err := db.Save(db.Mark(), []models.Reminder{r1, r2, r3}); err != nil {
+		t.Fatalf("could not save db: %v", err)
+	}
+	stopDB(t, db)
+
+	r2.Status = "sleeping"
+	r3.Duration = -5
+	records := []models.Reminder{r1, r2, r3}
+	if duplicate {
+		dup := testReminder(1, "one again")
+		dup.ModifiedAt = dup.ModifiedAt.Add(time.Hour)
+		records = append(records, dup)
+	}
+	bs, err := encodeSnapshot(records, "")
+	if err != nil {
+		t.Fatalf("could not encode snapshot: %v", err)
+	}
+	image := with(readImage(t, dir), dbFile, bs)
+	return writeImage(t, image), bs
+}
+
+func TestIntegrityRefuse(t *testing.T) {
+	for _, duplicate := range []bool{false, true} {
+		dir, corrupted := corruptDB(t, duplicate)
+		path := filepath.Join(dir, dbFile)
+		db := NewDB(Options{Path: path, Integrity: IntegrityRefuse})
+		err := db.Start()
+		if err == nil {
+			stopDB(t, db)
+			t.Fatalf("duplicate %v: expected a corrupted db to abort the start", duplicate)
+		}
+		if !strings.Contains(err.Error(), "integrity check") || !strings.Contains(err.Error(), "fsck") {
+			t.Errorf("duplicate %v: expected an integrity error pointing to fsck, got: %v", duplicate, err)
+		}
+		if bs := readFile(t, path); string(bs) != string(corrupted) {
+			t.Errorf("duplicate %v: expected a refused db to be left untouched", duplicate)
+		}
+	}
+}
+
+func TestIntegrityWarn(t *testing.T) {
+	dir, _ := corruptDB(t, false)
+	path := filepath.Join(dir, dbFile)
+	db := NewDB(Options{Path: path, Integrity: IntegrityWarn})
+	if err := db.Start(); err != nil {
+		t.Fatalf("expected a corrupted db to be loaded, got: %v", err)
+	}
+	got, err := db.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query db: %v", err)
+	}
+	if !reflect.DeepEqual(ids(got), []int{1, 2, 3}) || got[1].Status != "sleeping" || got[2].Duration != -5 {
+		t.Errorf("expected the reminders to be loaded as they are, got %+v", got)
+	}
+	stopDB(t, db)
+	// the checksum was updated, so the db is no longer refused
+	stopDB(t, startDB(t, dir))
+
+	// duplicate ids are never loaded, whatever the policy
+	dir, _ = corruptDB(t, true)
+	db = NewDB(Options{Path: filepath.Join(dir, dbFile), Integrity: IntegrityWarn})
+	if err := db.Start(); err == nil {
+		stopDB(t, db)
+		t.Error("expected duplicate ids to abort the start")
+	} else if !strings.Contains(err.Error(), "1") {
+		t.Errorf("expected the error to name the duplicate id, got: %v", err)
+	}
+}
+
+func TestIntegrityQuarantine(t *testing.T) {
+	dir, corrupted := corruptDB(t, true)
+	path := filepath.Join(dir, dbFile)
+	db := NewDB(Options{Path: path, Integrity: IntegrityQuarantine})
+	if err := db.Start(); err != nil {
+		t.Fatalf("expected a corrupted db to be quarantined, got: %v", err)
+	}
+	got, err := db.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query db: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected an empty db, got %v", ids(got))
+	}
+	id, err := db.NextID()
+	if err != nil {
+		t.Fatalf("could not allocate an id: %v", err)
+	}
+	if id <= 3 {
+		t.Errorf("expected the ids of the quarantined reminders to not be reused, got %d", id)
+	}
+	stopDB(t, db)
+
+	quarantined, err := filepath.Glob(path + ".quarantine-*")
+	if err != nil || len(quarantined) != 1 {
+		t.Fatalf("expected a single quarantine file, got %v (%v)", quarantined, err)
+	}
+	if bs := readFile(t, quarantined[0]); string(bs) != string(corrupted) {
+		t.Errorf("expected %s to hold the corrupted db", quarantined[0])
+	}
+	stopDB(t, startDB(t, dir))
+}
+
+func TestFsck(t *testing.T) {
+	dir, corrupted := corruptDB(t, true)
+	path := filepath.Join(dir, dbFile)
+	cfgPath := filepath.Join(dir, cfgFile)
+
+	report, err := Fsck(path, cfgPath, false)
+	if err != nil {
+		t.Fatalf("could not check db: %v", err)
+	}
+	problems := strings.Join(report.Problems, "\n")
+	for _, want := range []string{
+		"checksum",
+		"id 1 is used by several records",
+		"reminder 2 has an unknown status 'sleeping'",
+		"reminder 3 is pending with a negative duration",
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("expected a problem mentioning %q, got:\n%s", want, problems)
+		}
+	}
+	if report.Records != 4 || report.Repaired || report.Backup != "" {
+		t.Errorf("expected 4 records to be checked without repairing them, got %+v", report)
+	}
+	if bs := readFile(t, path); string(bs) != string(corrupted) {
+		t.Error("expected checking to leave the db untouched")
+	}
+
+	report, err = Fsck(path, cfgPath, true)
+	if err != nil {
+		t.Fatalf("could not repair db: %v", err)
+	}
+	if !report.Repaired || report.Kept != 3 {
+		t.Errorf("expected 3 repaired reminders, got %+v", report)
+	}
+	if bs := readFile(t, report.Backup); string(bs) != string(corrupted) {
+		t.Errorf("expected %s to hold the corrupted db", report.Backup)
+	}
+
+	if report, err := Fsck(path, cfgPath, false); err != nil || len(report.Problems) != 0 {
+		t.Errorf("expected a repaired db to have no problems, got %v (%v)", report.Problems, err)
+	}
+	db := startDB(t, dir)
+	defer stopDB(t, db)
+	got, err := db.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query db: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 reminders, got %v", ids(got))
+	}
+	if got[0].Title != "one again" {
+		t.Errorf("expected the latest copy of reminder 1 to be kept, got %q", got[0].Title)
+	}
+	if got[1].Status != models.StatusPending || got[2].Duration != 0 {
+		t.Errorf("expected the status & the duration to be repaired, got %+v", got[1:])
+	}
+}
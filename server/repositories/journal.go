@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// journal operations
+const (
+	opPut      = "put"
+	opDelete   = "delete"
+	opID       = "id"
+	opSnapshot = "snapshot"
+)
+
+// journalEntry represents a single mutation recorded in the write-ahead journal
+type journalEntry struct {
+	Op       string           `json:"op"`
+	Reminder *models.Reminder `json:"reminder,omitempty"`
+	ID       int              `json:"id,omitempty"`
+	Checksum string           `json:"checksum,omitempty"`
+}
+
+// openJournal opens (or creates) the append-only journal file
+func openJournal(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, models.WrapError("could not open journal file", err)
+	}
+	return f, nil
+}
+
+// readJournal reads all the complete entries from the journal
+// a torn trailing entry, left by a crash in the middle of an append, is discarded
+func readJournal(f *os.File) ([]journalEntry, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, models.WrapError("could not seek journal file", err)
+	}
+	return decodeJournal(f)
+}
+
+// decodeJournal decodes the complete journal entries of r
+func decodeJournal(r io.Reader) ([]journalEntry, error) {
+	var entries []journalEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Printf("discarding torn journal entry after %d entries: %v", len(entries), err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, models.WrapError("could not read journal file", err)
+	}
+	return entries, nil
+}
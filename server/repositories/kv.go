@@ -0,0 +1,272 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// kv file record operations
+const (
+	kvPut    byte = 1
+	kvDelete byte = 2
+	kvCommit byte = 3
+)
+
+const (
+	// crc32 + operation + key length + value length
+	kvHeaderSize = 4 + 1 + 4 + 4
+	kvMaxKeySize = 1 << 16
+	kvMaxValSize = 1 << 30
+	// compaction only kicks in after this many overwritten records
+	kvCompactMin = 128
+)
+
+// kvOp represents a single write of a kv transaction
+type kvOp struct {
+	op    byte
+	key   string
+	value []byte
+}
+
+// kvFile represents an embedded key-value database kept in a single append-only file
+// writes are grouped in transactions, whose records are followed by a commit record
+// and synced before returning, so after a crash either all or none of them are applied
+// the live keys are kept in memory, overwritten records are reclaimed by compaction
+// it is not safe for concurrent use
+type kvFile struct {
+	path string
+	f    *os.File
+	data map[string][]byte
+	size int64
+	dead int
+}
+
+// openKV opens (or creates) a kv file and loads its committed records
+func openKV(path string) (*kvFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, models.WrapError("could not open kv file", err)
+	}
+	kv := &kvFile{path: path, f: f, data: map[string][]byte{}}
+	if err := kv.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return kv, nil
+}
+
+// load replays the committed transactions of the file
+// a torn or corrupted tail, left by a crash in the middle of a commit, is truncated
+func (kv *kvFile) load() error {
+	bs, err := ioutil.ReadAll(kv.f)
+	if err != nil {
+		return models.WrapError("could not read kv file", err)
+	}
+	var pending []kvOp
+	var committed, off int
+	for off < len(bs) {
+		op, next, err := decodeKVRecord(bs, off)
+		if err != nil {
+			log.Printf("discarding kv records after offset %d: %v", committed, err)
+			break
+		}
+		off = next
+		if op.op != kvCommit {
+			pending = append(pending, op)
+			continue
+		}
+		for _, op := range pending {
+			kv.apply(op)
+		}
+		pending = pending[:0]
+		committed = off
+	}
+	if committed < len(bs) {
+		log.Printf("truncating %d byte(s) of uncommitted kv records", len(bs)-committed)
+		if err := kv.f.Truncate(int64(committed)); err != nil {
+			return models.WrapError("could not truncate kv file", err)
+		}
+	}
+	kv.size = int64(committed)
+	return nil
+}
+
+// get fetches the value of a key
+func (kv *kvFile) get(key string) ([]byte, bool) {
+	v, ok := kv.data[key]
+	return v, ok
+}
+
+// keys retrieves the sorted keys which start with the prefix
+func (kv *kvFile) keys(prefix string) []string {
+	var keys []string
+	for k := range kv.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// commit durably writes a transaction and retrieves the number of bytes written
+func (kv *kvFile) commit(ops []kvOp) (int, error) {
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	for _, op := range ops {
+		if err := encodeKVRecord(&buf, op); err != nil {
+			return 0, err
+		}
+	}
+	_ = encodeKVRecord(&buf, kvOp{op: kvCommit})
+	n, err := kv.f.Write(buf.Bytes())
+	if err == nil {
+		err = kv.f.Sync()
+	}
+	if err != nil {
+		// drop the partial transaction, so later commits don't follow a torn one
+		_ = kv.f.Truncate(kv.size)
+		return 0, models.WrapError("could not commit kv transaction", err)
+	}
+	for _, op := range ops {
+		kv.apply(op)
+	}
+	kv.size += int64(n)
+	return n, nil
+}
+
+// shouldCompact reports whether the overwritten records outweigh the live ones
+func (kv *kvFile) shouldCompact() bool {
+	return kv.dead >= kvCompactMin && kv.dead > len(kv.data)
+}
+
+// compact rewrites the live keys to a new file, which atomically replaces the old one
+func (kv *kvFile) compact() error {
+	ops := make([]kvOp, 0, len(kv.data))
+	for _, k := range kv.keys("") {
+		ops = append(ops, kvOp{op: kvPut, key: k, value: kv.data[k]})
+	}
+	var buf bytes.Buffer
+	for _, op := range ops {
+		if err := encodeKVRecord(&buf, op); err != nil {
+			return err
+		}
+	}
+	_ = encodeKVRecord(&buf, kvOp{op: kvCommit})
+
+	tmpPath := kv.path + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return models.WrapError("could not create compacted kv file", err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return models.WrapError("could not write compacted kv file", err)
+	}
+	if err := os.Rename(tmpPath, kv.path); err != nil {
+		return models.WrapError("could not replace kv file", err)
+	}
+	syncDir(filepath.Dir(kv.path))
+
+	f, err := os.OpenFile(kv.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return models.WrapError("could not reopen kv file", err)
+	}
+	_ = kv.f.Close()
+	kv.f = f
+	kv.size = int64(buf.Len())
+	kv.dead = 0
+	log.Printf("compacted %s to %d key(s)", kv.path, len(kv.data))
+	return nil
+}
+
+// close closes the kv file
+func (kv *kvFile) close() error {
+	if err := kv.f.Close(); err != nil {
+		return models.WrapError("could not close kv file", err)
+	}
+	return nil
+}
+
+// apply applies a committed write to the in memory keys
+func (kv *kvFile) apply(op kvOp) {
+	_, exists := kv.data[op.key]
+	switch op.op {
+	case kvPut:
+		if exists {
+			kv.dead++
+		}
+		kv.data[op.key] = op.value
+	case kvDelete:
+		if exists {
+			// both the deleted record and the tombstone are garbage
+			kv.dead += 2
+			delete(kv.data, op.key)
+		}
+	}
+}
+
+// encodeKVRecord encodes a single record:
+// crc32 | operation | key length | value length | key | value
+func encodeKVRecord(buf *bytes.Buffer, op kvOp) error {
+	if len(op.key) > kvMaxKeySize || len(op.value) > kvMaxValSize {
+		return errors.New("kv record is too large")
+	}
+	rec := make([]byte, kvHeaderSize, kvHeaderSize+len(op.key)+len(op.value))
+	rec[4] = op.op
+	binary.LittleEndian.PutUint32(rec[5:9], uint32(len(op.key)))
+	binary.LittleEndian.PutUint32(rec[9:13], uint32(len(op.value)))
+	rec = append(rec, op.key...)
+	rec = append(rec, op.value...)
+	binary.LittleEndian.PutUint32(rec[0:4], crc32.ChecksumIEEE(rec[4:]))
+	buf.Write(rec)
+	return nil
+}
+
+// decodeKVRecord decodes the record at the offset and retrieves the offset of the next one
+func decodeKVRecord(bs []byte, off int) (kvOp, int, error) {
+	if len(bs)-off < kvHeaderSize {
+		return kvOp{}, 0, errors.New("torn record header")
+	}
+	h := bs[off : off+kvHeaderSize]
+	keyLen := int(binary.LittleEndian.Uint32(h[5:9]))
+	valLen := int(binary.LittleEndian.Uint32(h[9:13]))
+	if keyLen > kvMaxKeySize || valLen > kvMaxValSize {
+		return kvOp{}, 0, errors.New("corrupted record header")
+	}
+	end := off + kvHeaderSize + keyLen + valLen
+	if end > len(bs) {
+		return kvOp{}, 0, errors.New("torn record")
+	}
+	if crc32.ChecksumIEEE(bs[off+4:end]) != binary.LittleEndian.Uint32(h[0:4]) {
+		return kvOp{}, 0, errors.New("record checksum mismatch")
+	}
+	keyStart := off + kvHeaderSize
+	op := kvOp{
+		op:    h[4],
+		key:   string(bs[keyStart : keyStart+keyLen]),
+		value: append([]byte(nil), bs[keyStart+keyLen:end]...),
+	}
+	if op.op != kvPut && op.op != kvDelete && op.op != kvCommit {
+		return kvOp{}, 0, errors.New("unknown record operation")
+	}
+	return op, end, nil
+}
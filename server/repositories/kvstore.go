@@ -0,0 +1,325 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+const (
+	kvRemindersPrefix = "reminders/"
+	kvSeqKey          = "meta/seq"
+)
+
+// KVStore represents the reminders storage on top of the embedded key-value file
+// reminders are stored as json values under 'reminders/<id>' keys, so they are
+// kept in id order, and the AUTOINCREMENT sequence under the 'meta/seq' key
+// it is safe for concurrent use
+type KVStore struct {
+	mu          sync.Mutex
+	path        string
+	lock        *fileLock
+	waitForLock bool
+	kv          *kvFile
+	seq         int
+	// mutations counts the puts & deletes, mutated holds the count of the
+	// last one of every key, so a save does not undo the mutations after its mark
+	mutations int64
+	mutated   map[string]int64
+}
+
+func init() {
+	Register("kv", Driver{
+		DefaultPath: "db.kv",
+		New: func(opts Options) Store {
+			return NewKVStore(opts)
+		},
+	})
+}
+
+// NewKVStore creates a new instance of the key-value reminders storage
+func NewKVStore(opts Options) *KVStore {
+	return &KVStore{path: opts.Path, waitForLock: opts.WaitForLock, mutated: map[string]int64{}}
+}
+
+// Start locks and opens the key-value file, dropping any uncommitted transaction
+func (s *KVStore) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, err := acquireLock(s.path+".lock", s.waitForLock)
+	if err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		if s.kv != nil {
+			_ = s.kv.close()
+			s.kv = nil
+		}
+		_ = lock.release()
+		return err
+	}
+	s.lock = lock
+	return nil
+}
+
+// open opens the key-value file and checks the stored reminders
+func (s *KVStore) open() error {
+	kv, err := openKV(s.path)
+	if err != nil {
+		return err
+	}
+	s.kv = kv
+	if v, ok := kv.get(kvSeqKey); ok {
+		seq, err := strconv.Atoi(string(v))
+		if err != nil {
+			return models.WrapError("could not parse kv sequence", err)
+		}
+		s.seq = seq
+	}
+	var reminders []models.Reminder
+	for _, key := range kv.keys(kvRemindersPrefix) {
+		v, _ := kv.get(key)
+		var reminder models.Reminder
+		if err := json.Unmarshal(v, &reminder); err != nil {
+			return models.WrapError(fmt.Sprintf("could not unmarshal kv reminder '%s'", key), err)
+		}
+		if id := kvReminderID(key); id != reminder.ID {
+			return fmt.Errorf("kv reminder '%s' holds a reminder with id: %d", key, reminder.ID)
+		}
+		reminders = append(reminders, reminder)
+		if reminder.ID > s.seq {
+			s.seq = reminder.ID
+		}
+	}
+	return checkCollisions(reminders)
+}
+
+// Get fetches a single reminder by id
+func (s *KVStore) Get(id int) (models.Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return models.Reminder{}, errors.New("kv store is not started")
+	}
+	v, ok := s.kv.get(kvReminderKey(id))
+	if !ok {
+		return models.Reminder{}, models.NotFoundError{
+			Message: fmt.Sprintf("could not find reminder with id: %d", id),
+		}
+	}
+	var reminder models.Reminder
+	if err := json.Unmarshal(v, &reminder); err != nil {
+		return models.Reminder{}, models.WrapError("could not unmarshal kv reminder", err)
+	}
+	return reminder, nil
+}
+
+// Put creates or replaces reminders in a single transaction
+func (s *KVStore) Put(reminders ...models.Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return errors.New("kv store is not started")
+	}
+	ops := make([]kvOp, 0, len(reminders))
+	for _, reminder := range reminders {
+		bs, err := json.Marshal(reminder)
+		if err != nil {
+			return models.WrapError("could not marshal kv reminder", err)
+		}
+		ops = append(ops, kvOp{op: kvPut, key: kvReminderKey(reminder.ID), value: bs})
+	}
+	if _, err := s.kv.commit(ops); err != nil {
+		return err
+	}
+	s.mutate(ops)
+	return nil
+}
+
+// Delete deletes reminders in a single transaction
+func (s *KVStore) Delete(ids ...int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return errors.New("kv store is not started")
+	}
+	var ops []kvOp
+	for _, id := range ids {
+		if _, ok := s.kv.get(kvReminderKey(id)); ok {
+			ops = append(ops, kvOp{op: kvDelete, key: kvReminderKey(id)})
+		}
+	}
+	if _, err := s.kv.commit(ops); err != nil {
+		return err
+	}
+	s.mutate(ops)
+	return nil
+}
+
+// mutate records the committed puts & deletes
+func (s *KVStore) mutate(ops []kvOp) {
+	s.mutations++
+	for _, op := range ops {
+		s.mutated[op.key] = s.mutations
+	}
+}
+
+// Mark retrieves the count of the puts & deletes, which a snapshot taken right now holds
+func (s *KVStore) Mark() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mutations
+}
+
+// Query fetches the reminders matching the filtering function, in id order
+func (s *KVStore) Query(filterFn func(reminder models.Reminder) bool) ([]models.Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return nil, errors.New("kv store is not started")
+	}
+	keys := s.kv.keys(kvRemindersPrefix)
+	res := make([]models.Reminder, 0, len(keys))
+	for _, key := range keys {
+		v, _ := s.kv.get(key)
+		var reminder models.Reminder
+		if err := json.Unmarshal(v, &reminder); err != nil {
+			return nil, models.WrapError(fmt.Sprintf("could not unmarshal kv reminder '%s'", key), err)
+		}
+		if filterFn == nil || filterFn(reminder) {
+			res = append(res, reminder)
+		}
+	}
+	return res, nil
+}
+
+// Scan calls fn for every reminder, in id order
+func (s *KVStore) Scan(fn func(reminder models.Reminder)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return errors.New("kv store is not started")
+	}
+	for _, key := range s.kv.keys(kvRemindersPrefix) {
+		v, _ := s.kv.get(key)
+		var reminder models.Reminder
+		if err := json.Unmarshal(v, &reminder); err != nil {
+			return models.WrapError(fmt.Sprintf("could not unmarshal kv reminder '%s'", key), err)
+		}
+		fn(reminder)
+	}
+	return nil
+}
+
+// Save replaces the stored reminders with the snapshot, writing only the changed ones
+// the reminders put or deleted after the mark are newer than the snapshot, so they are skipped
+func (s *KVStore) Save(mark int64, reminders []models.Reminder) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return 0, errors.New("kv store is not started")
+	}
+	var ops []kvOp
+	keep := make(map[string]bool, len(reminders))
+	for _, reminder := range reminders {
+		key := kvReminderKey(reminder.ID)
+		keep[key] = true
+		if s.mutated[key] > mark {
+			continue
+		}
+		bs, err := json.Marshal(reminder)
+		if err != nil {
+			return 0, models.WrapError("could not marshal kv reminder", err)
+		}
+		if v, ok := s.kv.get(key); ok && bytes.Equal(v, bs) {
+			continue
+		}
+		ops = append(ops, kvOp{op: kvPut, key: key, value: bs})
+	}
+	for _, key := range s.kv.keys(kvRemindersPrefix) {
+		if !keep[key] && s.mutated[key] <= mark {
+			ops = append(ops, kvOp{op: kvDelete, key: key})
+		}
+	}
+	n, err := s.kv.commit(ops)
+	if err != nil {
+		return 0, err
+	}
+	// the later saves are taken at a later mark, so they skip no mutation before this one
+	for key, count := range s.mutated {
+		if count <= mark {
+			delete(s.mutated, key)
+		}
+	}
+	if n > 0 {
+		log.Printf("successfully wrote %d byte(s) to %s file", n, s.path)
+	}
+	if s.kv.shouldCompact() {
+		if err := s.kv.compact(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// NextID allocates the next AUTOINCREMENT id for a reminder
+// the sequence is committed before the id is handed out
+func (s *KVStore) NextID() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kv == nil {
+		return 0, errors.New("kv store is not started")
+	}
+	id := s.seq + 1
+	op := kvOp{op: kvPut, key: kvSeqKey, value: []byte(strconv.Itoa(id))}
+	if _, err := s.kv.commit([]kvOp{op}); err != nil {
+		return 0, err
+	}
+	s.seq = id
+	return id, nil
+}
+
+// Stop closes the key-value file
+func (s *KVStore) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Println("shutting down the database")
+	if s.kv == nil {
+		return nil
+	}
+	if s.kv.shouldCompact() {
+		if err := s.kv.compact(); err != nil {
+			return err
+		}
+	}
+	err := s.kv.close()
+	s.kv = nil
+	if err != nil {
+		return err
+	}
+	if err := s.lock.release(); err != nil {
+		return err
+	}
+	s.lock = nil
+	log.Println("database was successfully shut down")
+	return nil
+}
+
+// kvReminderKey retrieves the key of a reminder
+// ids are zero padded, so the keys sort in id order
+func kvReminderKey(id int) string {
+	return fmt.Sprintf("%s%020d", kvRemindersPrefix, id)
+}
+
+// kvReminderID retrieves the reminder id from its key
+func kvReminderID(key string) int {
+	id, _ := strconv.Atoi(strings.TrimPrefix(key, kvRemindersPrefix))
+	return id
+}
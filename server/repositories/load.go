@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// snapshotStats represents what loading the snapshot file found out about it
+type snapshotStats struct {
+	size  int64
+	count int
+	maxID int
+}
+
+// checkSnapshot checks a snapshot of the current schema version without decoding its records:
+// the file is hashed as it is and only its envelope is decoded, up to the reminders array
+// the records are checked by the first readSnapshot which reads them all, so they are decoded once
+// false is retrieved when the snapshot has to be loaded by loadDocument:
+// it is missing, has no stored checksum, fails it, is of an older schema version
+// or its envelope is malformed
+func (d *DB) checkSnapshot(entries []journalEntry) (snapshotStats, bool, error) {
+	var stats snapshotStats
+	f, err := os.Open(d.dbPath)
+	if err != nil {
+		return stats, false, nil
+	}
+	defer d.close(f)
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return stats, false, nil
+	}
+	checksum, err := genChecksum(bufio.NewReader(f))
+	if err != nil {
+		return stats, false, err
+	}
+	// without a checksum, the records are not known to be written the way readSnapshot reads them
+	if d.cfg.Checksum == "" || (d.cfg.Checksum != checksum && !snapshotIntended(entries, checksum)) {
+		return stats, false, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return stats, false, models.WrapError("could not read db file", err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return stats, false, nil
+	}
+	var version int
+	var createdBy string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return stats, false, nil
+		}
+		switch t {
+		case "schema_version":
+			err = dec.Decode(&version)
+		case "created_by":
+			err = dec.Decode(&createdBy)
+		case "reminders":
+			// the envelope is written with the schema version first,
+			// any other file goes through the migrations
+			if version != SchemaVersion {
+				return stats, false, nil
+			}
+			d.cfg.Checksum = checksum
+			d.createdBy = createdBy
+			d.unchecked = true
+			stats.size = info.Size()
+			return stats, true, nil
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return stats, false, nil
+		}
+	}
+	return stats, false, nil
+}
+
+// recordCheck checks the records of the snapshot file as readSnapshot decodes them
+// ids are unique as long as they ascend, so only the uids are collected
+type recordCheck struct {
+	stats snapshotStats
+	c     collisions
+}
+
+// add checks the next record
+func (rc *recordCheck) add(reminder models.Reminder) error {
+	if reminder.ID <= rc.stats.maxID {
+		return fmt.Errorf(
+			"reminder %d does not come after reminder %d (run 'server fsck --repair')", reminder.ID, rc.stats.maxID,
+		)
+	}
+	rc.c.add(models.Reminder{ID: reminder.ID, UID: reminder.UID}, false)
+	rc.stats.count++
+	rc.stats.maxID = reminder.ID
+	return nil
+}
+
+// readSnapshot calls fn for every record of the snapshot file, in id order, until fn retrieves false
+// the file is decoded one record at a time, it was verified (or written) when the db was started
+// and the first read of all its records checks them, the caller must hold the lock
+func (d *DB) readSnapshot(fn func(reminder models.Reminder) bool) error {
+	f, err := os.Open(d.dbPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return models.WrapError("could not open db file", err)
+	}
+	defer d.close(f)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if _, err := dec.Token(); err != nil {
+		return models.WrapError("could not decode db snapshot", err)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return models.WrapError("could not decode db snapshot", err)
+		}
+		if t != "reminders" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return models.WrapError("could not decode db snapshot", err)
+			}
+			continue
+		}
+		if !d.unchecked {
+			if _, err := decodeRecords(dec, fn); err != nil {
+				return models.WrapError("could not decode db snapshot", err)
+			}
+			return nil
+		}
+		var check recordCheck
+		var invalid error
+		complete, err := decodeRecords(dec, func(reminder models.Reminder) bool {
+			if invalid = check.add(reminder); invalid != nil {
+				return false
+			}
+			return fn(reminder)
+		})
+		if err != nil {
+			return models.WrapError("could not decode db snapshot", err)
+		}
+		if invalid != nil {
+			return fmt.Errorf("invalid db snapshot %s: %v", d.dbPath, invalid)
+		}
+		if complete {
+			if err := check.c.err(); err != nil {
+				return err
+			}
+			d.unchecked = false
+			// files written before ids were journaled can hold ids beyond the stored one
+			if check.stats.maxID > d.cfg.ID {
+				d.cfg.ID = check.stats.maxID
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// decodeRecords decodes the reminders array one record at a time, until fn retrieves false
+// true is retrieved once the whole array was decoded
+func decodeRecords(dec *json.Decoder, fn func(reminder models.Reminder) bool) (bool, error) {
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return false, err
+	}
+	for dec.More() {
+		var reminder models.Reminder
+		if err := dec.Decode(&reminder); err != nil {
+			return false, err
+		}
+		if !fn(reminder) {
+			return false, nil
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// lockRetryPeriod is how often a standby server retries to acquire the lock
+const lockRetryPeriod = time.Second
+
+// lockHolder represents the process which holds the database lock
+type lockHolder struct {
+	PID        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockError represents the error returned when another process holds the database lock
+type LockError struct {
+	Path   string
+	Holder lockHolder
+}
+
+func (e LockError) Error() string {
+	if e.Holder.PID == 0 {
+		return fmt.Sprintf("database is locked by another process (%s)", e.Path)
+	}
+	return fmt.Sprintf(
+		"database is locked by pid %d on host %s since %s (%s)",
+		e.Holder.PID, e.Holder.Hostname, e.Holder.AcquiredAt.Format(time.RFC3339), e.Path,
+	)
+}
+
+// fileLock represents an advisory, single writer lock on the database
+// the lock itself is an flock on the lock file, which the OS releases when the
+// process dies, so a lock file left behind by a crash never blocks a restart
+// the lock file only tells who the holder is
+type fileLock struct {
+	path string
+	f    *os.File
+}
+
+// acquireLock acquires the lock, or retrieves a LockError naming its holder
+// with wait, it blocks (as a hot standby) until the holder releases the lock
+func acquireLock(path string, wait bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, models.WrapError("could not open lock file", err)
+	}
+	waiting := false
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, models.WrapError("could not lock database", err)
+		}
+		if locked {
+			break
+		}
+		e := LockError{Path: path, Holder: readLockHolder(path)}
+		if !wait {
+			_ = f.Close()
+			return nil, e
+		}
+		if !waiting {
+			log.Printf("waiting for the lock: %v", e)
+			waiting = true
+		}
+		time.Sleep(lockRetryPeriod)
+	}
+	if waiting {
+		log.Println("acquired the database lock, taking over")
+	}
+
+	hostname, _ := os.Hostname()
+	bs, _ := json.Marshal(lockHolder{PID: os.Getpid(), Hostname: hostname, AcquiredAt: time.Now()})
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt(append(bs, '\n'), 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		_ = unlock(f)
+		_ = f.Close()
+		return nil, models.WrapError("could not write lock file", err)
+	}
+	return &fileLock{path: path, f: f}, nil
+}
+
+// release releases the lock
+// the lock file is emptied rather than removed, because removing it would let
+// a waiting process lock the removed file while a new one locks a new file
+func (l *fileLock) release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	_ = l.f.Truncate(0)
+	err := unlock(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f = nil
+	if err != nil {
+		return models.WrapError("could not release database lock", err)
+	}
+	return nil
+}
+
+// readLockHolder reads who holds the lock, from the lock file
+func readLockHolder(path string) lockHolder {
+	var holder lockHolder
+	bs, err := ioutil.ReadFile(path)
+	if err == nil {
+		_ = json.Unmarshal(bs, &holder)
+	}
+	return holder
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package repositories
+
+import (
+	"log"
+	"os"
+)
+
+// tryLock always succeeds, advisory locks are not supported on this platform
+// the lock file is still written, so it tells which server uses the database
+func tryLock(f *os.File) (bool, error) {
+	log.Println("warning: database locking is not supported on this platform")
+	return true, nil
+}
+
+// unlock does nothing, advisory locks are not supported on this platform
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockRefusesSecondOpen(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, dbFile)
+	first := startDB(t, dir)
+
+	second := NewDB(Options{Path: path, Integrity: IntegrityRefuse})
+	err := second.Start()
+	if err == nil {
+		stopDB(t, second)
+		stopDB(t, first)
+		t.Fatal("expected a second open of the db to fail")
+	}
+	e, ok := err.(LockError)
+	if !ok {
+		stopDB(t, first)
+		t.Fatalf("expected a lock error, got: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	if e.Holder.PID != os.Getpid() || e.Holder.Hostname != hostname || e.Holder.AcquiredAt.IsZero() {
+		t.Errorf("expected the lock error to name this process, got %+v", e.Holder)
+	}
+	if !strings.Contains(e.Error(), "locked by pid") {
+		t.Errorf("expected the error to name the holder, got: %v", e)
+	}
+	if _, err := Fsck(path, filepath.Join(dir, cfgFile), false); err == nil {
+		t.Error("expected fsck to refuse a db in use")
+	}
+
+	// stopping releases the lock, which is emptied rather than removed
+	stopDB(t, first)
+	if holder := readLockHolder(path + ".lock"); holder.PID != 0 {
+		t.Errorf("expected a released lock to name no holder, got %+v", holder)
+	}
+	stopDB(t, startDB(t, dir))
+}
+
+func TestLockStandbyTakesOver(t *testing.T) {
+	dir := tempDir(t)
+	first := startDB(t, dir)
+
+	standby := NewDB(Options{Path: filepath.Join(dir, dbFile), Integrity: IntegrityRefuse, WaitForLock: true})
+	started := make(chan error, 1)
+	go func() {
+		started <- standby.Start()
+	}()
+	select {
+	case err := <-started:
+		t.Fatalf("expected the standby to wait for the lock, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stopDB(t, first)
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("expected the standby to take over, got: %v", err)
+		}
+		stopDB(t, standby)
+	case <-time.After(5 * lockRetryPeriod):
+		t.Fatal("expected the standby to take over once the lock is released")
+	}
+}
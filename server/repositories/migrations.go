@@ -0,0 +1,252 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server"
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// SchemaVersion is the version of the db.json schema written by this server
+const SchemaVersion = 5
+
+// dbSnapshot represents the versioned envelope of the db.json file
+type dbSnapshot struct {
+	SchemaVersion int               `json:"schema_version"`
+	CreatedBy     string            `json:"created_by"`
+	UpdatedBy     string            `json:"updated_by"`
+	Reminders     []models.Reminder `json:"reminders"`
+}
+
+// rawRecord represents a reminder record of any schema version
+// numbers are kept as json.Number, so they are not rounded
+type rawRecord map[string]interface{}
+
+// rawDocument represents the db.json contents of any schema version, as migrations see them
+type rawDocument struct {
+	Version   int
+	CreatedBy string
+	Records   []rawRecord
+}
+
+// migration represents a single step, which upgrades a document to the next schema version
+// it retrieves a description of every change it made
+type migration struct {
+	Version     int
+	Description string
+	Migrate     func(doc *rawDocument) []string
+}
+
+// MigrationStep represents a migration which was (or would be) applied to a document
+type MigrationStep struct {
+	Version     int
+	Description string
+	Changes     []string
+}
+
+// migrations holds every schema upgrade step, in order
+// version 0 is the bare json array written before the schema was versioned
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "wrap the reminders in a versioned envelope",
+		Migrate: func(doc *rawDocument) []string {
+			doc.CreatedBy = "unknown"
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "drop the zero value records left by index based persistence",
+		Migrate: func(doc *rawDocument) []string {
+			var changes []string
+			records := doc.Records[:0]
+			for i, r := range doc.Records {
+				if id, _ := r.int("id"); id <= 0 {
+					changes = append(changes, fmt.Sprintf("drop record %d with id %d", i, id))
+					continue
+				}
+				records = append(records, r)
+			}
+			doc.Records = records
+			return changes
+		},
+	},
+	{
+		Version:     3,
+		Description: "add the lifecycle status, completion used to be a negative duration",
+		Migrate: func(doc *rawDocument) []string {
+			var changes []string
+			for _, r := range doc.Records {
+				if _, ok := r["status"]; ok {
+					continue
+				}
+				id, _ := r.int("id")
+				status := models.StatusPending
+				if d, _ := r.int("duration"); d < 0 {
+					status = models.StatusCompleted
+					r["completed_at"] = r["modified_at"]
+				}
+				r["status"] = string(status)
+				changes = append(changes, fmt.Sprintf("reminder %d: set status '%s'", id, status))
+			}
+			return changes
+		},
+	},
+	{
+		Version:     4,
+		Description: "add the absolute due time, which used to be counted from the last modification",
+		Migrate: func(doc *rawDocument) []string {
+			var changes []string
+			for _, r := range doc.Records {
+				if dueAt, ok := r["due_at"].(string); ok && dueAt != "" && dueAt != (time.Time{}).Format(time.RFC3339) {
+					continue
+				}
+				id, _ := r.int("id")
+				d, _ := r.int("duration")
+				modifiedAt, _ := r["modified_at"].(string)
+				t, err := time.Parse(time.RFC3339Nano, modifiedAt)
+				if err != nil {
+					continue
+				}
+				due := t.Add(time.Duration(d))
+				r["due_at"] = due.Format(time.RFC3339Nano)
+				changes = append(changes, fmt.Sprintf("reminder %d: set due_at %s", id, due.Format(time.RFC3339)))
+			}
+			return changes
+		},
+	},
+	{
+		Version:     5,
+		Description: "assign the reminders to the default user, reminders used to have no owner",
+		Migrate: func(doc *rawDocument) []string {
+			var changes []string
+			for _, r := range doc.Records {
+				if owner, ok := r["owner"].(string); ok && owner != "" {
+					continue
+				}
+				id, _ := r.int("id")
+				r["owner"] = models.DefaultOwner
+				changes = append(changes, fmt.Sprintf("reminder %d: set owner '%s'", id, models.DefaultOwner))
+			}
+			return changes
+		},
+	},
+}
+
+// parseDocument parses the db.json contents of any schema version
+func parseDocument(bs []byte) (*rawDocument, error) {
+	doc := &rawDocument{}
+	if len(bytes.TrimSpace(bs)) == 0 {
+		doc.Version = SchemaVersion
+		return doc, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if bytes.HasPrefix(bytes.TrimSpace(bs), []byte("[")) {
+		if err := dec.Decode(&doc.Records); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	var envelope struct {
+		SchemaVersion int         `json:"schema_version"`
+		CreatedBy     string      `json:"created_by"`
+		Reminders     []rawRecord `json:"reminders"`
+	}
+	if err := dec.Decode(&envelope); err != nil {
+		return nil, err
+	}
+	if envelope.SchemaVersion <= 0 {
+		return nil, fmt.Errorf("invalid schema version %d", envelope.SchemaVersion)
+	}
+	doc.Version = envelope.SchemaVersion
+	doc.CreatedBy = envelope.CreatedBy
+	doc.Records = envelope.Reminders
+	return doc, nil
+}
+
+// migrate upgrades a document to the current schema version, step by step
+func migrate(doc *rawDocument) ([]MigrationStep, error) {
+	if doc.Version > SchemaVersion {
+		return nil, fmt.Errorf(
+			"schema version %d is newer than the version %d supported by this server (%s), upgrade the server",
+			doc.Version, SchemaVersion, server.Version,
+		)
+	}
+	var steps []MigrationStep
+	for _, m := range migrations {
+		if m.Version <= doc.Version {
+			continue
+		}
+		steps = append(steps, MigrationStep{
+			Version:     m.Version,
+			Description: m.Description,
+			Changes:     m.Migrate(doc),
+		})
+		doc.Version = m.Version
+	}
+	return steps, nil
+}
+
+// reminders decodes the records of a document of the current schema version
+func (doc *rawDocument) reminders() ([]models.Reminder, error) {
+	bs, err := json.Marshal(doc.Records)
+	if err != nil {
+		return nil, err
+	}
+	var reminders []models.Reminder
+	if err := json.Unmarshal(bs, &reminders); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// int reads an integer field of a record
+func (r rawRecord) int(key string) (int64, bool) {
+	n, ok := r[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := n.Int64()
+	return i, err == nil
+}
+
+// encodeSnapshot encodes the reminders in the versioned envelope
+func encodeSnapshot(reminders []models.Reminder, createdBy string) ([]byte, error) {
+	if createdBy == "" {
+		createdBy = server.Version
+	}
+	if reminders == nil {
+		reminders = []models.Reminder{}
+	}
+	bs, err := json.Marshal(dbSnapshot{
+		SchemaVersion: SchemaVersion,
+		CreatedBy:     createdBy,
+		UpdatedBy:     server.Version,
+		Reminders:     reminders,
+	})
+	if err != nil {
+		return nil, models.WrapError("could not marshal db snapshot", err)
+	}
+	return append(bs, '\n'), nil
+}
+
+// PlanMigrations retrieves the schema version of a json file DB
+// and the migrations which would upgrade it, without changing the file
+func PlanMigrations(dbPath string) (int, []MigrationStep, error) {
+	bs, err := readIfExists(dbPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	doc, err := parseDocument(bs)
+	if err != nil {
+		return 0, nil, models.WrapError("could not parse db file", err)
+	}
+	from := doc.Version
+	steps, err := migrate(doc)
+	return from, steps, err
+}
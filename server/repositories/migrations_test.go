@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// legacyDB retrieves a db.json written by the given schema version
+// it holds a pending reminder 1 & a completed reminder 3, and a zero record up to version 1
+func legacyDB(t *testing.T, version int) []byte {
+	t.Helper()
+	created := "2020-01-01T00:00:00Z"
+	completed := "2020-01-02T00:00:00Z"
+	r1 := map[string]interface{}{
+		"id": 1, "title": "one", "message": "m", "duration": int64(time.Hour),
+		"created_at": created, "modified_at": created,
+	}
+	r3 := map[string]interface{}{
+		"id": 3, "title": "three", "message": "m", "duration": -1,
+		"created_at": created, "modified_at": completed,
+	}
+	records := []map[string]interface{}{r1, r3}
+	if version < 2 {
+		zero := map[string]interface{}{
+			"id": 0, "title": "", "message": "", "duration": 0,
+			"created_at": "0001-01-01T00:00:00Z", "modified_at": "0001-01-01T00:00:00Z",
+		}
+		records = []map[string]interface{}{r1, zero, r3}
+	}
+	if version >= 3 {
+		r1["status"] = "pending"
+		r3["status"] = "completed"
+		r3["completed_at"] = completed
+	}
+	if version >= 4 {
+		r1["due_at"] = "2020-01-01T01:00:00Z"
+		r3["due_at"] = "2020-01-01T23:59:59.999999999Z"
+	}
+	if version >= 5 {
+		r1["owner"] = models.DefaultOwner
+		r3["owner"] = models.DefaultOwner
+	}
+	var doc interface{} = records
+	if version > 0 {
+		doc = map[string]interface{}{"schema_version": version, "created_by": "v0.1.0", "reminders": records}
+	}
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("could not marshal db: %v", err)
+	}
+	return bs
+}
+
+// migratedReminders retrieves the reminders of legacyDB, once migrated
+func migratedReminders() []models.Reminder {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	completed := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	return []models.Reminder{
+		{
+			ID:         1,
+			Owner:      models.DefaultOwner,
+			Title:      "one",
+			Message:    "m",
+			Duration:   time.Hour,
+			DueAt:      created.Add(time.Hour),
+			Status:     models.StatusPending,
+			CreatedAt:  created,
+			ModifiedAt: created,
+		},
+		{
+			ID:          3,
+			Owner:       models.DefaultOwner,
+			Title:       "three",
+			Message:     "m",
+			Duration:    -1,
+			DueAt:       completed.Add(-1),
+			Status:      models.StatusCompleted,
+			CompletedAt: &completed,
+			CreatedAt:   created,
+			ModifiedAt:  completed,
+		},
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	for version := 0; version <= SchemaVersion; version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			original := legacyDB(t, version)
+			dir := writeImage(t, map[string][]byte{dbFile: original})
+			path := filepath.Join(dir, dbFile)
+
+			from, steps, err := PlanMigrations(path)
+			if err != nil {
+				t.Fatalf("could not plan migrations: %v", err)
+			}
+			if from != version {
+				t.Errorf("expected schema version %d, got %d", version, from)
+			}
+			var planned []int
+			for _, step := range steps {
+				planned = append(planned, step.Version)
+				if step.Version == 2 && len(step.Changes) != 1 {
+					t.Errorf("expected the zero record to be dropped, got %v", step.Changes)
+				}
+			}
+			var want []int
+			for v := version + 1; v <= SchemaVersion; v++ {
+				want = append(want, v)
+			}
+			if !reflect.DeepEqual(planned, want) {
+				t.Errorf("expected migrations %v, got %v", want, planned)
+			}
+			if bs := readFile(t, path); string(bs) != string(original) {
+				t.Error("expected planning to leave the db untouched")
+			}
+
+			checkRecovered(t, map[string][]byte{dbFile: original}, migratedReminders(), nil, 3)
+
+			db := startDB(t, dir)
+			stopDB(t, db)
+			backup := fmt.Sprintf("%s.v%d.bak", path, version)
+			if version < SchemaVersion {
+				if bs := readFile(t, backup); string(bs) != string(original) {
+					t.Errorf("expected %s to hold the original db", backup)
+				}
+			} else if _, err := ioutil.ReadFile(backup); err == nil {
+				t.Errorf("expected no backup of a current db, got %s", backup)
+			}
+			var envelope struct {
+				SchemaVersion int    `json:"schema_version"`
+				CreatedBy     string `json:"created_by"`
+			}
+			if err := json.Unmarshal(readFile(t, path), &envelope); err != nil {
+				t.Fatalf("could not parse migrated db: %v", err)
+			}
+			wantCreatedBy := "v0.1.0"
+			if version == 0 {
+				wantCreatedBy = "unknown"
+			}
+			if envelope.SchemaVersion != SchemaVersion || envelope.CreatedBy != wantCreatedBy {
+				t.Errorf("expected schema version %d created by %s, got %+v", SchemaVersion, wantCreatedBy, envelope)
+			}
+		})
+	}
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	newer := []byte(fmt.Sprintf(`{"schema_version": %d, "created_by": "v9", "reminders": []}`, SchemaVersion+1))
+	dir := writeImage(t, map[string][]byte{dbFile: newer})
+	path := filepath.Join(dir, dbFile)
+
+	if _, _, err := PlanMigrations(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected planning to refuse a newer schema version, got: %v", err)
+	}
+	db := NewDB(Options{Path: path, Integrity: IntegrityRefuse})
+	if err := db.Start(); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected starting to refuse a newer schema version, got: %v", err)
+		if err == nil {
+			stopDB(t, db)
+		}
+	}
+	if bs := readFile(t, path); string(bs) != string(newer) {
+		t.Error("expected a newer db to be left untouched")
+	}
+}
+
+// readFile reads a file which the test expects to exist
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s: %v", path, err)
+	}
+	return bs
+}
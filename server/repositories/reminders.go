@@ -1,75 +1,84 @@
 package repositories
 
 import (
-	"encoding/json"
-	"io"
-
-	"github.com/gophertuts/reminders-cli/server"
 	"github.com/gophertuts/reminders-cli/server/models"
 	"github.com/gophertuts/reminders-cli/server/services"
 )
 
-// FileDB represents the file database
-type FileDB interface {
-	io.ReadWriter
-	server.Stopper
-	Size() int
-	GenerateID() int
-}
-
 // Reminders represents the Reminders repository (database layer)
 type Reminders struct {
-	DB FileDB
+	Store Store
 }
 
 // NewReminders creates a new instance of Reminder repository
-func NewReminders(db FileDB) *Reminders {
+func NewReminders(store Store) *Reminders {
 	return &Reminders{
-		DB: db,
+		Store: store,
 	}
 }
 
-// Save saves the current snapshot of reminders in the DB
-func (r Reminders) Save(reminders []models.Reminder) (int, error) {
-	bs, err := json.Marshal(reminders)
-	if err != nil {
-		return 0, err
-	}
-	n, err := r.DB.Write(bs)
-	if err != nil {
-		return 0, err
-	}
-	return n, nil
+// Mark retrieves the position of the last mutation in the DB, which the snapshot is taken at
+func (r Reminders) Mark() int64 {
+	return r.Store.Mark()
+}
+
+// Save saves the snapshot of reminders taken at the mark in the DB
+func (r Reminders) Save(mark int64, reminders []models.Reminder) (int, error) {
+	return r.Store.Save(mark, reminders)
+}
+
+// Put durably records created or updated reminders in the DB
+func (r Reminders) Put(reminders ...models.Reminder) error {
+	return r.Store.Put(reminders...)
+}
+
+// Remove durably records deleted reminders in the DB
+func (r Reminders) Remove(ids ...int) error {
+	return r.Store.Delete(ids...)
 }
 
 // Filter filters reminders by a filtering function
 func (r Reminders) Filter(filterFn func(reminder models.Reminder) bool) (services.RemindersMap, error) {
-	bs := make([]byte, r.DB.Size())
-	n, err := r.DB.Read(bs)
+	res := services.RemindersMap{}
+	err := r.Scan(func(reminder models.Reminder) {
+		if filterFn == nil || filterFn(reminder) {
+			res[reminder.ID] = reminder
+		}
+	})
 	if err != nil {
-		e := models.WrapError("could not read from db", err)
-		return services.RemindersMap{}, e
+		return services.RemindersMap{}, err
 	}
+	return res, nil
+}
 
-	var reminders []models.Reminder
-	err = json.Unmarshal(bs[:n], &reminders)
+// Scan calls fn for every reminder in the DB, in no particular order
+func (r Reminders) Scan(fn func(reminder models.Reminder)) error {
+	err := r.Store.Scan(func(reminder models.Reminder) {
+		migrateStatus(&reminder)
+		fn(reminder)
+	})
 	if err != nil {
-		e := models.WrapError("could not unmarshal json", err)
-		return services.RemindersMap{}, e
+		return models.WrapError("could not scan db", err)
 	}
+	return nil
+}
 
-	res := services.RemindersMap{}
-	for i, reminder := range reminders {
-		if filterFn == nil || filterFn(reminder) {
-			reminderMap := map[int]models.Reminder{}
-			reminderMap[i] = reminder
-			res[reminder.ID] = reminderMap
-		}
+// migrateStatus fills in the lifecycle state of records saved before it existed
+// completion used to be encoded by overwriting the duration with a negative one
+func migrateStatus(reminder *models.Reminder) {
+	if reminder.Status != "" {
+		return
 	}
-	return res, nil
+	if reminder.Duration < 0 {
+		completedAt := reminder.ModifiedAt
+		reminder.Status = models.StatusCompleted
+		reminder.CompletedAt = &completedAt
+		return
+	}
+	reminder.Status = models.StatusPending
 }
 
 // NextID fetches the next DB AUTOINCREMENT id
-func (r Reminders) NextID() int {
-	return r.DB.GenerateID()
+func (r Reminders) NextID() (int, error) {
+	return r.Store.NextID()
 }
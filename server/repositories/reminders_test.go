@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/services"
+)
+
+// TestRandomSequencesKeepEveryReminder runs seeded random sequences of creates, deletes,
+// saves & reloads through the service, against every storage driver
+// after every reload the stored reminders must be exactly the ones which were not deleted
+func TestRandomSequencesKeepEveryReminder(t *testing.T) {
+	const seeds, steps = 20, 200
+	admin := services.User{Name: models.DefaultOwner, Admin: true}
+	for _, driver := range Drivers() {
+		for seed := int64(1); seed <= seeds; seed++ {
+			driver, seed := driver, seed
+			t.Run(fmt.Sprintf("%s/seed=%d", driver, seed), func(t *testing.T) {
+				rnd := rand.New(rand.NewSource(seed))
+				path := filepath.Join(tempDir(t), "store")
+				var store Store
+				var service *services.Reminders
+				reload := func() {
+					t.Helper()
+					if store != nil {
+						if err := store.Stop(); err != nil {
+							t.Fatalf("could not stop store: %v", err)
+						}
+					}
+					var err error
+					if store, err = Open(driver, Options{Path: path, Integrity: IntegrityRefuse}); err != nil {
+						t.Fatalf("could not open store: %v", err)
+					}
+					if err := store.Start(); err != nil {
+						t.Fatalf("could not start store: %v", err)
+					}
+					service = services.NewReminders(NewReminders(store), services.MissedPolicy{Action: services.MissedDeliver}, services.IDModeInt)
+					if err := service.Populate(); err != nil {
+						t.Fatalf("could not populate service: %v", err)
+					}
+				}
+				reload()
+				defer func() { _ = store.Stop() }()
+
+				// titles holds the reminders which were created & not deleted, by id
+				titles := map[int]string{}
+				var history []string
+				for i := 0; i < steps; i++ {
+					switch op := rnd.Intn(10); {
+					case op < 5:
+						title := fmt.Sprintf("reminder %d", i)
+						r, err := service.Create(admin, services.ReminderCreateBody{
+							Title:    title,
+							Message:  "m",
+							Duration: time.Hour,
+						})
+						if err != nil {
+							t.Fatalf("could not create reminder: %v", err)
+						}
+						if _, ok := titles[r.ID]; ok || r.ID <= 0 {
+							t.Fatalf("created reminder with id %d after %v", r.ID, history)
+						}
+						titles[r.ID] = title
+						history = append(history, fmt.Sprintf("create %d", r.ID))
+					case op < 8 && len(titles) > 0:
+						id := randomID(rnd, titles)
+						if err := service.Delete(admin, []int{id}); err != nil {
+							t.Fatalf("could not delete reminder %d: %v", id, err)
+						}
+						delete(titles, id)
+						history = append(history, fmt.Sprintf("delete %d", id))
+					case op < 9:
+						saver := services.NewSaver(service, services.SavePolicy{Interval: time.Hour, Debounce: time.Hour})
+						go saver.Start()
+						if err := saver.Stop(); err != nil {
+							t.Fatalf("could not save: %v", err)
+						}
+						history = append(history, "save")
+					default:
+						reload()
+						history = append(history, "reload")
+						checkTitles(t, store, service, titles, history)
+					}
+				}
+				reload()
+				checkTitles(t, store, service, titles, history)
+			})
+		}
+	}
+}
+
+// randomID picks one of the ids, the ids are sorted first so the pick only depends on the seed
+func randomID(rnd *rand.Rand, titles map[int]string) int {
+	ids := make([]int, 0, len(titles))
+	for id := range titles {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids[rnd.Intn(len(ids))]
+}
+
+// checkTitles checks the stored & the populated reminders against the expected titles
+func checkTitles(t *testing.T, store Store, service *services.Reminders, titles map[int]string, history []string) {
+	t.Helper()
+	stored, err := store.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query store: %v", err)
+	}
+	got := map[int]string{}
+	for _, r := range stored {
+		if r.ID <= 0 {
+			t.Fatalf("stored a reminder with id %d after %v", r.ID, history)
+		}
+		got[r.ID] = r.Title
+	}
+	if !reflect.DeepEqual(got, titles) {
+		t.Fatalf("expected stored reminders %v, got %v after %v", titles, got, history)
+	}
+	ids := make([]int, 0, len(titles))
+	for id := range titles {
+		ids = append(ids, id)
+	}
+	fetched, err := service.Fetch(services.User{Name: models.DefaultOwner, Admin: true}, ids)
+	if err != nil {
+		t.Fatalf("could not fetch reminders after %v: %v", history, err)
+	}
+	if len(fetched) != len(ids) {
+		t.Fatalf("expected %d populated reminders, got %d after %v", len(ids), len(fetched), history)
+	}
+}
+
+// BenchmarkLoad measures starting the json db and populating the service from it
+// heap-MiB is the heap which is left in use once the reminders are loaded
+func BenchmarkLoad(b *testing.B) {
+	for _, n := range []int{100000, 1000000} {
+		b.Run(fmt.Sprintf("reminders=%d", n), func(b *testing.B) {
+			dir := tempDir(b)
+			db := startDB(b, dir)
+			// the reminders are pending, so loading them writes nothing
+			due := time.Now().Add(24 * time.Hour)
+			reminders := make([]models.Reminder, n)
+			for i := range reminders {
+				reminders[i] = testReminder(i+1, fmt.Sprintf("reminder %d", i+1))
+				reminders[i].DueAt = due.Add(time.Duration(i) * time.Second)
+			}
+			if _, err := db.Save(db.Mark(), reminders); err != nil {
+				b.Fatalf("could not save db: %v", err)
+			}
+			stopDB(b, db)
+			reminders = nil
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				db := startDB(b, dir)
+				service := services.NewReminders(NewReminders(db), services.MissedPolicy{Action: services.MissedDeliver}, services.IDModeInt)
+				if err := service.Populate(); err != nil {
+					b.Fatalf("could not populate service: %v", err)
+				}
+				b.StopTimer()
+				runtime.GC()
+				var mem runtime.MemStats
+				runtime.ReadMemStats(&mem)
+				b.ReportMetric(float64(mem.HeapAlloc)/(1<<20), "heap-MiB")
+				if loaded := service.LoadStats().Reminders; loaded != n {
+					b.Fatalf("expected %d loaded reminders, got %d", n, loaded)
+				}
+				stopDB(b, db)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gophertuts/reminders-cli/server"
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// Store represents a storage backend for reminders
+// every mutation must be durable once the call returns
+// implementations must be safe for concurrent use
+type Store interface {
+	server.Stopper
+	// Start opens the storage and recovers it from any unclean shutdown
+	Start() error
+	// Get fetches a single reminder, or a models.NotFoundError
+	Get(id int) (models.Reminder, error)
+	// Put creates or replaces reminders
+	Put(reminders ...models.Reminder) error
+	// Delete deletes reminders, missing ids are ignored
+	Delete(ids ...int) error
+	// Query fetches the reminders matching the filter function (all when nil)
+	// ordered by id
+	Query(filterFn func(reminder models.Reminder) bool) ([]models.Reminder, error)
+	// Scan calls fn for every stored reminder, in no particular order,
+	// without collecting them first, fn must not call the store
+	Scan(fn func(reminder models.Reminder)) error
+	// Mark retrieves the position of the last durable mutation,
+	// which a snapshot of the reminders taken right now holds
+	Mark() int64
+	// Save replaces all the stored reminders with a full snapshot, taken at the mark,
+	// and retrieves the number of bytes written
+	// the mutations after the mark are newer than the snapshot, so they are kept
+	Save(mark int64, reminders []models.Reminder) (int, error)
+	// NextID durably allocates the next AUTOINCREMENT id for a reminder
+	// an id is never handed out twice, even after a crash
+	NextID() (int, error)
+}
+
+// Options represents the options used for opening a storage driver
+type Options struct {
+	// Path is the path to the main storage file
+	Path string
+	// CfgPath is the path to the storage config file, for the drivers which use one
+	CfgPath string
+	// Integrity is the integrity policy, for the drivers which verify a checksum
+	Integrity string
+	// WaitForLock makes Start wait until the database is no longer locked
+	// by another server, instead of failing
+	WaitForLock bool
+}
+
+// Driver represents a named storage driver
+type Driver struct {
+	// DefaultPath is used when no storage path is provided
+	DefaultPath string
+	// New creates a new (not yet started) Store
+	New func(opts Options) Store
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Register makes a storage driver available by the provided name
+// it panics if the name is already taken, the same way database/sql does
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver.New == nil {
+		panic("repositories: Register driver is nil")
+	}
+	if _, ok := drivers[name]; ok {
+		panic("repositories: Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers retrieves the sorted names of the registered storage drivers
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates a Store using the storage driver registered by the provided name
+func Open(name string, opts Options) (Store, error) {
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown db driver '%s', expected one of: %s", name, strings.Join(Drivers(), ", "))
+	}
+	if opts.Path == "" {
+		opts.Path = driver.DefaultPath
+	}
+	return driver.New(opts), nil
+}
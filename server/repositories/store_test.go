@@ -0,0 +1,283 @@
+package repositories
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// storeTests are the conformance tests every registered storage driver has to pass
+// open starts a store in a directory, which the store is stopped with at the end of the test
+var storeTests = []struct {
+	name string
+	test func(t *testing.T, open func(dir string) Store, dir string)
+}{
+	{"put & get", testStorePutGet},
+	{"delete", testStoreDelete},
+	{"query", testStoreQuery},
+	{"scan", testStoreScan},
+	{"save", testStoreSave},
+	{"save after later mutations", testStoreSaveAfterLaterMutations},
+	{"next id", testStoreNextID},
+	{"restart", testStoreRestart},
+	{"crash recovery", testStoreCrashRecovery},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for _, driver := range Drivers() {
+		driver := driver
+		for _, tt := range storeTests {
+			tt := tt
+			t.Run(driver+"/"+tt.name, func(t *testing.T) {
+				open := func(dir string) Store {
+					t.Helper()
+					store, err := Open(driver, Options{
+						Path:      filepath.Join(dir, "store"),
+						Integrity: IntegrityRefuse,
+					})
+					if err != nil {
+						t.Fatalf("could not open %s store: %v", driver, err)
+					}
+					if err := store.Start(); err != nil {
+						t.Fatalf("could not start %s store: %v", driver, err)
+					}
+					t.Cleanup(func() { _ = store.Stop() })
+					return store
+				}
+				tt.test(t, open, tempDir(t))
+			})
+		}
+	}
+}
+
+// mustPut puts reminders into the store, failing the test if it could not
+func mustPut(t *testing.T, store Store, reminders ...models.Reminder) {
+	t.Helper()
+	if err := store.Put(reminders...); err != nil {
+		t.Fatalf("could not put reminders: %v", err)
+	}
+}
+
+// checkQuery checks that the store holds exactly the wanted reminders
+func checkQuery(t *testing.T, store Store, want ...models.Reminder) {
+	t.Helper()
+	got, err := store.Query(nil)
+	if err != nil {
+		t.Fatalf("could not query store: %v", err)
+	}
+	if want == nil {
+		want = []models.Reminder{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reminders %v, got %v", ids(want), ids(got))
+	}
+}
+
+func testStorePutGet(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2 := testReminder(1, "one"), testReminder(2, "two")
+	mustPut(t, store, r1, r2)
+	r1.Title = "one edited"
+	mustPut(t, store, r1)
+
+	got, err := store.Get(r1.ID)
+	if err != nil {
+		t.Fatalf("could not get reminder: %v", err)
+	}
+	if !reflect.DeepEqual(got, r1) {
+		t.Errorf("expected reminder %+v, got %+v", r1, got)
+	}
+	if _, err := store.Get(42); !isNotFound(err) {
+		t.Errorf("expected a not found error for a missing reminder, got %v", err)
+	}
+}
+
+func testStoreDelete(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	mustPut(t, store, r1, r2, r3)
+	if err := store.Delete(r2.ID, 42); err != nil {
+		t.Fatalf("could not delete reminders: %v", err)
+	}
+	if _, err := store.Get(r2.ID); !isNotFound(err) {
+		t.Errorf("expected a not found error for a deleted reminder, got %v", err)
+	}
+	checkQuery(t, store, r1, r3)
+}
+
+func testStoreQuery(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	checkQuery(t, store)
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	mustPut(t, store, r3, r1)
+	mustPut(t, store, r2)
+	checkQuery(t, store, r1, r2, r3)
+
+	got, err := store.Query(func(r models.Reminder) bool { return strings.HasPrefix(r.Title, "t") })
+	if err != nil {
+		t.Fatalf("could not query store: %v", err)
+	}
+	if want := []models.Reminder{r2, r3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reminders %v, got %v", ids(want), ids(got))
+	}
+}
+
+func testStoreScan(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	want := []models.Reminder{testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")}
+	mustPut(t, store, want...)
+	var got []models.Reminder
+	err := store.Scan(func(r models.Reminder) {
+		got = append(got, r)
+	})
+	if err != nil {
+		t.Fatalf("could not scan store: %v", err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].ID < got[j].ID })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected reminders %v, got %v", ids(want), ids(got))
+	}
+}
+
+func testStoreSave(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2, r3, r4 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three"), testReminder(4, "four")
+	mustPut(t, store, r1, r2, r3)
+	r2.Title = "two edited"
+	for i := 0; i < 2; i++ {
+		if _, err := store.Save(store.Mark(), []models.Reminder{r2, r4}); err != nil {
+			t.Fatalf("could not save store: %v", err)
+		}
+		checkQuery(t, store, r2, r4)
+	}
+	if _, err := store.Save(store.Mark(), nil); err != nil {
+		t.Fatalf("could not save store: %v", err)
+	}
+	checkQuery(t, store)
+}
+
+// testStoreSaveAfterLaterMutations saves a snapshot which misses the mutations after its mark,
+// the way the service writes its snapshot while the reminders keep changing
+func testStoreSaveAfterLaterMutations(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	mustPut(t, store, r1, r2)
+	mark := store.Mark()
+	snapshot := []models.Reminder{r1, r2}
+	mustPut(t, store, r3)
+	if err := store.Delete(r1.ID); err != nil {
+		t.Fatalf("could not delete reminder: %v", err)
+	}
+	r2.Title = "two edited"
+	mustPut(t, store, r2)
+	if _, err := store.Save(mark, snapshot); err != nil {
+		t.Fatalf("could not save store: %v", err)
+	}
+	checkQuery(t, store, r2, r3)
+	if err := store.Stop(); err != nil {
+		t.Fatalf("could not stop store: %v", err)
+	}
+	checkQuery(t, open(dir), r2, r3)
+}
+
+func testStoreNextID(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	last := 0
+	for i := 0; i < 10; i++ {
+		id, err := store.NextID()
+		if err != nil {
+			t.Fatalf("could not allocate an id: %v", err)
+		}
+		if id <= last {
+			t.Fatalf("expected an id after %d, got %d", last, id)
+		}
+		last = id
+	}
+	mustPut(t, store, testReminder(last+10, "beyond"))
+	if err := store.Stop(); err != nil {
+		t.Fatalf("could not stop store: %v", err)
+	}
+
+	store = open(dir)
+	id, err := store.NextID()
+	if err != nil {
+		t.Fatalf("could not allocate an id: %v", err)
+	}
+	if id <= last+10 {
+		t.Errorf("expected an id after the stored %d, got %d", last+10, id)
+	}
+}
+
+func testStoreRestart(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	if _, err := store.Save(store.Mark(), []models.Reminder{r1, r2}); err != nil {
+		t.Fatalf("could not save store: %v", err)
+	}
+	mustPut(t, store, r3)
+	if err := store.Delete(r1.ID); err != nil {
+		t.Fatalf("could not delete reminder: %v", err)
+	}
+	if err := store.Stop(); err != nil {
+		t.Fatalf("could not stop store: %v", err)
+	}
+	checkQuery(t, open(dir), r2, r3)
+}
+
+// testStoreCrashRecovery starts a store from the files of a store which was never stopped
+func testStoreCrashRecovery(t *testing.T, open func(dir string) Store, dir string) {
+	store := open(dir)
+	r1, r2, r3 := testReminder(1, "one"), testReminder(2, "two"), testReminder(3, "three")
+	if _, err := store.Save(store.Mark(), []models.Reminder{r1, r2}); err != nil {
+		t.Fatalf("could not save store: %v", err)
+	}
+	r2.Title = "two edited"
+	mustPut(t, store, r2, r3)
+	if err := store.Delete(r1.ID); err != nil {
+		t.Fatalf("could not delete reminder: %v", err)
+	}
+	last, err := store.NextID()
+	if err != nil {
+		t.Fatalf("could not allocate an id: %v", err)
+	}
+
+	crashed := tempDir(t)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("could not list store files: %v", err)
+	}
+	for _, f := range files {
+		// the lock of a crashed server is released by the os
+		if strings.HasSuffix(f.Name(), ".lock") {
+			continue
+		}
+		bs, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatalf("could not read %s: %v", f.Name(), err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(crashed, f.Name()), bs, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", f.Name(), err)
+		}
+	}
+
+	recovered := open(crashed)
+	checkQuery(t, recovered, r2, r3)
+	id, err := recovered.NextID()
+	if err != nil {
+		t.Fatalf("could not allocate an id: %v", err)
+	}
+	if id <= last {
+		t.Errorf("expected an id after %d, got %d", last, id)
+	}
+}
+
+// isNotFound reports whether err is a models.NotFoundError
+func isNotFound(err error) bool {
+	_, ok := err.(models.NotFoundError)
+	return ok
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/gophertuts/reminders-cli/server/models"
@@ -9,40 +11,88 @@ import (
 
 type saver interface {
 	save() error
+	changed() <-chan struct{}
+}
+
+// SavePolicy represents when the snapshot is saved after it changes:
+// once no other change happened for Debounce, but no later than Interval
+// after the first unsaved change
+type SavePolicy struct {
+	Interval time.Duration
+	Debounce time.Duration
+}
+
+// Validate checks whether the policy durations are usable
+func (p SavePolicy) Validate() error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("save interval must be positive")
+	}
+	if p.Debounce <= 0 {
+		return fmt.Errorf("save debounce must be positive")
+	}
+	return nil
 }
 
 // BackgroundSaver represents the reminder background saver
+// it saves the snapshot only after it changed
 type BackgroundSaver struct {
-	ticker  *time.Ticker
+	policy  SavePolicy
 	service saver
+	stop    chan struct{}
+	done    chan struct{}
 }
 
 // NewSaver creates a new instance of BackgroundSaver
-func NewSaver(service saver) *BackgroundSaver {
-	ticker := time.NewTicker(30 * time.Second)
+func NewSaver(service saver, policy SavePolicy) *BackgroundSaver {
 	return &BackgroundSaver{
-		ticker:  ticker,
+		policy:  policy,
 		service: service,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 }
 
 // Start starts the created Watcher
 func (s *BackgroundSaver) Start() {
 	log.Println("background saver started")
+	defer close(s.done)
+	var debounce, deadline *time.Timer
+	var debounceC, deadlineC <-chan time.Time
+	flush := func() {
+		debounce.Stop()
+		deadline.Stop()
+		debounce, deadline = nil, nil
+		debounceC, deadlineC = nil, nil
+		if err := s.service.save(); err != nil {
+			log.Printf("could not save records in background: %v", err)
+		}
+	}
 	for {
 		select {
-		case <-s.ticker.C:
-			err := s.service.save()
-			if err != nil {
-				log.Printf("could not save records in background: %v", err)
+		case <-s.service.changed():
+			if deadline == nil {
+				deadline = time.NewTimer(s.policy.Interval)
+				deadlineC = deadline.C
+			}
+			if debounce != nil {
+				debounce.Stop()
 			}
+			debounce = time.NewTimer(s.policy.Debounce)
+			debounceC = debounce.C
+		case <-debounceC:
+			flush()
+		case <-deadlineC:
+			flush()
+		case <-s.stop:
+			return
 		}
 	}
 }
 
-// Stop stops the created Watcher
+// Stop stops the created Watcher and saves any unsaved change
 func (s *BackgroundSaver) Stop() error {
-	s.ticker.Stop()
+	close(s.stop)
+	<-s.done
 	err := s.service.save()
 	if err != nil {
 		return err
@@ -57,71 +107,131 @@ type HTTPNotifierClient interface {
 }
 
 type snapshotManager interface {
-	snapshot() Snapshot
+	scheduled() *Scheduler
+	notifying(id int) (models.Reminder, bool)
+	missedDigests() <-chan []models.Reminder
 	snapshotGrooming(notifiedReminders ...models.Reminder)
 	retry(reminder models.Reminder, duration time.Duration)
 }
 
-// BackgroundNotifier represents the reminder background saver
+// BackgroundNotifier represents the reminder background notifier
+// it notifies every reminder as soon as the scheduler reports it is due
+// reminders are notified by the notifier of their owner, else by the default one
 type BackgroundNotifier struct {
-	ticker    *time.Ticker
+	stop      chan struct{}
 	service   snapshotManager
 	completed chan models.Reminder
 	Client    HTTPNotifierClient
+	Clients   map[string]HTTPNotifierClient
 }
 
 // NewNotifier creates a new instance of BackgroundNotifier
-func NewNotifier(notifierURI string, service snapshotManager) *BackgroundNotifier {
-	ticker := time.NewTicker(1 * time.Second)
-	httpClient := NewHTTPClient(notifierURI)
+// userURIs holds the notifier URIs of the users which have their own notifier
+// transport is shared by the clients of all the notifiers
+func NewNotifier(notifierURI string, userURIs map[string]string, transport http.RoundTripper, service snapshotManager) *BackgroundNotifier {
+	clients := make(map[string]HTTPNotifierClient, len(userURIs))
+	for user, uri := range userURIs {
+		clients[user] = NewHTTPClient(uri, transport)
+	}
 	return &BackgroundNotifier{
-		ticker:    ticker,
+		stop:      make(chan struct{}),
 		service:   service,
 		completed: make(chan models.Reminder),
-		Client:    httpClient,
+		Client:    NewHTTPClient(notifierURI, transport),
+		Clients:   clients,
+	}
+}
+
+// client retrieves the notifier client of a user
+func (s *BackgroundNotifier) client(owner string) HTTPNotifierClient {
+	if c, ok := s.Clients[owner]; ok {
+		return c
 	}
+	return s.Client
 }
 
 // Start starts the created Watcher
 func (s *BackgroundNotifier) Start() {
 	log.Println("background notifier started")
+	scheduler := s.service.scheduled()
+	go scheduler.Run(s.stop)
 	for {
 		select {
-		case <-s.ticker.C:
-			snapshot := s.service.snapshot()
-			for id := range snapshot.UnCompleted {
-				_, reminder := snapshot.UnCompleted.flatten(id)
-				reminderTick := reminder.ModifiedAt.Add(reminder.Duration).UnixNano()
-				nowTick := time.Now().UnixNano()
-				deltaTick := time.Now().Add(time.Second).UnixNano()
-				if reminderTick > nowTick && reminderTick < deltaTick {
-					go s.notify(reminder)
-				}
+		case id := <-scheduler.C:
+			if reminder, ok := s.service.notifying(id); ok {
+				go s.notify(reminder)
+			}
+		case reminders := <-s.service.missedDigests():
+			// every user gets a digest of their own missed reminders
+			owners := map[string][]models.Reminder{}
+			for _, r := range reminders {
+				owners[r.Owner] = append(owners[r.Owner], r)
+			}
+			for owner, missed := range owners {
+				go s.notifyDigest(owner, missed)
 			}
 		case r := <-s.completed:
 			log.Printf("reminder with with: %d was completed\n", r.ID)
+		case <-s.stop:
+			return
 		}
 	}
 }
 
 // notify notifies a reminder via the HTTP client
 func (s *BackgroundNotifier) notify(r models.Reminder) {
-	res, err := s.Client.Notify(r)
+	notificationAttempts.Inc()
+	res, err := s.client(r.Owner).Notify(r)
 	if err != nil {
+		notificationFailures.Inc()
 		log.Printf("could not notify reminder with id %d\n", r.ID)
 		log.Printf("background http client error: %v\n", err)
 
 	} else if res.completed {
+		notificationSuccesses.Inc()
 		s.service.snapshotGrooming(r)
-		s.completed <- r
+		select {
+		case s.completed <- r:
+		case <-s.stop:
+		}
 		return
 	}
+	notificationRetries.Inc()
 	s.service.retry(r, res.duration)
 }
 
+// notifyDigest notifies a single digest of the missed reminders of an owner via the HTTP client
+// until it is closed, which completes all of them
+func (s *BackgroundNotifier) notifyDigest(owner string, reminders []models.Reminder) {
+	digest := newDigest(reminders)
+	digest.Owner = owner
+	for {
+		wait := retryPeriod
+		notificationAttempts.Inc()
+		res, err := s.client(owner).Notify(digest)
+		if err != nil {
+			notificationFailures.Inc()
+			log.Printf("could not notify missed reminders digest: %v\n", err)
+		} else if res.completed {
+			notificationSuccesses.Inc()
+			s.service.snapshotGrooming(reminders...)
+			return
+		} else {
+			wait = res.duration
+		}
+		notificationRetries.Inc()
+		log.Printf("retrying missed reminders digest after %v", wait)
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
 // Stop stops the created Watcher
 func (s *BackgroundNotifier) Stop() error {
-	s.ticker.Stop()
+	close(s.stop)
 	log.Println("background notifier stopped")
 	return nil
 }
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/gophertuts/reminders-cli/server/exchange"
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// calendarOccurrences is the number of upcoming occurrences of a recurring reminder
+// which are rendered in the calendar feed, next to the one it is due at
+const calendarOccurrences = 10
+
+// Calendar represents a rendered iCalendar feed and its entity tag
+type Calendar struct {
+	Body []byte
+	ETag string
+}
+
+// calendarKey represents the reminders a feed is rendered for
+type calendarKey struct {
+	owner     string
+	recurring bool
+}
+
+// calendarCache represents the feeds rendered for the current snapshot generation
+type calendarCache struct {
+	mu         sync.Mutex
+	generation uint64
+	feeds      map[calendarKey]Calendar
+}
+
+// Calendar renders the iCalendar feed of the active reminders of the user, at their due time
+// with recurring, the upcoming occurrences of the recurring reminders are rendered too
+// the feed is only rendered again after the reminders changed
+func (s *Reminders) Calendar(user User, recurring bool) (Calendar, error) {
+	key := calendarKey{owner: user.owner(), recurring: recurring}
+	s.mu.RLock()
+	generation := s.generation
+	s.calendars.mu.Lock()
+	defer s.calendars.mu.Unlock()
+	if s.calendars.generation == generation {
+		if cal, ok := s.calendars.feeds[key]; ok {
+			s.mu.RUnlock()
+			return cal, nil
+		}
+	}
+	var active []models.Reminder
+	for _, reminder := range s.current.All.sorted() {
+		if reminder.Status.Active() && user.owns(reminder) {
+			active = append(active, reminder)
+		}
+	}
+	s.mu.RUnlock()
+
+	var buf bytes.Buffer
+	enc := exchange.NewFeedEncoder(&buf)
+	for _, reminder := range active {
+		occurrence := 0
+		if reminder.Repeat != nil {
+			occurrence = reminder.Repeat.Occurrences
+		}
+		if err := enc.Encode(reminder, reminder.Due(), occurrence); err != nil {
+			return Calendar{}, models.WrapError("could not render calendar", err)
+		}
+		if !recurring {
+			continue
+		}
+		for i, next := range upcomingOccurrences(reminder, calendarOccurrences) {
+			if err := enc.Encode(reminder, next, occurrence+i+1); err != nil {
+				return Calendar{}, models.WrapError("could not render calendar", err)
+			}
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return Calendar{}, models.WrapError("could not render calendar", err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	cal := Calendar{
+		Body: buf.Bytes(),
+		ETag: `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+	if s.calendars.generation != generation || s.calendars.feeds == nil {
+		s.calendars.generation = generation
+		s.calendars.feeds = map[calendarKey]Calendar{}
+	}
+	s.calendars.feeds[key] = cal
+	return cal, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// wall clock layouts accepted for due_at, interpreted in the reminder time zone
+var dueAtLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// dueAtClockLayout is the layout for a time of the day, meaning its next occurrence
+const dueAtClockLayout = "15:04"
+
+// loadLocation loads an IANA time zone, empty meaning the server local time zone
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, models.DataValidationError{
+			Message: fmt.Sprintf("invalid time zone '%s'", tz),
+		}
+	}
+	return loc, nil
+}
+
+// parseDueAt parses an absolute due time given as RFC 3339, a wall clock
+// date & time or a time of the day in the given IANA time zone
+func parseDueAt(value, tz string, now time.Time) (time.Time, error) {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range dueAtLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	if c, err := time.Parse(dueAtClockLayout, value); err == nil {
+		n := now.In(loc)
+		t := time.Date(n.Year(), n.Month(), n.Day(), c.Hour(), c.Minute(), 0, 0, loc)
+		if !t.After(n) {
+			t = time.Date(n.Year(), n.Month(), n.Day()+1, c.Hour(), c.Minute(), 0, 0, loc)
+		}
+		return t, nil
+	}
+	return time.Time{}, models.DataValidationError{
+		Message: fmt.Sprintf(
+			"invalid due_at '%s', expected RFC 3339, 'YYYY-MM-DD HH:MM' or 'HH:MM'",
+			value,
+		),
+	}
+}
+
+// resolveDue computes the due time from either a duration or an absolute due_at
+// neither can be in the past
+func resolveDue(d time.Duration, dueAt, tz string, now time.Time) (time.Time, error) {
+	if d < 0 {
+		return time.Time{}, models.DataValidationError{
+			Message: fmt.Sprintf("duration %v is negative, it would be due in the past", d),
+		}
+	}
+	if d != 0 && dueAt != "" {
+		return time.Time{}, models.DataValidationError{
+			Message: "only one of 'duration', 'due_at' can be provided",
+		}
+	}
+	if dueAt == "" {
+		if tz != "" {
+			return time.Time{}, models.DataValidationError{
+				Message: "'time_zone' can only be provided together with 'due_at'",
+			}
+		}
+		return now.Add(d), nil
+	}
+	due, err := parseDueAt(dueAt, tz, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !due.After(now) {
+		return time.Time{}, models.DataValidationError{
+			Message: fmt.Sprintf("due_at %s is in the past", due.Format(time.RFC3339)),
+		}
+	}
+	return due, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+func TestResolveDueRejectsThePast(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		duration time.Duration
+		dueAt    string
+		wantErr  bool
+	}{
+		{"positive duration", time.Minute, "", false},
+		{"negative duration", -time.Second, "", true},
+		{"future due_at", 0, "2024-05-01T13:00:00Z", false},
+		{"past due_at", 0, "2024-05-01T11:00:00Z", true},
+		{"both", time.Minute, "2024-05-01T13:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveDue(tt.duration, tt.dueAt, "", now)
+			if tt.wantErr {
+				if _, ok := err.(models.DataValidationError); !ok {
+					t.Errorf("expected a data validation error, got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestEditRejectsNegativeDuration(t *testing.T) {
+	s, _ := newTestService(t)
+	r, err := s.Create(testAdmin, ReminderCreateBody{Title: "t", Message: "m", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("could not create reminder: %v", err)
+	}
+	if _, err := s.Edit(testAdmin, ReminderEditBody{ID: r.ID, Duration: -time.Second}); err == nil {
+		t.Fatal("expected negative duration to be rejected")
+	}
+	if _, err := s.Create(testAdmin, ReminderCreateBody{Title: "t", Message: "m", Duration: -time.Second}); err == nil {
+		t.Fatal("expected negative duration to be rejected")
+	}
+	if s.scheduler.Len() != 1 {
+		t.Errorf("expected the reminder to stay scheduled, got %d scheduled", s.scheduler.Len())
+	}
+}
+
+// createDaily creates a reminder due every day at 09:00 in Tokyo
+func createDaily(t *testing.T, s *Reminders, count int) models.Reminder {
+	t.Helper()
+	r, err := s.Create(testAdmin, ReminderCreateBody{
+		Title:       "t",
+		Message:     "m",
+		Repeat:      "0 9 * * *",
+		RepeatCount: count,
+		TimeZone:    "Asia/Tokyo",
+	})
+	if err != nil {
+		t.Fatalf("could not create reminder: %v", err)
+	}
+	return r
+}
+
+// checkDueAtNine checks that the next occurrence of a recurring reminder is at 09:00 in tz
+func checkDueAtNine(t *testing.T, r models.Reminder, tz string) {
+	t.Helper()
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, ok := nextOccurrence(r, time.Now())
+	if !ok {
+		t.Fatal("expected the reminder to repeat")
+	}
+	if at := next.DueAt.In(loc); at.Hour() != 9 || at.Minute() != 0 {
+		t.Errorf("expected the next occurrence at 09:00 %s, got %v", tz, at)
+	}
+}
+
+func TestEditDurationKeepsTimeZone(t *testing.T) {
+	s, _ := newTestService(t)
+	r := createDaily(t, s, 0)
+	edited, err := s.Edit(testAdmin, ReminderEditBody{ID: r.ID, Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("could not edit reminder: %v", err)
+	}
+	if edited.TimeZone != "Asia/Tokyo" {
+		t.Errorf("expected the time zone to be kept, got %q", edited.TimeZone)
+	}
+	if !edited.Repeat.Start.Equal(r.Repeat.Start) {
+		t.Errorf("expected the recurrence to start at %v, got %v", r.Repeat.Start, edited.Repeat.Start)
+	}
+	checkDueAtNine(t, edited, "Asia/Tokyo")
+
+	start := r.Repeat.Start
+	edited, err = s.Edit(testAdmin, ReminderEditBody{ID: r.ID, DueAt: "2030-01-02 18:30", TimeZone: "Europe/Paris"})
+	if err != nil {
+		t.Fatalf("could not edit reminder: %v", err)
+	}
+	if edited.TimeZone != "Europe/Paris" {
+		t.Errorf("expected the time zone to move to Europe/Paris, got %q", edited.TimeZone)
+	}
+	if !edited.Repeat.Start.Equal(edited.DueAt) {
+		t.Errorf("expected the recurrence to start at %v, got %v", edited.DueAt, edited.Repeat.Start)
+	}
+	if !r.Repeat.Start.Equal(start) {
+		t.Error("expected the recurrence of the previous copy to be left unchanged")
+	}
+	checkDueAtNine(t, edited, "Europe/Paris")
+}
+
+func TestReopenDurationKeepsTimeZone(t *testing.T) {
+	s, _ := newTestService(t)
+	// the only occurrence is completed, so the reminder does not repeat
+	r := createDaily(t, s, 1)
+	if _, err := s.Complete(testAdmin, r.ID); err != nil {
+		t.Fatalf("could not complete reminder: %v", err)
+	}
+	reopened, err := s.Reopen(testAdmin, ReminderReopenBody{ID: r.ID, Duration: time.Minute})
+	if err != nil {
+		t.Fatalf("could not reopen reminder: %v", err)
+	}
+	if reopened.TimeZone != "Asia/Tokyo" {
+		t.Errorf("expected the time zone to be kept, got %q", reopened.TimeZone)
+	}
+	if !reopened.Repeat.Start.Equal(r.Repeat.Start) {
+		t.Errorf("expected the recurrence to start at %v, got %v", r.Repeat.Start, reopened.Repeat.Start)
+	}
+
+	if _, err := s.Complete(testAdmin, r.ID); err != nil {
+		t.Fatalf("could not complete reminder: %v", err)
+	}
+	reopened, err = s.Reopen(testAdmin, ReminderReopenBody{ID: r.ID, DueAt: "2030-01-02 18:30", TimeZone: "Europe/Paris"})
+	if err != nil {
+		t.Fatalf("could not reopen reminder: %v", err)
+	}
+	if reopened.TimeZone != "Europe/Paris" {
+		t.Errorf("expected the time zone to move to Europe/Paris, got %q", reopened.TimeZone)
+	}
+	if !reopened.Repeat.Start.Equal(reopened.DueAt) {
+		t.Errorf("expected the recurrence to start at %v, got %v", reopened.DueAt, reopened.Repeat.Start)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// reminder event types
+const (
+	EventCreated   = "created"
+	EventEdited    = "edited"
+	EventDeleted   = "deleted"
+	EventReopened  = "reopened"
+	EventDue       = "due"
+	EventNotified  = "notified"
+	EventSnoozed   = "snoozed"
+	EventCompleted = "completed"
+)
+
+const (
+	// eventBufferSize is the number of the latest events kept to resume subscriptions from
+	eventBufferSize = 1024
+	// subscriptionBufferSize is the number of events a subscriber can fall behind,
+	// before it is dropped and has to resume
+	subscriptionBufferSize = 64
+)
+
+// Event represents a change of a reminder
+// deleted events carry the reminder as it was before it was deleted
+type Event struct {
+	ID       uint64          `json:"id"`
+	Type     string          `json:"type"`
+	At       time.Time       `json:"at"`
+	Reminder models.Reminder `json:"reminder"`
+}
+
+// EventBus represents the in-memory bus of reminder events
+// it keeps a bounded buffer of the latest events, so subscribers can resume after a disconnect
+type EventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	buffer []Event
+	start  int
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewEventBus creates a new instance of EventBus, which buffers up to size events
+func NewEventBus(size int) *EventBus {
+	return &EventBus{
+		// event ids start at the boot time in microseconds, so the ids of a
+		// previous run are older than the ones buffered after a restart
+		nextID: uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		buffer: make([]Event, 0, size),
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription represents a subscriber of the event bus
+// C is closed when the bus is closed, or when the subscriber falls too far behind
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	owner string
+	bus   *EventBus
+}
+
+// wants checks whether the subscriber receives an event
+func (sub *Subscription) wants(e Event) bool {
+	return sub.owner == "" || e.Reminder.Owner == sub.owner
+}
+
+// Close unsubscribes from the event bus
+func (sub *Subscription) Close() {
+	sub.bus.mu.Lock()
+	defer sub.bus.mu.Unlock()
+	sub.bus.drop(sub)
+}
+
+// Publish publishes an event of a reminder to the subscribers, it never blocks
+func (b *EventBus) Publish(eventType string, reminder models.Reminder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := Event{ID: b.nextID, Type: eventType, At: time.Now(), Reminder: reminder}
+	b.nextID++
+	if len(b.buffer) < cap(b.buffer) {
+		b.buffer = append(b.buffer, e)
+	} else if cap(b.buffer) > 0 {
+		b.buffer[b.start] = e
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+	for sub := range b.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// Subscribe subscribes to the events published from now on, of the reminders of the owner
+// (of all the reminders, when owner is empty)
+// with a non zero lastID, the buffered events published after it are retrieved first
+// false is retrieved when some of them are no longer buffered, so they were lost
+func (b *EventBus) Subscribe(owner string, lastID uint64) (*Subscription, []Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := make(chan Event, subscriptionBufferSize)
+	sub := &Subscription{C: c, c: c, owner: owner, bus: b}
+	if b.closed {
+		close(c)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	var missed []Event
+	for i := range b.buffer {
+		e := b.buffer[(b.start+i)%len(b.buffer)]
+		if e.ID > lastID && sub.wants(e) {
+			missed = append(missed, e)
+		}
+	}
+	oldest := b.nextID
+	if len(b.buffer) > 0 {
+		oldest = b.buffer[b.start].ID
+	}
+	// lastID is either the event before the oldest buffered one, or a later one
+	// it cannot be ahead of the latest event, unless it comes from another run
+	complete := lastID+1 >= oldest && lastID < b.nextID
+	return sub, missed, complete
+}
+
+// Close closes all the subscriptions, no new ones are accepted afterwards
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+// drop removes a subscriber and closes its channel
+// the caller must hold the lock
+func (b *EventBus) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// publish publishes n events of reminders of the owner & retrieves them
+func publish(t *testing.T, b *EventBus, owner string, n int) []Event {
+	t.Helper()
+	sub, _, _ := b.Subscribe("", 0)
+	defer sub.Close()
+	events := make([]Event, n)
+	for i := range events {
+		b.Publish(EventCreated, models.Reminder{ID: i + 1, Owner: owner})
+		events[i] = <-sub.C
+	}
+	return events
+}
+
+func eventIDs(events []Event) []uint64 {
+	res := make([]uint64, len(events))
+	for i, e := range events {
+		res[i] = e.ID
+	}
+	return res
+}
+
+func TestEventBusResumes(t *testing.T) {
+	b := NewEventBus(4)
+	events := publish(t, b, "alice", 6)
+	for i := 1; i < len(events); i++ {
+		if events[i].ID != events[i-1].ID+1 {
+			t.Fatalf("expected consecutive event ids, got %v", eventIDs(events))
+		}
+	}
+	before := events[0].ID - 1
+	after := events[5].ID + 1
+	// the buffer wrapped, it holds the last 4 events: 3 to 6
+	tests := []struct {
+		name     string
+		lastID   uint64
+		missed   []Event
+		complete bool
+	}{
+		{"latest", events[5].ID, nil, true},
+		{"within the buffer", events[3].ID, events[4:], true},
+		{"before the oldest buffered", events[1].ID, events[2:], true},
+		{"evicted", events[0].ID, events[2:], false},
+		{"previous run", before, events[2:], false},
+		{"ahead", after, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed, complete := b.Subscribe("", tt.lastID)
+			defer sub.Close()
+			if fmt.Sprint(eventIDs(missed)) != fmt.Sprint(eventIDs(tt.missed)) {
+				t.Errorf("expected missed events %v, got %v", eventIDs(tt.missed), eventIDs(missed))
+			}
+			if complete != tt.complete {
+				t.Errorf("expected complete %v, got %v", tt.complete, complete)
+			}
+		})
+	}
+
+	// the missed events are filtered by owner as well
+	sub, missed, complete := b.Subscribe("bob", events[1].ID)
+	defer sub.Close()
+	if len(missed) != 0 || !complete {
+		t.Errorf("expected bob to miss no events, got %v (complete %v)", eventIDs(missed), complete)
+	}
+}
+
+func TestEventBusSubscriptions(t *testing.T) {
+	b := NewEventBus(4)
+	alice, _, _ := b.Subscribe("alice", 0)
+	all, _, _ := b.Subscribe("", 0)
+	b.Publish(EventCreated, models.Reminder{ID: 1, Owner: "bob"})
+	b.Publish(EventCreated, models.Reminder{ID: 2, Owner: "alice"})
+	if e := <-alice.C; e.Reminder.ID != 2 {
+		t.Errorf("expected alice to only receive her events, got %+v", e)
+	}
+	if e := <-all.C; e.Reminder.ID != 1 {
+		t.Errorf("expected an admin to receive every event, got %+v", e)
+	}
+	<-all.C
+
+	// closing unsubscribes, so its channel is closed & no longer published to
+	alice.Close()
+	alice.Close()
+	b.Publish(EventCreated, models.Reminder{ID: 3, Owner: "alice"})
+	if e, ok := <-alice.C; ok {
+		t.Errorf("expected a closed subscription to receive nothing, got %+v", e)
+	}
+	if len(b.subs) != 1 {
+		t.Errorf("expected a single subscriber, got %d", len(b.subs))
+	}
+	<-all.C
+
+	// a subscriber falling too far behind is dropped, so it resumes instead of blocking the bus
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		b.Publish(EventEdited, models.Reminder{ID: 1})
+	}
+	received := 0
+	for range all.C {
+		received++
+	}
+	if received != subscriptionBufferSize {
+		t.Errorf("expected %d buffered events before the drop, got %d", subscriptionBufferSize, received)
+	}
+
+	// closing the bus closes every subscription & the later ones
+	sub, _, _ := b.Subscribe("", 0)
+	b.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("expected the subscription to be closed with the bus")
+	}
+	late, _, _ := b.Subscribe("", 0)
+	if _, ok := <-late.C; ok {
+		t.Error("expected a subscription to a closed bus to be closed")
+	}
+}
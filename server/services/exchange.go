@@ -0,0 +1,236 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/exchange"
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/recurrence"
+)
+
+// import conflict policies, applied to the imported reminders which already exist
+// an imported reminder conflicts with the reminder with the same uid or,
+// when it has no uid, with the reminder with the same id
+const (
+	// ConflictSkip keeps the existing reminder and drops the imported one
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces the existing reminder with the imported one, keeping its id
+	ConflictOverwrite = "overwrite"
+	// ConflictRenumber imports the reminder as a new one, with a new id (and uid)
+	ConflictRenumber = "renumber"
+)
+
+// ImportReport represents the outcome of an import
+type ImportReport struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Renumbered  int `json:"renumbered"`
+	Skipped     int `json:"skipped"`
+	// IDs holds the ids of the imported reminders, in import order
+	IDs []int `json:"ids"`
+}
+
+// ValidateConflict checks whether the import conflict policy is a known one
+func ValidateConflict(conflict string) error {
+	switch conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRenumber:
+		return nil
+	default:
+		return models.DataValidationError{
+			Message: fmt.Sprintf("invalid conflict policy '%s', expected one of: skip, overwrite, renumber", conflict),
+		}
+	}
+}
+
+// Export writes all the reminders of the user in the given format, ordered by id
+func (s *Reminders) Export(user User, w io.Writer, format string) error {
+	enc, err := exchange.NewEncoder(w, format)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	reminders := s.current.All.sorted()
+	s.mu.RUnlock()
+	for _, reminder := range reminders {
+		if !user.owns(reminder) {
+			continue
+		}
+		if err := enc.Encode(reminder); err != nil {
+			return models.WrapError("could not export reminder", err)
+		}
+	}
+	return enc.Close()
+}
+
+// Import reads reminders in the given format and stores them, applying
+// the conflict policy to the ones which already exist
+// every record is validated before any of them is stored
+// the reminders which are not imported over an existing one get new ids
+// users import the reminders as their own, and only conflict with their own reminders
+// the reminders imported by admins keep their owner
+func (s *Reminders) Import(user User, r io.Reader, format, conflict string) (ImportReport, error) {
+	if err := ValidateConflict(conflict); err != nil {
+		return ImportReport{}, err
+	}
+	reminders, err := exchange.Decode(r, format)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	now := time.Now()
+	for i := range reminders {
+		if !user.Admin {
+			reminders[i].Owner = user.Name
+		}
+		if err := prepareImport(&reminders[i], now); err != nil {
+			return ImportReport{}, models.DataValidationError{
+				Message: fmt.Sprintf("record %d is invalid: %v", i+1, err),
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := ImportReport{IDs: []int{}}
+	uids := map[string]int{}
+	for id, reminder := range s.current.All {
+		if reminder.UID != "" {
+			uids[reminder.UID] = id
+		}
+	}
+	var imported []models.Reminder
+	var events []string
+	for _, reminder := range reminders {
+		existing, ok := uids[reminder.UID]
+		if reminder.UID == "" {
+			_, ok = s.current.All[reminder.ID]
+			existing = reminder.ID
+		}
+		// the reminders of other users are neither skipped nor replaced, the imported one is renumbered
+		foreign := ok && !user.owns(s.current.All[existing])
+		switch {
+		case ok && !foreign && conflict == ConflictSkip:
+			report.Skipped++
+			continue
+		case ok && !foreign && conflict == ConflictOverwrite:
+			reminder.ID = existing
+			reminder.UID = s.current.All[existing].UID
+			if reminder.Owner == "" {
+				reminder.Owner = s.current.All[existing].Owner
+			}
+			report.Overwritten++
+			events = append(events, EventEdited)
+		default:
+			if ok {
+				reminder.UID = ""
+				report.Renumbered++
+			} else {
+				report.Created++
+			}
+			if err := s.renumber(&reminder, now); err != nil {
+				return ImportReport{}, err
+			}
+			events = append(events, EventCreated)
+		}
+		if reminder.Owner == "" {
+			reminder.Owner = user.Name
+		}
+		if reminder.UID != "" {
+			uids[reminder.UID] = reminder.ID
+		}
+		imported = append(imported, reminder)
+		report.IDs = append(report.IDs, reminder.ID)
+	}
+	if len(imported) == 0 {
+		return report, nil
+	}
+	if err := s.repo.Put(imported...); err != nil {
+		return ImportReport{}, models.WrapError("could not journal imported reminders", err)
+	}
+	for i, reminder := range imported {
+		s.current.All[reminder.ID] = reminder
+		if reminder.Status.Active() {
+			s.setPending(reminder)
+		} else {
+			s.unsetPending(reminder.ID)
+		}
+		s.events.Publish(events[i], reminder)
+	}
+	s.touch()
+	return report, nil
+}
+
+// renumber gives an imported reminder a new id, and a new uid when it has none in uuidv7 mode
+// the caller must hold the write lock
+func (s *Reminders) renumber(reminder *models.Reminder, now time.Time) error {
+	var err error
+	if reminder.UID == "" && s.idMode == IDModeUUIDv7 {
+		if reminder.UID, err = newUUIDv7(now); err != nil {
+			return err
+		}
+	}
+	// the id is durably allocated before it is handed out, so it is never reused
+	if reminder.ID, err = s.repo.NextID(); err != nil {
+		return models.WrapError("could not allocate reminder id", err)
+	}
+	return nil
+}
+
+// prepareImport validates an imported reminder and fills in what it is missing
+func prepareImport(reminder *models.Reminder, now time.Time) error {
+	if reminder.Title == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+	if reminder.Message == "" {
+		return fmt.Errorf("message cannot be empty")
+	}
+	if reminder.Due().IsZero() {
+		return fmt.Errorf("due time cannot be empty")
+	}
+	reminder.DueAt = reminder.Due()
+	switch {
+	case reminder.Status == "":
+		reminder.Status = models.StatusPending
+	case reminder.Status == models.StatusNotifying:
+		// the notification was in flight on the exporting server
+		reminder.Status = models.StatusPending
+	case !reminder.Status.Valid():
+		return fmt.Errorf("unknown status '%s'", reminder.Status)
+	}
+	if reminder.UID != "" {
+		uid, err := normalizeUID(reminder.UID)
+		if err != nil {
+			return err
+		}
+		reminder.UID = uid
+	}
+	loc, err := loadLocation(reminder.TimeZone)
+	if err != nil {
+		return err
+	}
+	if reminder.Repeat != nil {
+		rule, err := recurrence.Parse(reminder.Repeat.Rule)
+		if err != nil {
+			return fmt.Errorf("invalid repeat rule: %v", err)
+		}
+		// the end conditions of an RRULE are used unless they are explicitly provided
+		if reminder.Repeat.Count == 0 {
+			reminder.Repeat.Count = rule.Count
+		}
+		if reminder.Repeat.Until == nil && !rule.Until.IsZero() {
+			until := rule.UntilIn(loc)
+			reminder.Repeat.Until = &until
+		}
+		if reminder.Repeat.Start.IsZero() {
+			reminder.Repeat.Start = reminder.DueAt
+		}
+	}
+	if reminder.CreatedAt.IsZero() {
+		reminder.CreatedAt = now
+	}
+	if reminder.ModifiedAt.IsZero() {
+		reminder.ModifiedAt = now
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/exchange"
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// importJSON imports a json array of reminders
+func importJSON(t *testing.T, s *Reminders, user User, body, conflict string) ImportReport {
+	t.Helper()
+	report, err := s.Import(user, strings.NewReader(body), exchange.FormatJSON, conflict)
+	if err != nil {
+		t.Fatalf("could not import reminders: %v", err)
+	}
+	return report
+}
+
+func TestUserImportsAsOwner(t *testing.T) {
+	s, _ := newTestService(t)
+	alice := User{Name: "alice"}
+	bob := User{Name: "bob"}
+	r, err := s.Create(alice, ReminderCreateBody{Title: "alice", Message: "m", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("could not create reminder: %v", err)
+	}
+	due := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// the id of the reminder of alice, which bob can neither skip nor overwrite
+	body := `[{"id": 1, "owner": "alice", "title": "bob", "message": "m", "due_at": "` + due + `"}]`
+	for _, conflict := range []string{ConflictSkip, ConflictOverwrite} {
+		report := importJSON(t, s, bob, body, conflict)
+		if report.Renumbered != 1 || len(report.IDs) != 1 || report.IDs[0] == r.ID {
+			t.Fatalf("%s: expected the reminder to be renumbered, got %+v", conflict, report)
+		}
+		if got := s.current.All[report.IDs[0]].Owner; got != bob.Name {
+			t.Errorf("%s: expected the imported reminder to belong to bob, got '%s'", conflict, got)
+		}
+	}
+	if got := s.current.All[r.ID]; got.Title != "alice" || got.Owner != alice.Name {
+		t.Errorf("expected the reminder of alice to be kept, got %+v", got)
+	}
+
+	// while the reminders of bob conflict with his own
+	own := `[{"id": 2, "title": "bob again", "message": "m", "due_at": "` + due + `"}]`
+	if report := importJSON(t, s, bob, own, ConflictSkip); report.Skipped != 1 {
+		t.Errorf("expected the reminder of bob to be skipped, got %+v", report)
+	}
+	if report := importJSON(t, s, bob, own, ConflictOverwrite); report.Overwritten != 1 || s.current.All[2].Title != "bob again" {
+		t.Errorf("expected the reminder of bob to be overwritten, got %+v", report)
+	}
+}
+
+func TestAdminImportKeepsOwner(t *testing.T) {
+	s, _ := newTestService(t)
+	due := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `[
+		{"id": 7, "owner": "alice", "title": "t", "message": "m", "due_at": "` + due + `"},
+		{"id": 8, "title": "t", "message": "m", "due_at": "` + due + `"}
+	]`
+	report := importJSON(t, s, testAdmin, body, ConflictSkip)
+	if report.Created != 2 {
+		t.Fatalf("expected 2 created reminders, got %+v", report)
+	}
+	if got := s.current.All[report.IDs[0]].Owner; got != "alice" {
+		t.Errorf("expected the owner to be kept, got '%s'", got)
+	}
+	if got := s.current.All[report.IDs[1]].Owner; got != testAdmin.Name {
+		t.Errorf("expected a reminder without owner to belong to the admin, got '%s'", got)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	s, _ := newTestService(t)
+	due := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	uid := "0190a0b0-0000-7000-8000-000000000001"
+	// conflicting by uid, by id & not conflicting
+	body := `[
+		{"id": 1, "uid": "` + uid + `", "title": "by uid", "message": "m", "due_at": "` + due + `"},
+		{"id": 2, "title": "by id", "message": "m", "due_at": "` + due + `"},
+		{"id": 50, "title": "new", "message": "m", "due_at": "` + due + `"}
+	]`
+	first := importJSON(t, s, testAdmin, body, ConflictSkip)
+	if first.Created != 3 || len(s.current.All) != 3 {
+		t.Fatalf("expected 3 created reminders, got %+v", first)
+	}
+
+	// the reminders get new ids, 1 to 3, so reminder 50 never conflicts
+	tests := []struct {
+		conflict string
+		want     ImportReport
+		stored   int
+	}{
+		{ConflictSkip, ImportReport{Created: 1, Skipped: 2}, 4},
+		{ConflictOverwrite, ImportReport{Created: 1, Overwritten: 2}, 5},
+		{ConflictRenumber, ImportReport{Created: 1, Renumbered: 2}, 8},
+	}
+	for _, tt := range tests {
+		report := importJSON(t, s, testAdmin, body, tt.conflict)
+		if report.Created != tt.want.Created || report.Skipped != tt.want.Skipped ||
+			report.Overwritten != tt.want.Overwritten || report.Renumbered != tt.want.Renumbered {
+			t.Errorf("%s: expected %+v, got %+v", tt.conflict, tt.want, report)
+		}
+		if len(s.current.All) != tt.stored {
+			t.Errorf("%s: expected %d stored reminders, got %d", tt.conflict, tt.stored, len(s.current.All))
+		}
+	}
+
+	// overwriting keeps the id & the uid of the existing reminder
+	if got := s.current.All[first.IDs[0]]; got.UID != uid {
+		t.Errorf("expected the uid to be kept, got %+v", got)
+	}
+	// while renumbering drops the uid, which identifies the existing reminder
+	for _, id := range []int{6, 7, 8} {
+		if got := s.current.All[id]; got.UID == uid {
+			t.Errorf("expected the renumbered reminder %d to have another uid, got %+v", id, got)
+		}
+	}
+}
+
+func TestImportValidatesEveryRecord(t *testing.T) {
+	s, repo := newTestService(t)
+	due := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		record string
+	}{
+		{"no title", `{"message": "m", "due_at": "` + due + `"}`},
+		{"no due time", `{"title": "t", "message": "m"}`},
+		{"unknown status", `{"title": "t", "message": "m", "status": "sleeping", "due_at": "` + due + `"}`},
+		{"invalid uid", `{"uid": "x", "title": "t", "message": "m", "due_at": "` + due + `"}`},
+		{"invalid time zone", `{"title": "t", "message": "m", "time_zone": "Mars/Olympus", "due_at": "` + due + `"}`},
+		{"invalid rule", `{"title": "t", "message": "m", "repeat": {"rule": "often"}, "due_at": "` + due + `"}`},
+	}
+	valid := `{"title": "t", "message": "m", "due_at": "` + due + `"}`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := "[" + valid + "," + tt.record + "]"
+			_, err := s.Import(testAdmin, strings.NewReader(body), exchange.FormatJSON, ConflictSkip)
+			verr, ok := err.(models.DataValidationError)
+			if !ok || !strings.HasPrefix(verr.Message, "record 2 is invalid") {
+				t.Errorf("expected record 2 to be rejected, got: %v", err)
+			}
+			if len(repo.ids()) != 0 {
+				t.Errorf("expected nothing to be imported, got %v", repo.ids())
+			}
+		})
+	}
+}
@@ -18,11 +18,13 @@ type HTTPClient struct {
 }
 
 // NewHTTPClient creates a new HTTP client instance
-func NewHTTPClient(uri string) HTTPClient {
+// transport sends the requests, e.g. over TLS with a client certificate (the default transport when nil)
+func NewHTTPClient(uri string, transport http.RoundTripper) HTTPClient {
 	return HTTPClient{
 		notifierURI: uri,
 		client: &http.Client{
-			Timeout: 20 * time.Second,
+			Transport: transport,
+			Timeout:   20 * time.Second,
 		},
 	}
 }
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// id modes
+const (
+	// IDModeInt identifies reminders only by their AUTOINCREMENT id
+	IDModeInt = "int"
+	// IDModeUUIDv7 additionally gives every reminder a time ordered UUIDv7 uid
+	// which clients can also generate on their own, without coordinating with the server
+	IDModeUUIDv7 = "uuidv7"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ValidateIDMode checks whether the id mode is a known one
+func ValidateIDMode(mode string) error {
+	switch mode {
+	case IDModeInt, IDModeUUIDv7:
+		return nil
+	default:
+		return fmt.Errorf("invalid id mode '%s', expected one of: int, uuidv7", mode)
+	}
+}
+
+// newUUIDv7 generates a RFC 9562 version 7 UUID:
+// 48 bits of unix milliseconds followed by 74 random bits
+func newUUIDv7(now time.Time) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", models.WrapError("could not generate uuid", err)
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// normalizeUID validates a client provided uid and retrieves its canonical (lowercase) form
+func normalizeUID(uid string) (string, error) {
+	uid = strings.ToLower(uid)
+	if !uuidPattern.MatchString(uid) {
+		return "", models.DataValidationError{
+			Message: fmt.Sprintf("invalid uid '%s', expected a UUID", uid),
+		}
+	}
+	return uid, nil
+}
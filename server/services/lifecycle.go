@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// ReminderSnoozeBody represents the model for snoozing a reminder
+// either for a Duration or Until an absolute time in the IANA TimeZone
+type ReminderSnoozeBody struct {
+	ID       int
+	Duration time.Duration
+	Until    string
+	TimeZone string
+}
+
+// Snooze postpones a pending reminder, the same way as snoozing it from the notification
+func (s *Reminders) Snooze(user User, body ReminderSnoozeBody) (models.Reminder, error) {
+	if body.Duration == 0 && body.Until == "" {
+		return models.Reminder{}, models.FormatValidationError{
+			Message: "body must contain 1 of: 'duration', 'until'",
+		}
+	}
+	if body.Duration != 0 && body.Until != "" {
+		return models.Reminder{}, models.DataValidationError{
+			Message: "only one of 'duration', 'until' can be provided",
+		}
+	}
+	now := time.Now()
+	due, err := resolveDue(body.Duration, body.Until, body.TimeZone, now)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.find(user, body.ID); err != nil {
+		return models.Reminder{}, err
+	}
+	reminder, err := s.reschedule(body.ID, due.Sub(now), models.StatusSnoozed, now)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	s.events.Publish(EventSnoozed, reminder)
+	return reminder, nil
+}
+
+// Complete completes a pending reminder, the same way as closing its notification
+// recurring reminders are scheduled for their next occurrence instead
+func (s *Reminders) Complete(user User, id int) (models.Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminder, err := s.find(user, id)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	if !reminder.Status.Active() {
+		return models.Reminder{}, models.ConflictError{
+			Message: fmt.Sprintf("reminder with id: %d is already %s", id, reminder.Status),
+		}
+	}
+	reminder, err = s.complete(id, time.Now())
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	s.events.Publish(EventCompleted, reminder)
+	return reminder, nil
+}
+
+// ReminderReopenBody represents the model for reopening a reminder
+// a new due time is only required when the previous one has already passed
+type ReminderReopenBody struct {
+	ID       int
+	Duration time.Duration
+	DueAt    string
+	TimeZone string
+}
+
+// Reopen moves a completed or cancelled reminder back to pending
+func (s *Reminders) Reopen(user User, body ReminderReopenBody) (models.Reminder, error) {
+	now := time.Now()
+	var due time.Time
+	if body.Duration != 0 || body.DueAt != "" || body.TimeZone != "" {
+		d, err := resolveDue(body.Duration, body.DueAt, body.TimeZone, now)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		due = d
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminder, err := s.find(user, body.ID)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	if reminder.Status.Active() {
+		return models.Reminder{}, models.ConflictError{
+			Message: fmt.Sprintf("reminder with id: %d is still %s", body.ID, reminder.Status),
+		}
+	}
+	if due.IsZero() {
+		if !reminder.Due().After(now) {
+			return models.Reminder{}, models.DataValidationError{
+				Message: "reminder due time has passed, body must contain 1 of: 'duration', 'due_at'",
+			}
+		}
+		due = reminder.Due()
+	} else if body.DueAt != "" {
+		// a duration alone keeps the time zone & the recurrence of the reminder
+		reanchor(&reminder, due, body.TimeZone)
+	}
+	if err := transition(&reminder, models.StatusPending, now); err != nil {
+		return models.Reminder{}, err
+	}
+	reminder.Duration = due.Sub(now)
+	reminder.DueAt = due
+	reminder.ModifiedAt = now
+	if err := s.put(reminder); err != nil {
+		return models.Reminder{}, err
+	}
+	s.setPending(reminder)
+	s.events.Publish(EventReopened, reminder)
+	return reminder, nil
+}
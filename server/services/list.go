@@ -0,0 +1,259 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// reminders list sorting fields
+const (
+	ListSortID        = "id"
+	ListSortCreatedAt = "created_at"
+	ListSortDue       = "due"
+)
+
+// reminders list sorting orders
+const (
+	ListOrderAsc  = "asc"
+	ListOrderDesc = "desc"
+)
+
+// reminders list pagination limits
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ReminderListQuery represents the model for listing reminders
+// Owner filters the reminders of admins by their owner
+type ReminderListQuery struct {
+	Owner     string
+	Status    string
+	DueBefore time.Time
+	DueAfter  time.Time
+	Title     string
+	SortBy    string
+	Order     string
+	Cursor    string
+	Limit     int
+}
+
+// ReminderList represents a single page of listed reminders
+type ReminderList struct {
+	Reminders  []models.Reminder `json:"reminders"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// listCursor represents the position after which the next page starts
+// it records the order & the filters of its query, which the next pages must keep
+type listCursor struct {
+	sortBy  string
+	order   string
+	filters uint32
+	key     int64
+	id      int
+}
+
+// encode encodes the cursor into an opaque url safe string
+func (c listCursor) encode() string {
+	raw := fmt.Sprintf("%s:%s:%x:%d:%d", c.sortBy, c.order, c.filters, c.key, c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeListCursor decodes an opaque cursor produced by listCursor.encode
+func decodeListCursor(s string) (listCursor, error) {
+	invalid := models.DataValidationError{Message: "invalid cursor provided"}
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return listCursor{}, invalid
+	}
+	parts := strings.Split(string(bs), ":")
+	if len(parts) != 5 {
+		return listCursor{}, invalid
+	}
+	filters, err := strconv.ParseUint(parts[2], 16, 32)
+	if err != nil {
+		return listCursor{}, invalid
+	}
+	key, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return listCursor{}, invalid
+	}
+	id, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return listCursor{}, invalid
+	}
+	return listCursor{sortBy: parts[0], order: parts[1], filters: uint32(filters), key: key, id: id}, nil
+}
+
+// filtersHash hashes the filters of the query, the cursors of other filters are rejected
+// as the position they record may not be in the listed reminders
+func (q ReminderListQuery) filtersHash() uint32 {
+	h := fnv.New32a()
+	for _, f := range []string{
+		q.Owner,
+		q.Status,
+		strconv.FormatInt(q.DueBefore.UnixNano(), 10),
+		strconv.FormatInt(q.DueAfter.UnixNano(), 10),
+		strings.ToLower(q.Title),
+	} {
+		// the separator keeps the filters apart, e.g. owner 'a' & status 'b' from owner 'ab'
+		_, _ = h.Write([]byte(f + "\x00"))
+	}
+	return h.Sum32()
+}
+
+// validate checks the list query and fills in the defaults
+func (q *ReminderListQuery) validate() error {
+	if q.Status != "" && !models.Status(q.Status).Valid() {
+		return models.DataValidationError{
+			Message: fmt.Sprintf(
+				"invalid status '%s', expected one of: pending, notifying, snoozed, completed, cancelled",
+				q.Status,
+			),
+		}
+	}
+	if q.SortBy == "" {
+		q.SortBy = ListSortID
+	}
+	switch q.SortBy {
+	case ListSortID, ListSortCreatedAt, ListSortDue:
+	default:
+		return models.DataValidationError{
+			Message: fmt.Sprintf("invalid sort '%s', expected one of: id, created_at, due", q.SortBy),
+		}
+	}
+	if q.Order == "" {
+		q.Order = ListOrderAsc
+	}
+	if q.Order != ListOrderAsc && q.Order != ListOrderDesc {
+		return models.DataValidationError{
+			Message: fmt.Sprintf("invalid order '%s', expected one of: asc, desc", q.Order),
+		}
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxListLimit {
+		return models.DataValidationError{
+			Message: fmt.Sprintf("limit must be between 1 and %d", MaxListLimit),
+		}
+	}
+	return nil
+}
+
+// sortKey retrieves the value a reminder is sorted by
+func (q ReminderListQuery) sortKey(r models.Reminder) int64 {
+	switch q.SortBy {
+	case ListSortCreatedAt:
+		return r.CreatedAt.UnixNano()
+	case ListSortDue:
+		return r.Due().UnixNano()
+	default:
+		return int64(r.ID)
+	}
+}
+
+// less reports whether position a comes before position b in the query order
+func (q ReminderListQuery) less(a, b listCursor) bool {
+	if a.key == b.key {
+		if q.Order == ListOrderDesc {
+			return a.id > b.id
+		}
+		return a.id < b.id
+	}
+	if q.Order == ListOrderDesc {
+		return a.key > b.key
+	}
+	return a.key < b.key
+}
+
+// List lists reminders matching the given filters, one page at a time
+// users only list the reminders they own
+func (s *Reminders) List(user User, q ReminderListQuery) (ReminderList, error) {
+	if err := q.validate(); err != nil {
+		return ReminderList{}, err
+	}
+	if !user.Admin {
+		if q.Owner != "" && q.Owner != user.Name {
+			return ReminderList{}, models.ForbiddenError{
+				Message: "only admins can list the reminders of other users",
+			}
+		}
+		q.Owner = user.Name
+	}
+	var after *listCursor
+	if q.Cursor != "" {
+		c, err := decodeListCursor(q.Cursor)
+		if err != nil {
+			return ReminderList{}, err
+		}
+		if c.sortBy != q.SortBy || c.order != q.Order {
+			return ReminderList{}, models.DataValidationError{
+				Message: "cursor does not match the sort field & order",
+			}
+		}
+		if c.filters != q.filtersHash() {
+			return ReminderList{}, models.DataValidationError{
+				Message: "cursor does not match the filters",
+			}
+		}
+		after = &c
+	}
+
+	title := strings.ToLower(q.Title)
+	var matched []models.Reminder
+	s.mu.RLock()
+	for id, reminder := range s.current.All {
+		if q.Owner != "" && reminder.Owner != q.Owner {
+			continue
+		}
+		if q.Status != "" && reminder.Status != models.Status(q.Status) {
+			continue
+		}
+		due := reminder.Due()
+		if !q.DueBefore.IsZero() && !due.Before(q.DueBefore) {
+			continue
+		}
+		if !q.DueAfter.IsZero() && !due.After(q.DueAfter) {
+			continue
+		}
+		if title != "" && !strings.Contains(strings.ToLower(reminder.Title), title) {
+			continue
+		}
+		if after != nil && !q.less(*after, listCursor{key: q.sortKey(reminder), id: id}) {
+			continue
+		}
+		matched = append(matched, reminder)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		a := listCursor{key: q.sortKey(matched[i]), id: matched[i].ID}
+		b := listCursor{key: q.sortKey(matched[j]), id: matched[j].ID}
+		return q.less(a, b)
+	})
+
+	res := ReminderList{Reminders: make([]models.Reminder, 0, q.Limit)}
+	if len(matched) > q.Limit {
+		last := matched[q.Limit-1]
+		c := listCursor{
+			sortBy:  q.SortBy,
+			order:   q.Order,
+			filters: q.filtersHash(),
+			key:     q.sortKey(last),
+			id:      last.ID,
+		}
+		res.NextCursor = c.encode()
+		matched = matched[:q.Limit]
+	}
+	res.Reminders = append(res.Reminders, matched...)
+	return res, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// seedList stores n reminders of the owner, created 3 by 3 at the same time
+// so that sorting by created_at has ties
+func seedList(s *Reminders, owner string, n int) {
+	base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := len(s.current.All) + 1
+	for id := first; id < first+n; id++ {
+		s.current.All[id] = models.Reminder{
+			ID:        id,
+			Owner:     owner,
+			Title:     fmt.Sprintf("%s %d", owner, id),
+			Message:   "m",
+			Status:    models.StatusPending,
+			DueAt:     base.Add(time.Duration(id) * time.Hour),
+			CreatedAt: base.Add(time.Duration((id-1)/3) * time.Minute),
+		}
+	}
+}
+
+// listAll lists every page of the query and retrieves the listed ids & the size of every page
+func listAll(t *testing.T, s *Reminders, user User, q ReminderListQuery) ([]int, []int) {
+	t.Helper()
+	var ids, pages []int
+	for {
+		res, err := s.List(user, q)
+		if err != nil {
+			t.Fatalf("could not list reminders: %v", err)
+		}
+		for _, r := range res.Reminders {
+			ids = append(ids, r.ID)
+		}
+		pages = append(pages, len(res.Reminders))
+		if res.NextCursor == "" {
+			return ids, pages
+		}
+		if len(pages) > 100 {
+			t.Fatal("expected the pagination to end")
+		}
+		q.Cursor = res.NextCursor
+	}
+}
+
+func TestListPages(t *testing.T) {
+	s, _ := newTestService(t)
+	seedList(s, models.DefaultOwner, 10)
+	tests := []struct {
+		name  string
+		q     ReminderListQuery
+		ids   []int
+		pages []int
+	}{
+		{
+			"partial last page",
+			ReminderListQuery{Limit: 4},
+			[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			[]int{4, 4, 2},
+		},
+		{
+			"full last page",
+			ReminderListQuery{Limit: 5},
+			[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			[]int{5, 5},
+		},
+		{
+			"single page",
+			ReminderListQuery{Limit: 10},
+			[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			[]int{10},
+		},
+		{
+			"ties ascending",
+			ReminderListQuery{SortBy: ListSortCreatedAt, Limit: 2},
+			[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			[]int{2, 2, 2, 2, 2},
+		},
+		{
+			// the ties are ordered by id too
+			"ties descending",
+			ReminderListQuery{SortBy: ListSortCreatedAt, Order: ListOrderDesc, Limit: 4},
+			[]int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+			[]int{4, 4, 2},
+		},
+		{
+			"filtered",
+			ReminderListQuery{SortBy: ListSortDue, Order: ListOrderDesc, DueBefore: time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC), Limit: 3},
+			[]int{7, 6, 5, 4, 3, 2, 1},
+			[]int{3, 3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, pages := listAll(t, s, testAdmin, tt.q)
+			if fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+				t.Errorf("expected ids %v, got %v", tt.ids, ids)
+			}
+			if fmt.Sprint(pages) != fmt.Sprint(tt.pages) {
+				t.Errorf("expected pages of %v reminders, got %v", tt.pages, pages)
+			}
+		})
+	}
+}
+
+func TestListRejectsInvalidCursors(t *testing.T) {
+	s, _ := newTestService(t)
+	seedList(s, models.DefaultOwner, 4)
+	q := ReminderListQuery{SortBy: ListSortDue, Title: "default", Limit: 2}
+	res, err := s.List(testAdmin, q)
+	if err != nil {
+		t.Fatalf("could not list reminders: %v", err)
+	}
+	cursor := res.NextCursor
+	tests := []struct {
+		name string
+		q    ReminderListQuery
+	}{
+		{"not base64", ReminderListQuery{Cursor: "!!"}},
+		{"garbage", ReminderListQuery{Cursor: base64.RawURLEncoding.EncodeToString([]byte("id:1"))}},
+		{"invalid key", ReminderListQuery{Cursor: base64.RawURLEncoding.EncodeToString([]byte("id:asc:0:x:1"))}},
+		{"other sort field", ReminderListQuery{SortBy: ListSortID, Title: "default", Cursor: cursor}},
+		{"other order", ReminderListQuery{SortBy: ListSortDue, Order: ListOrderDesc, Title: "default", Cursor: cursor}},
+		{"other filters", ReminderListQuery{SortBy: ListSortDue, Title: "other", Cursor: cursor}},
+		{"no filters", ReminderListQuery{SortBy: ListSortDue, Cursor: cursor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.List(testAdmin, tt.q); err == nil {
+				t.Error("expected the cursor to be rejected")
+			} else if _, ok := err.(models.DataValidationError); !ok {
+				t.Errorf("expected a data validation error, got: %v", err)
+			}
+		})
+	}
+
+	// the title filter is case insensitive, so is its cursor
+	q.Title = "DEFAULT"
+	q.Cursor = cursor
+	if _, err := s.List(testAdmin, q); err != nil {
+		t.Errorf("expected the cursor to match the same filter, got: %v", err)
+	}
+}
+
+func TestListOwnerScoping(t *testing.T) {
+	s, _ := newTestService(t)
+	seedList(s, "alice", 3)
+	seedList(s, "bob", 3)
+	alice := User{Name: "alice"}
+
+	ids, _ := listAll(t, s, alice, ReminderListQuery{Limit: 2})
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("expected alice to only list her reminders, got %v", ids)
+	}
+	ids, _ = listAll(t, s, testAdmin, ReminderListQuery{Owner: "bob", Limit: 2})
+	if fmt.Sprint(ids) != "[4 5 6]" {
+		t.Errorf("expected an admin to list the reminders of bob, got %v", ids)
+	}
+	if _, err := s.List(alice, ReminderListQuery{Owner: "bob"}); err == nil {
+		t.Error("expected alice to be forbidden from listing the reminders of bob")
+	}
+
+	// the cursor of an admin listing every reminder does not page through the ones of alice
+	res, err := s.List(testAdmin, ReminderListQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("could not list reminders: %v", err)
+	}
+	if _, err := s.List(alice, ReminderListQuery{Limit: 2, Cursor: res.NextCursor}); err == nil {
+		t.Error("expected the cursor of another owner filter to be rejected")
+	}
+}
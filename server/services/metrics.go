@@ -0,0 +1,43 @@
+package services
+
+import (
+	"github.com/gophertuts/reminders-cli/server/metrics"
+)
+
+// metrics of the reminders, the notifications & the snapshot saves
+var (
+	remindersStored  = metrics.NewGauge("reminders_stored", "Number of stored reminders")
+	remindersPending = metrics.NewGauge(
+		"reminders_pending",
+		"Number of reminders which are neither completed nor cancelled (pending, notifying or snoozed)",
+	)
+	notificationAttempts = metrics.NewCounter(
+		"reminders_notification_attempts_total",
+		"Number of notifications sent to the notifier, missed reminder digests included",
+	)
+	notificationSuccesses = metrics.NewCounter(
+		"reminders_notification_successes_total",
+		"Number of notifications closed by the user, which completes their reminders",
+	)
+	notificationRetries = metrics.NewCounter(
+		"reminders_notification_retries_total",
+		"Number of notifications which are sent again later, after a snooze or a failure",
+	)
+	notificationFailures = metrics.NewCounter(
+		"reminders_notification_failures_total",
+		"Number of notifications which could not be delivered to the notifier",
+	)
+	saveDuration = metrics.NewHistogram(
+		"reminders_save_duration_seconds",
+		"Time taken to save the snapshot of the reminders",
+		metrics.DefaultBuckets,
+	)
+	saveBytes = metrics.NewCounter(
+		"reminders_save_written_bytes_total",
+		"Number of bytes written by the snapshot saves",
+	)
+	saveFailures = metrics.NewCounter(
+		"reminders_save_failures_total",
+		"Number of snapshot saves which failed",
+	)
+)
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// missed reminders handling actions
+const (
+	MissedDeliver = "deliver"
+	MissedDigest  = "digest"
+	MissedDrop    = "drop"
+)
+
+// MissedPolicy represents how the reminders which came due while the server
+// was down are handled on startup: delivered one by one, delivered as a single
+// digest notification or dropped. Reminders missed by more than MaxAge (if set)
+// are always dropped.
+type MissedPolicy struct {
+	Action string
+	MaxAge time.Duration
+}
+
+// Validate checks whether the policy is a known one
+func (p MissedPolicy) Validate() error {
+	switch p.Action {
+	case MissedDeliver, MissedDigest, MissedDrop:
+	default:
+		return fmt.Errorf(
+			"invalid missed reminders policy '%s', expected one of: deliver, digest, drop",
+			p.Action,
+		)
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("missed reminders max age cannot be negative")
+	}
+	return nil
+}
+
+// handleMissed applies the missed policy to a reminder which came due before startup
+// it retrieves true when the reminder must be included in the digest
+// the caller must hold the write lock
+func (s *Reminders) handleMissed(reminder models.Reminder, now time.Time) bool {
+	late := now.Sub(reminder.Due()).Round(time.Second)
+	missed := &models.Missed{Action: s.missed.Action, HandledAt: now}
+	status := models.StatusPending
+	switch {
+	case s.missed.MaxAge > 0 && late > s.missed.MaxAge:
+		missed.Action = MissedDrop
+		missed.Reason = fmt.Sprintf(
+			"dropped: came due %v before startup, more than the max age of %v",
+			late, s.missed.MaxAge,
+		)
+		status = models.StatusCancelled
+	case s.missed.Action == MissedDrop:
+		missed.Reason = fmt.Sprintf("dropped: came due %v before startup", late)
+		status = models.StatusCancelled
+	case s.missed.Action == MissedDigest:
+		missed.Reason = fmt.Sprintf("delivered in the startup digest: came due %v before startup", late)
+		status = models.StatusNotifying
+	default:
+		missed.Reason = fmt.Sprintf("delivered late: came due %v before startup", late)
+	}
+	if err := transition(&reminder, status, now); err != nil {
+		log.Printf("could not handle missed reminder: %v", err)
+		return false
+	}
+	reminder.Missed = missed
+	if err := s.put(reminder); err != nil {
+		log.Printf("could not handle missed reminder: %v", err)
+		return false
+	}
+	if status == models.StatusPending {
+		s.setPending(reminder)
+	}
+	return status == models.StatusNotifying
+}
+
+// missedDigests retrieves the digests of missed reminders to be notified
+func (s *Reminders) missedDigests() <-chan []models.Reminder {
+	return s.digests
+}
+
+// newDigest builds the single notification of the missed reminders
+func newDigest(reminders []models.Reminder) models.Reminder {
+	var message string
+	for _, r := range reminders {
+		message += fmt.Sprintf("• %s (%s)\n", r.Title, r.Due().Format("Jan 2 15:04"))
+	}
+	return models.Reminder{
+		Title:   fmt.Sprintf("%d missed reminder(s)", len(reminders)),
+		Message: message,
+	}
+}
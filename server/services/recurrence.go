@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+	"github.com/gophertuts/reminders-cli/server/recurrence"
+)
+
+// parseRecurrence validates a recurrence rule with its optional end date & occurrences count
+// the end conditions of an RRULE are used unless they are explicitly provided
+func parseRecurrence(rule, until string, count int, tz string, now time.Time) (*models.Recurrence, recurrence.Rule, error) {
+	r, err := recurrence.Parse(rule)
+	if err != nil {
+		return nil, recurrence.Rule{}, models.DataValidationError{
+			Message: fmt.Sprintf("invalid repeat rule: %v", err),
+		}
+	}
+	if count < 0 {
+		return nil, recurrence.Rule{}, models.DataValidationError{
+			Message: "repeat_count cannot be negative",
+		}
+	}
+	repeat := &models.Recurrence{Rule: rule, Count: r.Count}
+	if count > 0 {
+		repeat.Count = count
+	}
+	if !r.Until.IsZero() {
+		loc, err := loadLocation(tz)
+		if err != nil {
+			return nil, recurrence.Rule{}, err
+		}
+		u := r.UntilIn(loc)
+		repeat.Until = &u
+	}
+	if until != "" {
+		u, err := parseDueAt(until, tz, now)
+		if err != nil {
+			return nil, recurrence.Rule{}, err
+		}
+		repeat.Until = &u
+	}
+	return repeat, r, nil
+}
+
+// nextOccurrence computes when a recurring reminder is due after its latest occurrence
+// the returned reminder is a copy, false is returned when the recurrence has ended
+func nextOccurrence(reminder models.Reminder, now time.Time) (models.Reminder, bool) {
+	if reminder.Repeat == nil {
+		return reminder, false
+	}
+	// never mutate the shared recurrence, snapshot copies point to it
+	repeat := *reminder.Repeat
+	repeat.Occurrences++
+	reminder.Repeat = &repeat
+	if repeat.Count > 0 && repeat.Occurrences >= repeat.Count {
+		return reminder, false
+	}
+	r, err := recurrence.Parse(repeat.Rule)
+	if err != nil {
+		return reminder, false
+	}
+	loc, err := loadLocation(reminder.TimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	after := reminder.Due()
+	if now.After(after) {
+		after = now
+	}
+	next := r.Next(repeat.Start.In(loc), after)
+	if next.IsZero() || (repeat.Until != nil && next.After(*repeat.Until)) {
+		return reminder, false
+	}
+	reminder.DueAt = next
+	reminder.Duration = next.Sub(now)
+	reminder.ModifiedAt = now
+	return reminder, true
+}
+
+// reanchor moves a reminder to an explicitly given due_at & time zone,
+// a recurring reminder then repeats from the new due time, in the new time zone
+func reanchor(reminder *models.Reminder, due time.Time, tz string) {
+	reminder.TimeZone = tz
+	if reminder.Repeat == nil {
+		return
+	}
+	// never mutate the shared recurrence, snapshot copies point to it
+	repeat := *reminder.Repeat
+	repeat.Start = due
+	reminder.Repeat = &repeat
+}
+
+// upcomingOccurrences computes up to n occurrences of a recurring reminder after the one it is due at
+// the end conditions of the recurrence are applied
+func upcomingOccurrences(reminder models.Reminder, n int) []time.Time {
+	repeat := reminder.Repeat
+	if repeat == nil {
+		return nil
+	}
+	r, err := recurrence.Parse(repeat.Rule)
+	if err != nil {
+		return nil
+	}
+	loc, err := loadLocation(reminder.TimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	var occurrences []time.Time
+	after := reminder.Due()
+	for k := 1; k <= n; k++ {
+		if repeat.Count > 0 && repeat.Occurrences+k >= repeat.Count {
+			break
+		}
+		next := r.Next(repeat.Start.In(loc), after)
+		if next.IsZero() || (repeat.Until != nil && next.After(*repeat.Until)) {
+			break
+		}
+		occurrences = append(occurrences, next)
+		after = next
+	}
+	return occurrences
+}
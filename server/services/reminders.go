@@ -3,7 +3,10 @@ package services
 import (
 	"fmt"
 	"log"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gophertuts/reminders-cli/server/models"
@@ -14,24 +17,36 @@ const (
 )
 
 // RemindersMap represents the data structure for in-memory reminders collection
-type RemindersMap map[int]map[int]models.Reminder
+// reminders are keyed by their (stable) id
+type RemindersMap map[int]models.Reminder
 
-// flatten assumes the map has only one value and reads it and retrieves the key and value
-func (rMap RemindersMap) flatten(id int) (int, models.Reminder) {
-	var index int
-	var reminder models.Reminder
-	for i, r := range rMap[id] {
-		index = i
-		reminder = r
+// ids retrieves the ids of the reminders in ascending order
+func (rMap RemindersMap) ids() []int {
+	ids := make([]int, 0, len(rMap))
+	for id := range rMap {
+		ids = append(ids, id)
 	}
-	return index, reminder
+	sort.Ints(ids)
+	return ids
+}
+
+// sorted retrieves the reminders ordered by id
+func (rMap RemindersMap) sorted() []models.Reminder {
+	reminders := make([]models.Reminder, 0, len(rMap))
+	for _, id := range rMap.ids() {
+		reminders = append(reminders, rMap[id])
+	}
+	return reminders
 }
 
 // ReminderRepository represents the Reminder repository
 type ReminderRepository interface {
-	Save([]models.Reminder) (int, error)
-	Filter(filterFn func(reminder models.Reminder) bool) (RemindersMap, error)
-	NextID() int
+	Mark() int64
+	Save(mark int64, reminders []models.Reminder) (int, error)
+	Scan(fn func(reminder models.Reminder)) error
+	NextID() (int, error)
+	Put(reminders ...models.Reminder) error
+	Remove(ids ...int) error
 }
 
 // Snapshot represents current service in memory state
@@ -41,49 +56,153 @@ type Snapshot struct {
 }
 
 // Reminders represents the Reminders service
+// all the operations on the in-memory snapshot are guarded by a RWMutex
+// which makes the service safe for concurrent use
+// every mutation bumps the snapshot generation, so unchanged snapshots are not saved
 type Reminders struct {
-	repo     ReminderRepository
-	Snapshot Snapshot
+	mu         sync.RWMutex
+	repo       ReminderRepository
+	current    Snapshot
+	generation uint64
+	changes    chan struct{}
+	saveMu     sync.Mutex // guards saved
+	saved      uint64
+	scheduler  *Scheduler
+	missed     MissedPolicy
+	loadStats  LoadStats
+	calendars  calendarCache
+	events     *EventBus
+	idMode     string
+	digests    chan []models.Reminder
 }
 
 // NewReminders creates a new instance of Reminders service
-func NewReminders(repo ReminderRepository) *Reminders {
+func NewReminders(repo ReminderRepository, missed MissedPolicy, idMode string) *Reminders {
 	return &Reminders{
 		repo: repo,
-		Snapshot: Snapshot{
+		current: Snapshot{
 			All:         RemindersMap{},
 			UnCompleted: RemindersMap{},
 		},
+		changes:   make(chan struct{}, 1),
+		scheduler: NewScheduler(),
+		missed:    missed,
+		idMode:    idMode,
+		digests:   make(chan []models.Reminder, 1),
+		events:    NewEventBus(eventBufferSize),
 	}
 }
 
+// LoadStats represents the metrics of loading the reminders on startup
+type LoadStats struct {
+	Reminders int
+	Pending   int
+	Missed    int
+	Duration  time.Duration
+	// HeapAlloc is the size of the allocated heap once the reminders are loaded
+	HeapAlloc uint64
+}
+
 // Populate populates the reminders service internal state with data from db file
+// in a single pass over the stored reminders, which are not collected first
+// reminders which came due while the server was down are handled by the missed policy
 func (s *Reminders) Populate() error {
-	all, err := s.repo.Filter(nil)
+	begin := time.Now()
+	all := RemindersMap{}
+	pending := RemindersMap{}
+	var missed []models.Reminder
+	err := s.repo.Scan(func(reminder models.Reminder) {
+		if reminder.Owner == "" {
+			// journaled (or kv stored) before reminders had owners
+			reminder.Owner = models.DefaultOwner
+		}
+		all[reminder.ID] = reminder
+		switch {
+		case !reminder.Status.Active():
+		case reminder.Due().After(begin):
+			pending[reminder.ID] = reminder
+		default:
+			missed = append(missed, reminder)
+		}
+	})
 	if err != nil {
 		return models.WrapError("could not get all reminders", err)
 	}
-	unCompleted, err := s.repo.Filter(func(r models.Reminder) bool {
-		return r.ModifiedAt.Add(r.Duration).UnixNano() > time.Now().UnixNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current.All = all
+	s.current.UnCompleted = pending
+	scheduled := len(pending)
+	for _, reminder := range pending {
+		s.scheduler.Schedule(reminder.ID, reminder.Due())
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].ID < missed[j].ID
 	})
-	if err != nil {
-		return models.WrapError("could not get uncompleted reminders", err)
+	var digest []models.Reminder
+	handled := map[string]int{}
+	for _, reminder := range missed {
+		if s.handleMissed(reminder, begin) {
+			// the stored copy is the notified one, which the digest result is matched against
+			digest = append(digest, s.current.All[reminder.ID])
+		}
+		if m := all[reminder.ID].Missed; m != nil {
+			handled[m.Action]++
+		}
+	}
+	for action, n := range handled {
+		log.Printf("missed reminders policy '%s': %d record(s)", action, n)
+	}
+	remindersStored.Set(float64(len(s.current.All)))
+	remindersPending.Set(float64(len(s.current.UnCompleted)))
+	if len(digest) > 0 {
+		s.digests <- digest
 	}
-	s.Snapshot.All = all
-	s.Snapshot.UnCompleted = unCompleted
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.loadStats = LoadStats{
+		Reminders: len(all),
+		Pending:   scheduled,
+		Missed:    len(missed),
+		Duration:  time.Since(begin),
+		HeapAlloc: mem.HeapAlloc,
+	}
+	log.Printf(
+		"populated %d reminders (%d pending, %d missed) in %v, heap: %d MiB",
+		s.loadStats.Reminders, s.loadStats.Pending, s.loadStats.Missed,
+		s.loadStats.Duration.Round(time.Millisecond), s.loadStats.HeapAlloc>>20,
+	)
 	return nil
 }
 
+// LoadStats retrieves the metrics of the last Populate
+func (s *Reminders) LoadStats() LoadStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loadStats
+}
+
 // ReminderCreateBody represents the model for creating a reminder
+// the due time is either a Duration from now or an absolute DueAt
+// which is interpreted in the IANA TimeZone (server local time by default)
+// reminders with a Repeat rule are due again after each notification,
+// either until RepeatUntil or for RepeatCount occurrences
+// UID is an optional client generated UUID, which must be unique
 type ReminderCreateBody struct {
-	Title    string
-	Message  string
-	Duration time.Duration
+	UID         string
+	Title       string
+	Message     string
+	Duration    time.Duration
+	DueAt       string
+	TimeZone    string
+	Repeat      string
+	RepeatUntil string
+	RepeatCount int
 }
 
-// Create creates a new Reminder
-func (s Reminders) Create(body ReminderCreateBody) (models.Reminder, error) {
-	nextID := s.repo.NextID()
+// Create creates a new Reminder, owned by the user
+func (s *Reminders) Create(user User, body ReminderCreateBody) (models.Reminder, error) {
 	if body.Title == "" {
 		err := models.DataValidationError{
 			Message: "title cannot be empty",
@@ -96,45 +215,126 @@ func (s Reminders) Create(body ReminderCreateBody) (models.Reminder, error) {
 		}
 		return models.Reminder{}, err
 	}
-	if body.Duration == 0 {
+	if body.Duration == 0 && body.DueAt == "" && body.Repeat == "" {
 		err := models.DataValidationError{
 			Message: "duration cannot be 0",
 		}
 		return models.Reminder{}, err
 	}
+	now := time.Now()
+	var repeat *models.Recurrence
+	var due time.Time
+	if body.Repeat != "" {
+		rep, rule, err := parseRecurrence(body.Repeat, body.RepeatUntil, body.RepeatCount, body.TimeZone, now)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		if body.Duration == 0 && body.DueAt == "" {
+			// without an explicit first occurrence the rule decides it
+			loc, err := loadLocation(body.TimeZone)
+			if err != nil {
+				return models.Reminder{}, err
+			}
+			if due = rule.Next(now.In(loc), now); due.IsZero() {
+				return models.Reminder{}, models.DataValidationError{
+					Message: "repeat rule has no upcoming occurrences",
+				}
+			}
+		}
+		repeat = rep
+	} else if body.RepeatUntil != "" || body.RepeatCount != 0 {
+		return models.Reminder{}, models.DataValidationError{
+			Message: "'repeat_until' & 'repeat_count' can only be provided together with 'repeat'",
+		}
+	}
+	if due.IsZero() {
+		tz := body.TimeZone
+		if repeat != nil && body.DueAt == "" {
+			// the time zone only applies to the repeat rule
+			tz = ""
+		}
+		d, err := resolveDue(body.Duration, body.DueAt, tz, now)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		due = d
+	}
+	if repeat != nil {
+		repeat.Start = due
+	}
+	uid := body.UID
+	if uid != "" {
+		u, err := normalizeUID(uid)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		uid = u
+	} else if s.idMode == IDModeUUIDv7 {
+		u, err := newUUIDv7(now)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		uid = u
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if uid != "" {
+		for _, r := range s.current.All {
+			if r.UID == uid {
+				return models.Reminder{}, models.ConflictError{
+					Message: fmt.Sprintf("reminder with uid: %s already exists with id: %d", uid, r.ID),
+				}
+			}
+		}
+	}
+	// the id is durably allocated before it is handed out, so it is never reused
+	id, err := s.repo.NextID()
+	if err != nil {
+		return models.Reminder{}, models.WrapError("could not allocate reminder id", err)
+	}
 	reminder := models.Reminder{
-		ID:         nextID,
+		ID:         id,
+		UID:        uid,
+		Owner:      user.Name,
 		Title:      body.Title,
 		Message:    body.Message,
-		Duration:   body.Duration,
-		CreatedAt:  time.Now(),
-		ModifiedAt: time.Now(),
+		Duration:   due.Sub(now),
+		DueAt:      due,
+		TimeZone:   body.TimeZone,
+		Repeat:     repeat,
+		Status:     models.StatusPending,
+		CreatedAt:  now,
+		ModifiedAt: now,
 	}
-	index := len(s.Snapshot.All)
-	s.Snapshot.All[reminder.ID] = map[int]models.Reminder{index: reminder}
-	s.Snapshot.UnCompleted[reminder.ID] = map[int]models.Reminder{index: reminder}
+	if err := s.put(reminder); err != nil {
+		return models.Reminder{}, err
+	}
+	s.setPending(reminder)
+	s.events.Publish(EventCreated, reminder)
 	return reminder, nil
 }
 
 // ReminderEditBody represents the model for editing a reminder
+// the due time is only moved when either Duration or DueAt is provided
 type ReminderEditBody struct {
 	ID       int
 	Title    string
 	Message  string
 	Duration time.Duration
+	DueAt    string
+	TimeZone string
 }
 
 // Edit edits a given Reminder
-func (s Reminders) Edit(reminderBody ReminderEditBody) (models.Reminder, error) {
-	_, ok := s.Snapshot.All[reminderBody.ID]
-	if !ok {
-		err := models.NotFoundError{
-			Message: fmt.Sprintf("could not find reminder with id: %d", reminderBody.ID),
-		}
+func (s *Reminders) Edit(user User, reminderBody ReminderEditBody) (models.Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminder, err := s.find(user, reminderBody.ID)
+	if err != nil {
 		return models.Reminder{}, err
 	}
 	changed := false
-	index, reminder := s.Snapshot.All.flatten(reminderBody.ID)
 	if strings.TrimSpace(reminderBody.Title) != "" {
 		reminder.Title = reminderBody.Title
 		changed = true
@@ -143,37 +343,58 @@ func (s Reminders) Edit(reminderBody ReminderEditBody) (models.Reminder, error)
 		reminder.Message = reminderBody.Message
 		changed = true
 	}
-	if reminderBody.Duration != 0 {
-		reminder.Duration = reminderBody.Duration
+	now := time.Now()
+	if reminderBody.Duration != 0 || reminderBody.DueAt != "" || reminderBody.TimeZone != "" {
+		due, err := resolveDue(reminderBody.Duration, reminderBody.DueAt, reminderBody.TimeZone, now)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		if err := transition(&reminder, models.StatusPending, now); err != nil {
+			return models.Reminder{}, err
+		}
+		reminder.Duration = due.Sub(now)
+		reminder.DueAt = due
+		// a duration alone keeps the time zone & the recurrence of the reminder
+		if reminderBody.DueAt != "" {
+			reanchor(&reminder, due, reminderBody.TimeZone)
+		}
 		changed = true
 	}
 	if !changed {
 		err := models.FormatValidationError{
-			Message: "body must contain at least 1 of: 'title', 'message', 'duration'",
+			Message: "body must contain at least 1 of: 'title', 'message', 'duration', 'due_at'",
 		}
 		return models.Reminder{}, err
 	}
-	reminder.ModifiedAt = time.Now()
-	s.Snapshot.All[reminder.ID] = map[int]models.Reminder{index: reminder}
-	if reminder.ModifiedAt.UnixNano() < time.Now().Add(reminderBody.Duration).UnixNano() {
-		s.Snapshot.UnCompleted[reminder.ID] = map[int]models.Reminder{index: reminder}
+	if reminder.DueAt.IsZero() {
+		// pin the due time of a legacy duration-only record, so it does not move
+		reminder.DueAt = reminder.Due()
+	}
+	reminder.ModifiedAt = now
+	if err := s.put(reminder); err != nil {
+		return models.Reminder{}, err
+	}
+	if reminder.Status.Active() && reminder.Due().After(now) {
+		s.setPending(reminder)
 	} else {
-		delete(s.Snapshot.UnCompleted, reminder.ID)
+		s.unsetPending(reminder.ID)
 	}
+	s.events.Publish(EventEdited, reminder)
 	return reminder, nil
 }
 
 // Fetch fetches a list of reminders
-func (s Reminders) Fetch(ids []int) ([]models.Reminder, error) {
+func (s *Reminders) Fetch(user User, ids []int) ([]models.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	reminders := make([]models.Reminder, 0)
 	var notFound []int
 	for _, id := range ids {
-		_, ok := s.Snapshot.All[id]
-		if !ok {
+		reminder, ok := s.current.All[id]
+		if !ok || !user.owns(reminder) {
 			notFound = append(notFound, id)
 			continue
 		}
-		_, reminder := s.Snapshot.All.flatten(id)
 		reminders = append(reminders, reminder)
 	}
 	if len(notFound) > 0 {
@@ -186,11 +407,13 @@ func (s Reminders) Fetch(ids []int) ([]models.Reminder, error) {
 }
 
 // Delete deletes a list of reminders and persists the changes
-func (s Reminders) Delete(ids []int) error {
+func (s *Reminders) Delete(user User, ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	var notFound []int
 	for _, id := range ids {
-		_, ok := s.Snapshot.All[id]
-		if !ok {
+		reminder, ok := s.current.All[id]
+		if !ok || !user.owns(reminder) {
 			notFound = append(notFound, id)
 		}
 	}
@@ -200,64 +423,250 @@ func (s Reminders) Delete(ids []int) error {
 		}
 	}
 
+	if err := s.repo.Remove(ids...); err != nil {
+		return models.WrapError("could not journal deleted reminders", err)
+	}
 	for _, id := range ids {
-		delete(s.Snapshot.All, id)
-		delete(s.Snapshot.UnCompleted, id)
+		reminder, ok := s.current.All[id]
+		if !ok {
+			// the id was listed more than once
+			continue
+		}
+		delete(s.current.All, id)
+		s.unsetPending(id)
+		s.events.Publish(EventDeleted, reminder)
 	}
+	s.touch()
 	return nil
 }
 
-// save saves the current reminders snapshot
-func (s Reminders) save() error {
-	reminders := make([]models.Reminder, len(s.Snapshot.All))
-	for _, reminderMap := range s.Snapshot.All {
-		for i, reminder := range reminderMap {
-			reminders[i] = reminder
-		}
+// Subscribe subscribes to the events of the reminders of the user, see EventBus.Subscribe
+func (s *Reminders) Subscribe(user User, lastEventID uint64) (*Subscription, []Event, bool) {
+	return s.events.Subscribe(user.owner(), lastEventID)
+}
+
+// StopEvents closes all the subscriptions to the reminder events
+func (s *Reminders) StopEvents() {
+	s.events.Close()
+}
+
+// save saves the current reminders snapshot, unless it is unchanged since the last save
+// the snapshot, its generation & the repository mark are copied under the read lock
+// and written without it, the repository keeps the mutations after the mark on top of it
+func (s *Reminders) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.RLock()
+	if s.generation == s.saved {
+		s.mu.RUnlock()
+		return nil
 	}
+	generation := s.generation
+	reminders := s.current.All.sorted()
+	// every mutation is stored under the write lock, so the mark matches the copy
+	mark := s.repo.Mark()
+	s.mu.RUnlock()
 
-	n, err := s.repo.Save(reminders)
+	begin := time.Now()
+	n, err := s.repo.Save(mark, reminders)
 	if err != nil {
+		saveFailures.Inc()
 		return models.WrapError("could not save snapshot", err)
 	}
+	saveDuration.Observe(time.Since(begin).Seconds())
+	saveBytes.Add(float64(n))
+	s.saved = generation
 	if n > 0 && len(reminders) != 0 {
 		log.Printf("successfully saved snapshot: %d reminders", len(reminders))
 	}
 	return nil
 }
 
-// GetSnapshot fetches the current service snapshot
-func (s Reminders) snapshot() Snapshot {
-	return s.Snapshot
+// changed retrieves the channel which signals the snapshot changed
+// a signal may stand for several changes
+func (s *Reminders) changed() <-chan struct{} {
+	return s.changes
+}
+
+// touch bumps the snapshot generation and signals the change
+// the caller must hold the write lock
+func (s *Reminders) touch() {
+	s.generation++
+	remindersStored.Set(float64(len(s.current.All)))
+	select {
+	case s.changes <- struct{}{}:
+	default:
+	}
+}
+
+// scheduled retrieves the scheduler of the pending reminders
+func (s *Reminders) scheduled() *Scheduler {
+	return s.scheduler
 }
 
-// snapshotGrooming clears the current snapshot from notified reminders
-func (s Reminders) snapshotGrooming(notifiedReminders ...models.Reminder) {
+// notifying marks a due reminder as being notified and retrieves it
+// false is retrieved when the reminder can no longer be notified
+// (e.g. it was deleted or moved to a later due time in the meantime)
+func (s *Reminders) notifying(id int) (models.Reminder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.current.UnCompleted[id]; !ok {
+		return models.Reminder{}, false
+	}
+	now := time.Now()
+	reminder := s.current.All[id]
+	if reminder.Due().After(now) {
+		return models.Reminder{}, false
+	}
+	if err := transition(&reminder, models.StatusNotifying, now); err != nil {
+		log.Printf("could not notify reminder: %v", err)
+		return models.Reminder{}, false
+	}
+	if err := s.put(reminder); err != nil {
+		log.Printf("could not notify reminder: %v", err)
+		return models.Reminder{}, false
+	}
+	s.current.UnCompleted[reminder.ID] = reminder
+	s.events.Publish(EventDue, reminder)
+	return reminder, true
+}
+
+// snapshotGrooming completes notified reminders, or schedules their next occurrence
+func (s *Reminders) snapshotGrooming(notifiedReminders ...models.Reminder) {
 	if len(notifiedReminders) > 0 {
 		log.Printf("snapshot grooming: %d record(s)", len(notifiedReminders))
 	}
-	for _, reminder := range notifiedReminders {
-		delete(s.Snapshot.UnCompleted, reminder.ID)
-		reminder.Duration = -time.Hour
-		index, _ := s.Snapshot.All.flatten(reminder.ID)
-		s.Snapshot.All[reminder.ID] = map[int]models.Reminder{index: reminder}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, notified := range notifiedReminders {
+		if !s.stillNotifying(notified) {
+			log.Printf("dropping the notification result of reminder with id: %d, it changed in the meantime", notified.ID)
+			continue
+		}
+		s.events.Publish(EventNotified, s.current.All[notified.ID])
+		reminder, err := s.complete(notified.ID, time.Now())
+		if err != nil {
+			log.Printf("could not complete reminder: %v", err)
+			continue
+		}
+		s.events.Publish(EventCompleted, reminder)
 	}
 }
 
 // retry retries a reminder by resetting its duration
-func (s Reminders) retry(reminder models.Reminder, d time.Duration) {
-	reminder.ModifiedAt = time.Now()
+// a positive duration means the reminder was snoozed from the notification
+func (s *Reminders) retry(notified models.Reminder, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stillNotifying(notified) {
+		log.Printf("dropping the notification result of reminder with id: %d, it changed in the meantime", notified.ID)
+		return
+	}
+	status := models.StatusSnoozed
 	if d <= 0 {
-		reminder.Duration = retryPeriod
+		d = retryPeriod
+		status = models.StatusPending
 	} else {
-		reminder.Duration = d
+		// the notification was delivered, and snoozed from it
+		s.events.Publish(EventNotified, s.current.All[notified.ID])
+	}
+	reminder, err := s.reschedule(notified.ID, d, status, time.Now())
+	if err != nil {
+		log.Printf("could not retry reminder: %v", err)
+		return
+	}
+	if status == models.StatusSnoozed {
+		s.events.Publish(EventSnoozed, reminder)
+	}
+}
+
+// stillNotifying checks whether the result of a notification still applies to a reminder:
+// it must still be in the notification it was sent with, rather than deleted, edited,
+// snoozed or completed (or notified again) in the meantime, otherwise the result is dropped
+// the caller must hold the lock
+func (s *Reminders) stillNotifying(notified models.Reminder) bool {
+	stored, ok := s.current.All[notified.ID]
+	if !ok || stored.Status != models.StatusNotifying {
+		return false
+	}
+	if stored.NotifiedAt == nil || notified.NotifiedAt == nil {
+		return false
+	}
+	return stored.NotifiedAt.Equal(*notified.NotifiedAt)
+}
+
+// complete completes an existing reminder, or schedules the next occurrence of a recurring one
+// the caller must hold the write lock
+func (s *Reminders) complete(id int, now time.Time) (models.Reminder, error) {
+	reminder := s.current.All[id]
+	if next, ok := nextOccurrence(reminder, now); ok {
+		if err := transition(&next, models.StatusPending, now); err != nil {
+			return models.Reminder{}, err
+		}
+		log.Printf("reminder with id: %d is due again at %v", next.ID, next.DueAt)
+		if err := s.put(next); err != nil {
+			return models.Reminder{}, err
+		}
+		s.setPending(next)
+		return next, nil
+	} else if next.Repeat != nil {
+		reminder.Repeat = next.Repeat
 	}
+	if err := transition(&reminder, models.StatusCompleted, now); err != nil {
+		return models.Reminder{}, err
+	}
+	if err := s.put(reminder); err != nil {
+		return models.Reminder{}, err
+	}
+	s.unsetPending(reminder.ID)
+	return reminder, nil
+}
+
+// reschedule moves an existing reminder to the given state, due after the given duration
+// the caller must hold the write lock
+func (s *Reminders) reschedule(id int, d time.Duration, status models.Status, now time.Time) (models.Reminder, error) {
+	reminder := s.current.All[id]
+	if err := transition(&reminder, status, now); err != nil {
+		return models.Reminder{}, err
+	}
+	reminder.ModifiedAt = now
+	reminder.Duration = d
+	reminder.DueAt = now.Add(d)
 	log.Printf(
 		"retrying record with id: %d after %v",
 		reminder.ID,
 		reminder.Duration.String(),
 	)
-	index, _ := s.Snapshot.All.flatten(reminder.ID)
-	s.Snapshot.All[reminder.ID] = map[int]models.Reminder{index: reminder}
-	s.Snapshot.UnCompleted[reminder.ID] = map[int]models.Reminder{index: reminder}
+	if err := s.put(reminder); err != nil {
+		return models.Reminder{}, err
+	}
+	s.setPending(reminder)
+	return reminder, nil
+}
+
+// put journals a created or updated reminder and stores it in memory
+// the caller must hold the write lock
+func (s *Reminders) put(reminder models.Reminder) error {
+	if err := s.repo.Put(reminder); err != nil {
+		return models.WrapError("could not journal reminder", err)
+	}
+	s.current.All[reminder.ID] = reminder
+	s.touch()
+	return nil
+}
+
+// setPending stores a pending reminder and schedules it at its due time
+// the caller must hold the write lock
+func (s *Reminders) setPending(reminder models.Reminder) {
+	s.current.UnCompleted[reminder.ID] = reminder
+	s.scheduler.Schedule(reminder.ID, reminder.Due())
+	remindersPending.Set(float64(len(s.current.UnCompleted)))
+}
+
+// unsetPending removes a reminder from the pending ones and from the schedule
+// the caller must hold the write lock
+func (s *Reminders) unsetPending(id int) {
+	delete(s.current.UnCompleted, id)
+	s.scheduler.Unschedule(id)
+	remindersPending.Set(float64(len(s.current.UnCompleted)))
 }
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+func TestMain(m *testing.M) {
+	// the service logs every mutation, which drowns the test output
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// memRepo represents an in-memory ReminderRepository
+// onSave, when set, is called by Save before the snapshot is written
+type memRepo struct {
+	mu        sync.Mutex
+	reminders map[int]models.Reminder
+	lastID    int
+	mutations int64
+	mutated   map[int]int64
+	onSave    func()
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{reminders: map[int]models.Reminder{}, mutated: map[int]int64{}}
+}
+
+func (r *memRepo) Mark() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mutations
+}
+
+func (r *memRepo) Save(mark int64, reminders []models.Reminder) (int, error) {
+	if r.onSave != nil {
+		r.onSave()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := make(map[int]models.Reminder, len(reminders))
+	for _, reminder := range reminders {
+		saved[reminder.ID] = reminder
+	}
+	// the mutations after the mark are newer than the snapshot
+	for id, count := range r.mutated {
+		if count <= mark {
+			continue
+		}
+		if reminder, ok := r.reminders[id]; ok {
+			saved[id] = reminder
+		} else {
+			delete(saved, id)
+		}
+	}
+	r.reminders = saved
+	return len(reminders), nil
+}
+
+func (r *memRepo) Scan(fn func(reminder models.Reminder)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reminder := range r.reminders {
+		fn(reminder)
+	}
+	return nil
+}
+
+func (r *memRepo) NextID() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID++
+	return r.lastID, nil
+}
+
+func (r *memRepo) Put(reminders ...models.Reminder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mutations++
+	for _, reminder := range reminders {
+		r.reminders[reminder.ID] = reminder
+		r.mutated[reminder.ID] = r.mutations
+	}
+	return nil
+}
+
+func (r *memRepo) Remove(ids ...int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mutations++
+	for _, id := range ids {
+		delete(r.reminders, id)
+		r.mutated[id] = r.mutations
+	}
+	return nil
+}
+
+// ids retrieves the stored ids in ascending order
+func (r *memRepo) ids() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]int, 0, len(r.reminders))
+	for id := range r.reminders {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// newTestService creates a service over an in-memory repository
+func newTestService(t *testing.T) (*Reminders, *memRepo) {
+	t.Helper()
+	repo := newMemRepo()
+	s := NewReminders(repo, MissedPolicy{Action: MissedDeliver}, IDModeInt)
+	if err := s.Populate(); err != nil {
+		t.Fatalf("could not populate service: %v", err)
+	}
+	return s, repo
+}
+
+var testAdmin = User{Name: models.DefaultOwner, Admin: true}
+
+// TestRemindersConcurrentStress runs every kind of mutation concurrently,
+// it is meant to run under the race detector: go test -race ./server/services
+func TestRemindersConcurrentStress(t *testing.T) {
+	s, repo := newTestService(t)
+	const workers, rounds = 8, 150
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := s.save(); err != nil {
+				t.Errorf("could not save: %v", err)
+				return
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				d := time.Hour
+				if i%2 == 0 {
+					d = time.Nanosecond
+				}
+				r, err := s.Create(testAdmin, ReminderCreateBody{Title: "t", Message: "m", Duration: d})
+				if err != nil {
+					t.Errorf("could not create reminder: %v", err)
+					return
+				}
+				if _, err := s.Edit(testAdmin, ReminderEditBody{ID: r.ID, Title: "edited"}); err != nil {
+					t.Errorf("could not edit reminder %d: %v", r.ID, err)
+				}
+				if _, err := s.Fetch(testAdmin, []int{r.ID}); err != nil {
+					t.Errorf("could not fetch reminder %d: %v", r.ID, err)
+				}
+				notified, ok := s.notifying(r.ID)
+				switch {
+				case !ok:
+				case i%3 == 0:
+					s.snapshotGrooming(notified)
+				case i%3 == 1:
+					s.retry(notified, 0)
+				default:
+					s.retry(notified, time.Minute)
+				}
+				if i%4 == 0 {
+					if err := s.Delete(testAdmin, []int{r.ID}); err != nil {
+						t.Errorf("could not delete reminder %d: %v", r.ID, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	background.Wait()
+
+	if err := s.save(); err != nil {
+		t.Fatalf("could not save: %v", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	want := 0
+	for i := 0; i < rounds; i++ {
+		if i%4 != 0 {
+			want += workers
+		}
+	}
+	if len(s.current.All) != want {
+		t.Errorf("expected %d reminders, got %d", want, len(s.current.All))
+	}
+	ids := repo.ids()
+	if len(ids) != len(s.current.All) {
+		t.Fatalf("expected %d saved reminders, got %d", len(s.current.All), len(ids))
+	}
+	for _, id := range ids {
+		if _, ok := s.current.All[id]; !ok {
+			t.Errorf("saved reminder %d is not in the snapshot", id)
+		}
+	}
+	for id := range s.current.UnCompleted {
+		if !s.current.All[id].Status.Active() {
+			t.Errorf("reminder %d is pending with status %s", id, s.current.All[id].Status)
+		}
+	}
+}
+
+// dueReminder creates a reminder which is due right away and marks it as being notified
+func dueReminder(t *testing.T, s *Reminders) models.Reminder {
+	t.Helper()
+	r, err := s.Create(testAdmin, ReminderCreateBody{Title: "t", Message: "m", Duration: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("could not create reminder: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	notified, ok := s.notifying(r.ID)
+	if !ok {
+		t.Fatalf("reminder %d could not be notified", r.ID)
+	}
+	return notified
+}
+
+func TestStaleNotificationResultsAreDropped(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Reminders, id int) error
+		result func(s *Reminders, notified models.Reminder)
+		want   models.Status
+	}{
+		{
+			name: "closed after a snooze",
+			change: func(s *Reminders, id int) error {
+				_, err := s.Snooze(testAdmin, ReminderSnoozeBody{ID: id, Duration: time.Hour})
+				return err
+			},
+			result: func(s *Reminders, notified models.Reminder) { s.snapshotGrooming(notified) },
+			want:   models.StatusSnoozed,
+		},
+		{
+			name: "failed after a completion",
+			change: func(s *Reminders, id int) error {
+				_, err := s.Complete(testAdmin, id)
+				return err
+			},
+			result: func(s *Reminders, notified models.Reminder) { s.retry(notified, 0) },
+			want:   models.StatusCompleted,
+		},
+		{
+			name: "snoozed after a completion",
+			change: func(s *Reminders, id int) error {
+				_, err := s.Complete(testAdmin, id)
+				return err
+			},
+			result: func(s *Reminders, notified models.Reminder) { s.retry(notified, time.Minute) },
+			want:   models.StatusCompleted,
+		},
+		{
+			name: "closed after being notified again",
+			change: func(s *Reminders, id int) error {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				r := s.current.All[id]
+				later := r.NotifiedAt.Add(time.Second)
+				r.NotifiedAt = &later
+				return s.put(r)
+			},
+			result: func(s *Reminders, notified models.Reminder) { s.snapshotGrooming(notified) },
+			want:   models.StatusNotifying,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			notified := dueReminder(t, s)
+			if err := tt.change(s, notified.ID); err != nil {
+				t.Fatalf("could not change reminder: %v", err)
+			}
+			tt.result(s, notified)
+			got, err := s.Fetch(testAdmin, []int{notified.ID})
+			if err != nil {
+				t.Fatalf("could not fetch reminder: %v", err)
+			}
+			if got[0].Status != tt.want {
+				t.Errorf("expected status %s, got %s", tt.want, got[0].Status)
+			}
+		})
+	}
+}
+
+func TestCurrentNotificationResultsApply(t *testing.T) {
+	s, _ := newTestService(t)
+	closed := dueReminder(t, s)
+	s.snapshotGrooming(closed)
+	snoozed := dueReminder(t, s)
+	s.retry(snoozed, time.Hour)
+	got, err := s.Fetch(testAdmin, []int{closed.ID, snoozed.ID})
+	if err != nil {
+		t.Fatalf("could not fetch reminders: %v", err)
+	}
+	if got[0].Status != models.StatusCompleted {
+		t.Errorf("expected the closed reminder to be completed, got %s", got[0].Status)
+	}
+	if got[1].Status != models.StatusSnoozed {
+		t.Errorf("expected the snoozed reminder to be snoozed, got %s", got[1].Status)
+	}
+}
+
+func TestSaveDoesNotBlockMutations(t *testing.T) {
+	s, repo := newTestService(t)
+	first, err := s.Create(testAdmin, ReminderCreateBody{Title: "first", Message: "m", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("could not create reminder: %v", err)
+	}
+	var during models.Reminder
+	repo.onSave = func() {
+		repo.onSave = nil
+		done := make(chan error)
+		go func() {
+			var err error
+			during, err = s.Create(testAdmin, ReminderCreateBody{Title: "during", Message: "m", Duration: time.Hour})
+			if err == nil {
+				err = s.Delete(testAdmin, []int{first.ID})
+			}
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("could not mutate reminders while saving: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("mutations are blocked while the snapshot is written")
+		}
+	}
+	if err := s.save(); err != nil {
+		t.Fatalf("could not save: %v", err)
+	}
+	if ids := repo.ids(); len(ids) != 1 || ids[0] != during.ID {
+		t.Errorf("expected the mutations during the save to be kept, got reminders %v", ids)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.saved == s.generation {
+		t.Error("expected the mutations during the save to be left unsaved")
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// scheduledItem represents a reminder which is due at a given instant
+type scheduledItem struct {
+	id    int
+	due   time.Time
+	index int
+}
+
+// dueQueue represents a min-heap of scheduled reminders ordered by due time
+// reminders due at the same instant are ordered by id, which keeps firing deterministic
+type dueQueue []*scheduledItem
+
+func (q dueQueue) Len() int { return len(q) }
+
+func (q dueQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].id < q[j].id
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q dueQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *dueQueue) Push(x interface{}) {
+	item := x.(*scheduledItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *dueQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
+
+// Scheduler represents the reminders scheduler
+// it keeps the pending reminders in a min-heap keyed by due time and waits
+// on a single timer, which is reset whenever the earliest due time changes
+// every scheduled instant fires exactly once, even when the timer is late
+type Scheduler struct {
+	mu    sync.Mutex
+	queue dueQueue
+	items map[int]*scheduledItem
+	wake  chan struct{}
+	C     chan int
+}
+
+// NewScheduler creates a new instance of Scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		items: map[int]*scheduledItem{},
+		wake:  make(chan struct{}, 1),
+		C:     make(chan int),
+	}
+}
+
+// Schedule schedules a reminder at the given due time, replacing its previous due time
+func (s *Scheduler) Schedule(id int, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item, ok := s.items[id]; ok {
+		item.due = due
+		heap.Fix(&s.queue, item.index)
+	} else {
+		item := &scheduledItem{id: id, due: due}
+		heap.Push(&s.queue, item)
+		s.items[id] = item
+	}
+	s.notify()
+}
+
+// Unschedule removes a reminder from the schedule
+func (s *Scheduler) Unschedule(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.queue, item.index)
+	delete(s.items, id)
+	s.notify()
+}
+
+// Len retrieves the number of scheduled reminders
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Run sends the ids of due reminders on C, until the stop channel is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		var ids []int
+		s.mu.Lock()
+		now := time.Now()
+		for len(s.queue) > 0 && !s.queue[0].due.After(now) {
+			item := heap.Pop(&s.queue).(*scheduledItem)
+			delete(s.items, item.id)
+			ids = append(ids, item.id)
+		}
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = s.queue[0].due.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for _, id := range ids {
+			select {
+			case s.C <- id:
+			case <-stop:
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// notify wakes up the run loop, so it can pick up a new earliest due time
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
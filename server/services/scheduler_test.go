@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// collect receives the fired ids until n were received, then waits a while for duplicates
+func collect(t *testing.T, s *Scheduler, n int) map[int]int {
+	t.Helper()
+	fired := map[int]int{}
+	received := 0
+	timeout := time.After(2 * time.Second)
+	for received < n {
+		select {
+		case id := <-s.C:
+			fired[id]++
+			received++
+		case <-timeout:
+			t.Fatalf("expected %d reminders to fire, got %d", n, received)
+		}
+	}
+	select {
+	case id := <-s.C:
+		t.Errorf("reminder %d fired after all of them did", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return fired
+}
+
+func TestSchedulerLateTimerFiresEveryInstantOnce(t *testing.T) {
+	s := NewScheduler()
+	now := time.Now()
+	const n = 50
+	for id := 1; id <= n; id++ {
+		s.Schedule(id, now.Add(time.Duration(id%5)*time.Millisecond))
+	}
+	// every instant passes before the loop looks at the queue, like a timer which fires late
+	time.Sleep(20 * time.Millisecond)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+
+	fired := collect(t, s, n)
+	for id := 1; id <= n; id++ {
+		if fired[id] != 1 {
+			t.Errorf("reminder %d fired %d time(s), expected once", id, fired[id])
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("expected an empty schedule, got %d scheduled", s.Len())
+	}
+}
+
+func TestSchedulerRescheduleFiresTheLatestInstantOnce(t *testing.T) {
+	s := NewScheduler()
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+
+	now := time.Now()
+	s.Schedule(1, now.Add(time.Hour))
+	s.Schedule(2, now.Add(10*time.Millisecond))
+	s.Schedule(1, now.Add(20*time.Millisecond))
+	s.Schedule(3, now.Add(5*time.Millisecond))
+	s.Unschedule(3)
+
+	fired := collect(t, s, 2)
+	if fired[1] != 1 || fired[2] != 1 || fired[3] != 0 {
+		t.Errorf("expected reminders 1 & 2 to fire once, got %v", fired)
+	}
+}
+
+// pollingScan is one tick of the loop the scheduler replaced: every second it copied
+// the pending reminders and scanned all of them for the ones due within that second
+func pollingScan(pending RemindersMap, now time.Time) []int {
+	snapshot := make(RemindersMap, len(pending))
+	for id, r := range pending {
+		snapshot[id] = r
+	}
+	var due []int
+	for id, r := range snapshot {
+		tick := r.Due().UnixNano()
+		if tick > now.UnixNano() && tick < now.Add(time.Second).UnixNano() {
+			due = append(due, id)
+		}
+	}
+	return due
+}
+
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+// BenchmarkPollingTick measures a tick of the old loop, which ran every second
+// whether anything was due or not
+func BenchmarkPollingTick(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("pending=%d", n), func(b *testing.B) {
+			now := time.Now()
+			pending := make(RemindersMap, n)
+			for id := 1; id <= n; id++ {
+				pending[id] = models.Reminder{ID: id, DueAt: now.Add(time.Duration(id) * time.Minute)}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pollingScan(pending, now)
+			}
+		})
+	}
+}
+
+// BenchmarkSchedulerFire measures scheduling a reminder and receiving it once it is due,
+// the scheduler does no work at all while nothing is due
+func BenchmarkSchedulerFire(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("pending=%d", n), func(b *testing.B) {
+			s := NewScheduler()
+			now := time.Now()
+			for id := 1; id <= n; id++ {
+				s.Schedule(id, now.Add(time.Duration(id)*time.Minute))
+			}
+			stop := make(chan struct{})
+			defer close(stop)
+			go s.Run(stop)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Schedule(n+1, time.Now())
+				<-s.C
+			}
+		})
+	}
+}
+
+// BenchmarkSchedulerReschedule measures moving a pending reminder, e.g. on an edit or a snooze
+func BenchmarkSchedulerReschedule(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("pending=%d", n), func(b *testing.B) {
+			s := NewScheduler()
+			now := time.Now()
+			for id := 1; id <= n; id++ {
+				s.Schedule(id, now.Add(time.Duration(id)*time.Minute))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := i%n + 1
+				s.Schedule(id, now.Add(time.Duration(n-id)*time.Minute))
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// transitions represents the allowed reminder lifecycle state transitions
+var transitions = map[models.Status][]models.Status{
+	models.StatusPending: {
+		models.StatusNotifying,
+		models.StatusSnoozed,
+		models.StatusCompleted,
+		models.StatusCancelled,
+	},
+	models.StatusNotifying: {
+		models.StatusPending,
+		models.StatusSnoozed,
+		models.StatusCompleted,
+		models.StatusCancelled,
+	},
+	models.StatusSnoozed: {
+		models.StatusPending,
+		models.StatusNotifying,
+		models.StatusSnoozed,
+		models.StatusCompleted,
+		models.StatusCancelled,
+	},
+	models.StatusCompleted: {
+		models.StatusPending,
+	},
+	models.StatusCancelled: {
+		models.StatusPending,
+	},
+}
+
+// canTransition reports whether a reminder can move from one state to another
+func canTransition(from, to models.Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves a reminder to a new lifecycle state and stamps the state timestamps
+func transition(reminder *models.Reminder, to models.Status, now time.Time) error {
+	from := reminder.Status
+	if from == "" {
+		from = models.StatusPending
+	}
+	if from != to && !canTransition(from, to) {
+		return models.ConflictError{
+			Message: fmt.Sprintf(
+				"reminder with id: %d cannot be moved from '%s' to '%s'",
+				reminder.ID, from, to,
+			),
+		}
+	}
+	reminder.Status = to
+	switch to {
+	case models.StatusNotifying:
+		reminder.NotifiedAt = &now
+	case models.StatusCompleted, models.StatusCancelled:
+		reminder.CompletedAt = &now
+	case models.StatusPending:
+		reminder.CompletedAt = nil
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/gophertuts/reminders-cli/server/models"
+)
+
+// User represents the user on whose behalf the reminders are accessed
+// users only access the reminders they own, admins access the reminders of every user
+type User struct {
+	Name  string
+	Admin bool
+}
+
+// owns checks whether the user can access a reminder
+func (u User) owns(reminder models.Reminder) bool {
+	return u.Admin || reminder.Owner == u.Name
+}
+
+// owner retrieves the owner to filter the reminders by, empty for all of them
+func (u User) owner() string {
+	if u.Admin {
+		return ""
+	}
+	return u.Name
+}
+
+// find retrieves a reminder the user can access
+// the reminders of other users are not found, so their ids are not disclosed
+// the caller must hold the lock
+func (s *Reminders) find(user User, id int) (models.Reminder, error) {
+	reminder, ok := s.current.All[id]
+	if !ok || !user.owns(reminder) {
+		return models.Reminder{}, models.NotFoundError{
+			Message: fmt.Sprintf("could not find reminder with id: %d", id),
+		}
+	}
+	return reminder, nil
+}
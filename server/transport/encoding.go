@@ -13,6 +13,10 @@ const (
 	dataValidationErrType   = "data_validation_error"
 	formatValidationErrType = "format_validation_error"
 	invalidJSONErrType      = "invalid_json_error"
+	conflictErrType         = "conflict_error"
+	unauthorizedErrType     = "unauthorized_error"
+	forbiddenErrType        = "forbidden_error"
+	methodNotAllowedErrType = "method_not_allowed_error"
 	serviceErrType          = "service_error"
 )
 
@@ -58,6 +62,18 @@ func toHTTPError(err error) models.HTTPError {
 	case models.InvalidJSONError:
 		resErr.Code = http.StatusBadRequest
 		resErr.Type = invalidJSONErrType
+	case models.ConflictError:
+		resErr.Code = http.StatusConflict
+		resErr.Type = conflictErrType
+	case models.UnauthorizedError:
+		resErr.Code = http.StatusUnauthorized
+		resErr.Type = unauthorizedErrType
+	case models.ForbiddenError:
+		resErr.Code = http.StatusForbidden
+		resErr.Type = forbiddenErrType
+	case models.MethodNotAllowedError:
+		resErr.Code = http.StatusMethodNotAllowed
+		resErr.Type = methodNotAllowedErrType
 	default:
 		resErr.Code = http.StatusInternalServerError
 		resErr.Type = serviceErrType
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SendEvent sends a Server-Sent Event with a json payload to the client, and flushes it
+// the id is left out when empty, so the client keeps its last event id
+func SendEvent(w http.ResponseWriter, id, event string, data interface{}) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", event, bs)
+	return sendRaw(w, b.String())
+}
+
+// SendComment sends a Server-Sent Events comment, which clients ignore
+// it keeps idle streams from being closed by proxies
+func SendComment(w http.ResponseWriter, comment string) error {
+	return sendRaw(w, ": "+comment+"\n\n")
+}
+
+// SendRetry tells the client how long to wait before it reconnects to an event stream
+func SendRetry(w http.ResponseWriter, d time.Duration) error {
+	return sendRaw(w, fmt.Sprintf("retry: %d\n\n", d.Milliseconds()))
+}
+
+// sendRaw writes to an event stream and flushes it
+func sendRaw(w http.ResponseWriter, s string) error {
+	if _, err := fmt.Fprint(w, s); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
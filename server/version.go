@@ -0,0 +1,5 @@
+package server
+
+// Version represents the version of the server
+// it is set at build time: -ldflags "-X github.com/gophertuts/reminders-cli/server.Version=v1.2.3"
+var Version = "dev"